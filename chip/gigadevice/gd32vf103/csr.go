@@ -0,0 +1,99 @@
+//-----------------------------------------------------------------------------
+/*
+
+GigaDevice gd32vf103 Bumblebee Core CSRs
+
+The Nuclei Bumblebee core has vendor specific CSRs for the ECLIC interrupt
+handling. The interrupt handling CSRs with side effects (mnxti, jalmnxti,
+push*) are not included. An access to mnxti can claim the highest priority
+pending interrupt and change mstatus/mintstatus/mcause. The CSR display and
+the context save/restore access every CSR in the decode, so including it
+would change the interrupt state of the halted hart.
+
+*/
+//-----------------------------------------------------------------------------
+
+package gd32vf103
+
+import (
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/soc"
+)
+
+//-----------------------------------------------------------------------------
+
+var privEnum = soc.Enum{0: "u", 1: "s", 3: "m"}
+
+var trapEnum = soc.Enum{0: "normal", 1: "interrupt", 2: "exception", 3: "nmi"}
+
+// BumblebeeCSR returns the vendor specific CSRs for the Bumblebee core.
+func BumblebeeCSR(hi *rv.HartInfo) []soc.Register {
+	return []soc.Register{
+		{Offset: 0x307, Name: "mtvt"},
+		{Offset: 0x320,
+			Name: "mcountinhibit",
+			Fields: []soc.Field{
+				{Name: "ir", Msb: 2, Lsb: 2},
+				{Name: "cy", Msb: 0, Lsb: 0},
+			},
+		},
+		{Offset: 0x342,
+			Name: "mcause",
+			Fields: []soc.Field{
+				{Name: "interrupt", Msb: 31, Lsb: 31},
+				{Name: "minhv", Msb: 30, Lsb: 30},
+				{Name: "mpp", Msb: 29, Lsb: 28, Enums: privEnum},
+				{Name: "mpie", Msb: 27, Lsb: 27},
+				{Name: "mpil", Msb: 23, Lsb: 16},
+				{Name: "exccode", Msb: 11, Lsb: 0},
+			},
+		},
+		{Offset: 0x346,
+			Name: "mintstatus",
+			Fields: []soc.Field{
+				{Name: "mil", Msb: 31, Lsb: 24},
+				{Name: "uil", Msb: 7, Lsb: 0},
+			},
+		},
+		{Offset: 0x348, Name: "mscratchcsw"},
+		{Offset: 0x349, Name: "mscratchcswl"},
+		{Offset: 0x7c3, Name: "mnvec"},
+		{Offset: 0x7c4,
+			Name: "msubm",
+			Fields: []soc.Field{
+				{Name: "ptyp", Msb: 9, Lsb: 8, Enums: trapEnum},
+				{Name: "typ", Msb: 7, Lsb: 6, Enums: trapEnum},
+			},
+		},
+		{Offset: 0x7d0,
+			Name: "mmisc_ctl",
+			Fields: []soc.Field{
+				{Name: "nmi_cause_fff", Msb: 9, Lsb: 9},
+			},
+		},
+		{Offset: 0x7d6,
+			Name: "msavestatus",
+			Fields: []soc.Field{
+				{Name: "ptyp2", Msb: 15, Lsb: 14, Enums: trapEnum},
+				{Name: "mpp2", Msb: 10, Lsb: 9, Enums: privEnum},
+				{Name: "mpie2", Msb: 8, Lsb: 8},
+				{Name: "ptyp1", Msb: 7, Lsb: 6, Enums: trapEnum},
+				{Name: "mpp1", Msb: 2, Lsb: 1, Enums: privEnum},
+				{Name: "mpie1", Msb: 0, Lsb: 0},
+			},
+		},
+		{Offset: 0x7d7, Name: "msaveepc1"},
+		{Offset: 0x7d8, Name: "msavecause1"},
+		{Offset: 0x7d9, Name: "msaveepc2"},
+		{Offset: 0x7da, Name: "msavecause2"},
+		{Offset: 0x7ec,
+			Name: "mtvt2",
+			Fields: []soc.Field{
+				{Name: "common_code_entry", Msb: 31, Lsb: 2},
+				{Name: "mtvt2en", Msb: 0, Lsb: 0},
+			},
+		},
+	}
+}
+
+//-----------------------------------------------------------------------------
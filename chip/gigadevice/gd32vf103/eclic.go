@@ -0,0 +1,191 @@
+//-----------------------------------------------------------------------------
+/*
+
+GigaDevice gd32vf103 ECLIC
+
+Decode the state of the Nuclei Enhanced Core Local Interrupt Controller.
+
+*/
+//-----------------------------------------------------------------------------
+
+package gd32vf103
+
+import (
+	"fmt"
+	"strings"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/soc"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// ECLIC register offsets.
+const (
+	eclicCfg  = 0x0    // cliccfg
+	eclicInfo = 0x4    // clicinfo
+	eclicMth  = 0xb    // mth
+	eclicInt  = 0x1000 // clicintip[i], clicintie[i], clicintattr[i], clicintctl[i]
+)
+
+// coreInterrupt are the names of the core internal interrupts.
+var coreInterrupt = map[uint]string{
+	3:  "msip",
+	7:  "mtip",
+	17: "bwei",
+	18: "pmovi",
+}
+
+// the first external interrupt
+const eclicExternal = 19
+
+var trigName = [4]string{"level", "rising", "level", "falling"}
+
+// eclicInterrupt is the decoded state of an ECLIC interrupt.
+type eclicInterrupt struct {
+	irq   uint
+	ip    bool   // pending
+	ie    bool   // enabled
+	shv   bool   // hardware vectored
+	trig  string // trigger type
+	level uint   // interrupt level
+	prio  uint   // interrupt priority
+}
+
+// interruptName returns the name of an ECLIC interrupt.
+func interruptName(dev *soc.Device, irq uint) string {
+	if irq < eclicExternal {
+		return coreInterrupt[irq]
+	}
+	for _, x := range dev.Interrupts {
+		if x.IRQ == irq {
+			return x.Name
+		}
+	}
+	return ""
+}
+
+// EclicStatus returns a decoded display string for the ECLIC.
+// Only enabled or pending interrupts are displayed unless all is set.
+func EclicStatus(drv soc.Driver, dev *soc.Device, all bool) (string, error) {
+	p, err := dev.GetPeripheral("ECLIC")
+	if err != nil {
+		return "", err
+	}
+	cfg, err := drv.Rd(8, p.Addr+eclicCfg)
+	if err != nil {
+		return "", err
+	}
+	info, err := drv.Rd(32, p.Addr+eclicInfo)
+	if err != nil {
+		return "", err
+	}
+	mth, err := drv.Rd(8, p.Addr+eclicMth)
+	if err != nil {
+		return "", err
+	}
+	nlbits := util.Bits(cfg, 4, 1)
+	ctlbits := util.Bits(info, 24, 21)
+	num := util.Bits(info, 12, 0)
+	if nlbits > ctlbits {
+		nlbits = ctlbits
+	}
+
+	x := []string{fmt.Sprintf("interrupts %d, version 0x%x, ctlbits %d, nlbits %d, mth %d", num, util.Bits(info, 20, 13), ctlbits, nlbits, mth)}
+	s := [][]string{{"irq", "name", "ie", "ip", "trig", "shv", "level", "prio"}}
+	for i := uint(0); i < num; i++ {
+		addr := p.Addr + eclicInt + (i * 4)
+		ip, err := drv.Rd(8, addr)
+		if err != nil {
+			return "", err
+		}
+		ie, err := drv.Rd(8, addr+1)
+		if err != nil {
+			return "", err
+		}
+		e := eclicInterrupt{
+			irq: i,
+			ip:  ip&1 != 0,
+			ie:  ie&1 != 0,
+		}
+		if !all && !e.ip && !e.ie {
+			continue
+		}
+		attr, err := drv.Rd(8, addr+2)
+		if err != nil {
+			return "", err
+		}
+		ctl, err := drv.Rd(8, addr+3)
+		if err != nil {
+			return "", err
+		}
+		e.shv = attr&1 != 0
+		e.trig = trigName[util.Bits(attr, 2, 1)]
+		// the upper nlbits of clicintctl are the level, the next bits are the priority
+		if nlbits != 0 {
+			e.level = ctl >> (8 - nlbits)
+		}
+		if ctlbits > nlbits {
+			e.prio = util.Bits(ctl, 7-nlbits, 8-ctlbits)
+		}
+		s = append(s, []string{
+			fmt.Sprintf("%d", e.irq),
+			interruptName(dev, e.irq),
+			fmt.Sprintf("%d", util.BoolToInt(e.ie)),
+			fmt.Sprintf("%d", util.BoolToInt(e.ip)),
+			e.trig,
+			fmt.Sprintf("%d", util.BoolToInt(e.shv)),
+			fmt.Sprintf("%d", e.level),
+			fmt.Sprintf("%d", e.prio),
+		})
+	}
+	if len(s) == 1 {
+		x = append(x, "no enabled or pending interrupts")
+	} else {
+		x = append(x, cli.TableString(s, []int{0, 0, 0, 0, 0, 0, 0, 0}, 1))
+	}
+	return strings.Join(x, "\n"), nil
+}
+
+//-----------------------------------------------------------------------------
+
+// target provides a method for getting the SoC device and driver.
+type target interface {
+	GetSoC() (*soc.Device, soc.Driver)
+}
+
+// EclicHelp is help for the eclic command.
+var EclicHelp = []cli.Help{
+	{"<cr>", "display enabled or pending interrupts"},
+	{"all", "display all interrupts"},
+}
+
+// CmdEclic displays the ECLIC interrupt state.
+var CmdEclic = cli.Leaf{
+	Descr: "display ECLIC interrupt state",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		all := false
+		if len(args) == 1 {
+			if args[0] != "all" {
+				c.User.Put(fmt.Sprintf("unknown argument \"%s\"\n", args[0]))
+				return
+			}
+			all = true
+		}
+		dev, drv := c.User.(target).GetSoC()
+		s, err := EclicStatus(drv, dev, all)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", s))
+	},
+}
+
+//-----------------------------------------------------------------------------
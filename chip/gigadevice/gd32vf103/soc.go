@@ -88,3 +88,25 @@ func NewSoC(variant Variant) *soc.Device {
 }
 
 //-----------------------------------------------------------------------------
+
+// DBG_CTL bits
+const (
+	dbgSlpHold   = (1 << 0) // keep the debug clocks in sleep mode
+	dbgDslpHold  = (1 << 1) // keep the debug clocks in deep-sleep mode
+	dbgStbHold   = (1 << 2) // keep the debug clocks in standby mode
+	dbgFwdgtHold = (1 << 8) // hold the free watchdog when the core is halted
+	dbgWwdgtHold = (1 << 9) // hold the window watchdog when the core is halted
+)
+
+// DebugHold sets up DBG_CTL so the watchdogs don't reset a halted core and
+// the debugger stays connected in the low power modes. DBG_CTL is cleared by
+// a system reset.
+func DebugHold(drv soc.Driver, dev *soc.Device) error {
+	p, err := dev.GetPeripheral("DBG")
+	if err != nil {
+		return err
+	}
+	return p.Set(drv, "CTL", dbgSlpHold|dbgDslpHold|dbgStbHold|dbgFwdgtHold|dbgWwdgtHold)
+}
+
+//-----------------------------------------------------------------------------
@@ -20,6 +20,7 @@ import (
 	"github.com/deadsy/rvdbg/target"
 	"github.com/deadsy/rvdbg/target/aphx"
 	"github.com/deadsy/rvdbg/target/gd32v"
+	"github.com/deadsy/rvdbg/target/generic"
 	"github.com/deadsy/rvdbg/target/geode"
 	"github.com/deadsy/rvdbg/target/maixgo"
 	"github.com/deadsy/rvdbg/target/pico"
@@ -62,6 +63,8 @@ func run(info *target.Info) error {
 		tgt, err = aphx.New(jtagDriver)
 	case "geode":
 		tgt, err = geode.New(jtagDriver)
+	case "generic":
+		tgt, err = generic.New(jtagDriver)
 	case "wap":
 		tgt, err = wap.New(jtagDriver)
 	case "maixgo":
@@ -101,6 +104,7 @@ func run(info *target.Info) error {
 func addTargets() {
 	target.Add(&aphx.Info)
 	target.Add(&geode.Info)
+	target.Add(&generic.Info)
 	target.Add(&gd32v.Info)
 	target.Add(&maixgo.Info)
 	target.Add(&redv.Info)
@@ -103,8 +103,9 @@ const cs_ERR = cs_STICKYORUN | cs_STICKYCMP | cs_STICKYERR
 
 // JtagDP is a JTAG-DP access object.
 type JtagDP struct {
-	dev *jtag.Device
-	ir  uint
+	dev    *jtag.Device
+	ir     uint
+	resets int // chain TAP resets at the last IR write
 }
 
 // NewJtagDP returns a new JTAG-DP access object.
@@ -116,7 +117,7 @@ func NewJtagDP(dev *jtag.Device) *JtagDP {
 
 // WrIR writes the instruction register.
 func (dp *JtagDP) WrIR(ir uint) error {
-	if dp.ir == ir {
+	if dp.ir == ir && dp.resets == dp.dev.TapResets() {
 		// no changes
 		return nil
 	}
@@ -124,7 +125,7 @@ func (dp *JtagDP) WrIR(ir uint) error {
 	if err != nil {
 		return err
 	}
-	dp.ir = ir
+	dp.ir, dp.resets = ir, dp.dev.TapResets()
 	return nil
 }
 
@@ -0,0 +1,112 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Assembler Command
+
+Assemble instructions and write them to target memory.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+)
+
+//-----------------------------------------------------------------------------
+
+// asmWrite writes assembled instructions to target memory.
+// Instructions are written as halfwords to allow for 2-byte alignment.
+func asmWrite(dbg rv.Debug, hi *rv.HartInfo, code []rv.AsmIns) error {
+	// a removed software breakpoint would overwrite the new instruction
+	for _, x := range code {
+		bp := hi.GetBreakpoints().AtAddr(x.Addr)
+		if bp != nil {
+			return fmt.Errorf("breakpoint %d at 0x%x, remove it first", bp.ID, bp.Addr)
+		}
+	}
+	for _, x := range code {
+		val := []uint{uint(x.Ins & 0xffff)}
+		if x.Size == 4 {
+			val = append(val, uint(x.Ins>>16))
+		}
+		err := dbg.WrMem(16, x.Addr, val)
+		if err != nil {
+			return fmt.Errorf("unable to write memory at %x: %v", x.Addr, err)
+		}
+	}
+	return nil
+}
+
+// AsmHelp is help for the asm command.
+var AsmHelp = []cli.Help{
+	{"<addr> <ins>[; <ins> ...]", "assemble instructions to memory"},
+	{"<addr> @<file>", "assemble a source file to memory"},
+	{"  addr", "address (hex)"},
+}
+
+// CmdAsm assembles instructions to target memory.
+var CmdAsm = cli.Leaf{
+	Descr: "assemble instructions to memory",
+	F: func(c *cli.CLI, args []string) {
+		if len(args) < 2 {
+			c.User.Put("not enough arguments\n")
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		symbols := c.User.(target).GetSymbols()
+		maxAddr := uint((1 << dbg.GetAddressSize()) - 1)
+		addr, err := cli.UintArg(args[0], [2]uint{0, maxAddr}, 16)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		err = checkInsAlign(dbg, addr)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		// get the source
+		src := strings.Join(args[1:], " ")
+		if strings.HasPrefix(src, "@") {
+			buf, err := os.ReadFile(src[1:])
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			src = string(buf)
+		}
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			a := rv.NewAssembler(hi, func(name string) (uint, bool) {
+				s := symbols.LookupName(name)
+				if s == nil {
+					return 0, false
+				}
+				return s.Addr, true
+			})
+			code, err := a.Assemble(addr, src)
+			if err != nil {
+				return err
+			}
+			err = asmWrite(dbg, hi, code)
+			if err != nil {
+				return err
+			}
+			for _, x := range code {
+				c.User.Put(fmt.Sprintf("%s\n", hi.ISA.Disassemble(x.Addr, uint(x.Ins))))
+			}
+			return nil
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+	},
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,435 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Stack Backtrace
+
+Each frame is unwound using (in order of preference):
+
+1) DWARF call frame information from a loaded ELF file.
+2) The frame pointer (s0) chain.
+3) A scan of the function prologue for the stack adjustment and ra/s0 saves.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"errors"
+	"fmt"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/sym"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+const btMaxFrames = 64         // maximum number of displayed frames
+const btMaxFrameSize = 1 << 20 // maximum stack frame size
+const btScanLimit = 256        // maximum bytes for a prologue scan
+
+// btFrame is a stack frame.
+type btFrame struct {
+	pc   uint          // program counter
+	regs map[uint]uint // known register values
+	how  string        // how this frame was unwound
+}
+
+func (f *btFrame) sp() uint {
+	return f.regs[rv.RegSp]
+}
+
+// next returns a new frame with a copy of the register values.
+func (f *btFrame) next(how string) *btFrame {
+	x := &btFrame{
+		regs: map[uint]uint{},
+		how:  how,
+	}
+	for k, v := range f.regs {
+		x.regs[k] = v
+	}
+	return x
+}
+
+//-----------------------------------------------------------------------------
+// prologue decoding
+
+// spAdjust decodes a stack pointer adjustment (addi sp,sp,imm, c.addi16sp, c.addi sp).
+func spAdjust(ins uint) (int, bool) {
+	if ins&3 == 3 {
+		// addi sp,sp,imm
+		if ins&0xfffff == 0x10113 {
+			return int(int32(ins) >> 20), true
+		}
+		return 0, false
+	}
+	ins &= 0xffff
+	if ins&0xef83 == 0x6101 {
+		// c.addi16sp
+		imm := util.Bits(ins, 12, 12) << 9
+		imm |= util.Bits(ins, 6, 6) << 4
+		imm |= util.Bits(ins, 5, 5) << 6
+		imm |= util.Bits(ins, 4, 3) << 7
+		imm |= util.Bits(ins, 2, 2) << 5
+		return int(int16(imm<<6) >> 6), true
+	}
+	if ins&0xef83 == 0x0101 {
+		// c.addi sp,imm
+		imm := util.Bits(ins, 12, 12)<<5 | util.Bits(ins, 6, 2)
+		return int(int8(imm<<2) >> 2), true
+	}
+	return 0, false
+}
+
+// spStore decodes a register store relative to the stack pointer (sw, sd, c.swsp, c.sdsp).
+func spStore(ins, xlen uint) (uint, int, bool) {
+	if ins&3 == 3 {
+		// sw/sd rs2,imm(sp)
+		f3 := util.Bits(ins, 14, 12)
+		if ins&0x7f == 0x23 && (f3 == 2 || f3 == 3) && util.Bits(ins, 19, 15) == rv.RegSp {
+			imm := util.Bits(ins, 31, 25)<<5 | util.Bits(ins, 11, 7)
+			return util.Bits(ins, 24, 20), int(int16(imm<<4) >> 4), true
+		}
+		return 0, 0, false
+	}
+	ins &= 0xffff
+	if ins&0xe003 == 0xc002 {
+		// c.swsp
+		imm := util.Bits(ins, 12, 9)<<2 | util.Bits(ins, 8, 7)<<6
+		return util.Bits(ins, 6, 2), int(imm), true
+	}
+	if xlen == 64 && ins&0xe003 == 0xe002 {
+		// c.sdsp
+		imm := util.Bits(ins, 12, 10)<<3 | util.Bits(ins, 9, 7)<<6
+		return util.Bits(ins, 6, 2), int(imm), true
+	}
+	return 0, 0, false
+}
+
+// insLength returns the length in bytes of an instruction.
+func insLength(ins uint) uint {
+	if ins&3 == 3 {
+		return 4
+	}
+	return 2
+}
+
+//-----------------------------------------------------------------------------
+
+// unwinder unwinds the stack frames of the current (halted) hart.
+type unwinder struct {
+	dbg     rv.Debug
+	hi      *rv.HartInfo
+	symbols *sym.Table
+	ins     map[uint]uint // instruction cache
+}
+
+func (u *unwinder) rdWord(addr uint) (uint, error) {
+	x, err := u.dbg.RdMem(u.hi.MXLEN, addr, 1)
+	if err != nil {
+		return 0, err
+	}
+	return x[0], nil
+}
+
+func (u *unwinder) rdIns(addr uint) (uint, error) {
+	if ins, ok := u.ins[addr]; ok {
+		return ins, nil
+	}
+	ins, err := u.hi.GetBreakpoints().RdIns(u.dbg, addr)
+	if err != nil {
+		return 0, err
+	}
+	u.ins[addr] = ins
+	return ins, nil
+}
+
+// compressed returns true if the hart supports compressed instructions.
+func (u *unwinder) compressed() bool {
+	return u.hi.MISA&(1<<2) != 0
+}
+
+// cfi unwinds a frame using the DWARF call frame information.
+func (u *unwinder) cfi(f *btFrame, pc uint, top bool) (*btFrame, error) {
+	row, err := u.symbols.Unwind(pc)
+	if row == nil || err != nil {
+		return nil, err
+	}
+	if _, ok := row.Rules[row.RA]; !ok && !top {
+		// only the top frame can still have ra in the register
+		return nil, errors.New("return address is not saved")
+	}
+	base, ok := f.regs[row.CFAReg]
+	if !ok {
+		return nil, fmt.Errorf("cfa register x%d is unknown", row.CFAReg)
+	}
+	cfa := uint(int64(base) + row.CFAOffset)
+	x := f.next("cfi")
+	for reg, rule := range row.Rules {
+		switch rule.Kind {
+		case sym.RuleOffset:
+			v, err := u.rdWord(uint(int64(cfa) + rule.Offset))
+			if err != nil {
+				return nil, err
+			}
+			x.regs[reg] = v
+		case sym.RuleValOffset:
+			x.regs[reg] = uint(int64(cfa) + rule.Offset)
+		case sym.RuleRegister:
+			if v, ok := f.regs[rule.Reg]; ok {
+				x.regs[reg] = v
+			} else {
+				delete(x.regs, reg)
+			}
+		case sym.RuleUndefined:
+			delete(x.regs, reg)
+		}
+	}
+	x.regs[rv.RegSp] = cfa
+	// an undefined return address marks the end of the stack
+	x.pc = x.regs[row.RA]
+	return x, nil
+}
+
+// fp unwinds a frame using the frame pointer.
+func (u *unwinder) fp(f *btFrame) (*btFrame, error) {
+	fp, ok := f.regs[rv.RegS0]
+	if !ok {
+		return nil, nil
+	}
+	n := u.hi.MXLEN >> 3
+	if fp&(n-1) != 0 || fp <= f.sp() || fp-f.sp() > btMaxFrameSize {
+		return nil, nil
+	}
+	// ra and the caller fp are saved just below the frame pointer
+	ra, err := u.rdWord(fp - n)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := u.rdWord(fp - 2*n)
+	if err != nil {
+		return nil, err
+	}
+	x := f.next("fp")
+	x.pc = ra
+	x.regs[rv.RegRa] = ra
+	x.regs[rv.RegS0] = prev
+	x.regs[rv.RegSp] = fp
+	return x, nil
+}
+
+// funcStart returns the start address of the function containing a pc.
+func (u *unwinder) funcStart(pc uint) (uint, error) {
+	if s := u.symbols.Lookup(pc); s != nil && s.Func {
+		return s.Addr, nil
+	}
+	// search backwards for a stack allocation
+	step := uint(4)
+	if u.compressed() {
+		step = 2
+	}
+	lo := uint(0)
+	if pc > btScanLimit {
+		lo = pc - btScanLimit
+	}
+	for addr := (pc &^ (step - 1)) - step; addr >= lo && addr < pc; addr -= step {
+		ins, err := u.rdIns(addr)
+		if err != nil {
+			return 0, err
+		}
+		if adj, ok := spAdjust(ins); ok && adj < 0 {
+			return addr, nil
+		}
+	}
+	return 0, errors.New("no function prologue found")
+}
+
+// scan unwinds a frame by scanning the function prologue.
+func (u *unwinder) scan(f *btFrame, pc uint, top bool) (*btFrame, error) {
+	start, err := u.funcStart(pc)
+	if err != nil {
+		return nil, err
+	}
+	frame := 0
+	save := map[uint]int{}
+	for addr := start; addr < pc && addr < start+btScanLimit; {
+		ins, err := u.rdIns(addr)
+		if err != nil {
+			return nil, err
+		}
+		if adj, ok := spAdjust(ins); ok && adj < 0 && frame == 0 {
+			frame = -adj
+		} else if reg, ofs, ok := spStore(ins, u.hi.MXLEN); ok && frame != 0 {
+			if _, ok := save[reg]; !ok {
+				save[reg] = ofs
+			}
+		}
+		addr += insLength(ins)
+	}
+	x := f.next("scan")
+	for _, reg := range []uint{rv.RegRa, rv.RegS0} {
+		if ofs, ok := save[reg]; ok {
+			v, err := u.rdWord(f.sp() + uint(ofs))
+			if err != nil {
+				return nil, err
+			}
+			x.regs[reg] = v
+		} else if reg == rv.RegRa && !top {
+			// only the top frame can still have ra in the register
+			delete(x.regs, reg)
+		}
+	}
+	ra, ok := x.regs[rv.RegRa]
+	if !ok {
+		return nil, errors.New("return address is not saved")
+	}
+	x.pc = ra
+	x.regs[rv.RegSp] = f.sp() + uint(frame)
+	return x, nil
+}
+
+// valid returns true if the caller frame is plausible.
+func (u *unwinder) valid(f, x *btFrame) bool {
+	if x.pc&1 != 0 || x.sp() < f.sp() {
+		return false
+	}
+	if x.pc == f.pc && x.sp() == f.sp() {
+		// no progress
+		return false
+	}
+	if u.symbols.Len() != 0 {
+		s := u.symbols.Lookup(x.pc)
+		return s != nil && s.Func
+	}
+	return true
+}
+
+// unwind returns the caller of a frame (nil at the end of the stack).
+func (u *unwinder) unwind(f *btFrame, top bool) (*btFrame, error) {
+	// the return address may be just past the end of the calling function
+	pc := f.pc
+	if !top {
+		pc--
+	}
+	var lastErr error
+	x, err := u.cfi(f, pc, top)
+	if x != nil && x.pc == 0 {
+		return nil, nil
+	}
+	if x != nil && u.valid(f, x) {
+		return x, nil
+	}
+	lastErr = err
+	x, err = u.fp(f)
+	if x != nil && u.valid(f, x) {
+		return x, nil
+	}
+	if err != nil {
+		lastErr = err
+	}
+	x, err = u.scan(f, pc, top)
+	if x != nil && x.pc == 0 {
+		return nil, nil
+	}
+	if x != nil && u.valid(f, x) {
+		return x, nil
+	}
+	if err != nil {
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// backtrace returns the stack frames of the current (halted) hart.
+func backtrace(dbg rv.Debug, symbols *sym.Table, n uint) ([]*btFrame, error) {
+	hi := dbg.GetCurrentHart()
+	pc, err := dbg.RdCSR(rv.DPC, 0)
+	if err != nil {
+		return nil, err
+	}
+	f := &btFrame{
+		pc:   uint(pc),
+		regs: map[uint]uint{},
+	}
+	for _, reg := range []uint{rv.RegRa, rv.RegSp, rv.RegS0} {
+		x, err := dbg.RdGPR(reg, 0)
+		if err != nil {
+			return nil, err
+		}
+		f.regs[reg] = uint(x)
+	}
+	u := &unwinder{
+		dbg:     dbg,
+		hi:      hi,
+		symbols: symbols,
+		ins:     map[uint]uint{},
+	}
+	frames := []*btFrame{f}
+	for i := uint(1); i < n; i++ {
+		x, err := u.unwind(f, i == 1)
+		if err != nil {
+			return frames, err
+		}
+		if x == nil {
+			break
+		}
+		frames = append(frames, x)
+		f = x
+	}
+	return frames, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// BtHelp is help for the bt command.
+var BtHelp = []cli.Help{
+	{"[frames]", fmt.Sprintf("maximum number of frames (default %d)", btMaxFrames)},
+}
+
+// CmdBt displays the call stack of the current hart.
+var CmdBt = cli.Leaf{
+	Descr: "display the call stack backtrace",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		n := uint(btMaxFrames)
+		if len(args) == 1 {
+			n, err = cli.UintArg(args[0], [2]uint{1, btMaxFrames}, 10)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		symbols := c.User.(target).GetSymbols()
+		var frames []*btFrame
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			var err error
+			frames, err = backtrace(dbg, symbols, n)
+			return err
+		})
+		if len(frames) != 0 {
+			s := [][]string{{"#", "pc", "function", "sp", "unwind"}}
+			for i, f := range frames {
+				s = append(s, []string{
+					fmt.Sprintf("%d", i),
+					fmt.Sprintf("0x%x", f.pc),
+					symbols.AddrString(f.pc),
+					fmt.Sprintf("0x%x", f.sp()),
+					f.how,
+				})
+			}
+			c.User.Put(fmt.Sprintf("%s\n", cli.TableString(s, []int{0, 0, 0, 0, 0}, 1)))
+		}
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+	},
+}
+
+//-----------------------------------------------------------------------------
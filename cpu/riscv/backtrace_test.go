@@ -0,0 +1,68 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V backtrace test functions.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import "testing"
+
+//-----------------------------------------------------------------------------
+
+func Test_SpAdjust(t *testing.T) {
+	tests := []struct {
+		ins uint
+		adj int
+		ok  bool
+	}{
+		{0xff010113, -16, true},   // addi sp, sp, -16
+		{0x02010113, 32, true},    // addi sp, sp, 32
+		{0x80010113, -2048, true}, // addi sp, sp, -2048
+		{0x7139, -64, true},       // c.addi16sp sp, -64
+		{0x6105, 32, true},        // c.addi16sp sp, 32
+		{0x1101, -32, true},       // c.addi sp, -32
+		{0x0141, 16, true},        // c.addi sp, 16
+		{0xfff50513, 0, false},    // addi a0, a0, -1
+		{0xff010093, 0, false},    // addi ra, sp, -16
+		{0x10c1, 0, false},        // c.addi ra, -16
+		{0x8082, 0, false},        // ret
+	}
+	for _, v := range tests {
+		adj, ok := spAdjust(v.ins)
+		if ok != v.ok || adj != v.adj {
+			t.Errorf("0x%08x: expected %d %v, got %d %v", v.ins, v.adj, v.ok, adj, ok)
+		}
+	}
+}
+
+func Test_SpStore(t *testing.T) {
+	tests := []struct {
+		ins  uint
+		xlen uint
+		reg  uint
+		ofs  int
+		ok   bool
+	}{
+		{0x00112623, 32, 1, 12, true},   // sw ra, 12(sp)
+		{0xfe812e23, 32, 8, -4, true},   // sw s0, -4(sp)
+		{0x00113423, 64, 1, 8, true},    // sd ra, 8(sp)
+		{0x7e813c23, 64, 8, 2040, true}, // sd s0, 2040(sp)
+		{0xc606, 32, 1, 12, true},       // c.swsp ra, 12(sp)
+		{0xe406, 64, 1, 8, true},        // c.sdsp ra, 8(sp)
+		{0xe406, 32, 0, 0, false},       // c.fswsp ft1, 8(sp)
+		{0x00a5a023, 32, 0, 0, false},   // sw a0, 0(a1)
+		{0x00112603, 32, 0, 0, false},   // lw a2, 1(sp)
+		{0x00111623, 32, 0, 0, false},   // sh ra, 12(sp)
+	}
+	for _, v := range tests {
+		reg, ofs, ok := spStore(v.ins, v.xlen)
+		if ok != v.ok || reg != v.reg || ofs != v.ofs {
+			t.Errorf("0x%08x: expected %d %d %v, got %d %d %v", v.ins, v.reg, v.ofs, v.ok, reg, ofs, ok)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
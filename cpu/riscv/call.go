@@ -0,0 +1,279 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Target Function Call
+
+Call a function on the target with the current hart. The return address is
+a trampoline in a scratch RAM area given by the user, with a temporary
+breakpoint set on it. The callee runs on the caller's stack below a red zone.
+
+The pc, GPRs, FPRs, mstatus and fcsr are restored after the call returns.
+Other CSRs (e.g. mie, mtvec, mepc, mcause), vector state and any memory
+changed by the callee are not restored.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/sym"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+const callMaxArgs = 8   // a0..a7
+const callRedZone = 128 // stack bytes left untouched below the caller's sp
+
+// callContext is the saved hart context for a function call.
+type callContext struct {
+	pc      uint64   // dpc
+	mstatus uint64   // mstatus
+	fcsr    uint64   // fcsr (if floating point is implemented)
+	gpr     []uint64 // general purpose registers
+	fpr     []uint64 // floating point registers
+}
+
+// callSave saves the current hart context.
+func callSave(dbg rv.Debug, hi *rv.HartInfo) (*callContext, error) {
+	ctx := &callContext{
+		gpr: make([]uint64, hi.Nregs),
+	}
+	var err error
+	ctx.pc, err = dbg.RdCSR(rv.DPC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read pc: %v", err)
+	}
+	ctx.mstatus, err = dbg.RdCSR(rv.MSTATUS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mstatus: %v", err)
+	}
+	for i := 1; i < hi.Nregs; i++ {
+		ctx.gpr[i], err = dbg.RdGPR(uint(i), 0)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read gpr%d: %v", i, err)
+		}
+	}
+	if hi.FLEN != 0 {
+		ctx.fcsr, err = dbg.RdCSR(rv.FCSR, 0)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read fcsr: %v", err)
+		}
+		ctx.fpr = make([]uint64, 32)
+		for i := range ctx.fpr {
+			ctx.fpr[i], err = dbg.RdFPR(uint(i), 0)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read fpr%d: %v", i, err)
+			}
+		}
+	}
+	return ctx, nil
+}
+
+// restore restores a saved hart context.
+func (ctx *callContext) restore(dbg rv.Debug) error {
+	for i := 1; i < len(ctx.gpr); i++ {
+		err := dbg.WrGPR(uint(i), 0, ctx.gpr[i])
+		if err != nil {
+			return fmt.Errorf("unable to write gpr%d: %v", i, err)
+		}
+	}
+	for i := range ctx.fpr {
+		err := dbg.WrFPR(uint(i), 0, ctx.fpr[i])
+		if err != nil {
+			return fmt.Errorf("unable to write fpr%d: %v", i, err)
+		}
+	}
+	if ctx.fpr != nil {
+		err := dbg.WrCSR(rv.FCSR, 0, ctx.fcsr)
+		if err != nil {
+			return fmt.Errorf("unable to write fcsr: %v", err)
+		}
+	}
+	// mstatus is restored last, the fpr/fcsr writes may change mstatus.FS
+	err := dbg.WrCSR(rv.MSTATUS, 0, ctx.mstatus)
+	if err != nil {
+		return fmt.Errorf("unable to write mstatus: %v", err)
+	}
+	err = dbg.WrCSR(rv.DPC, 0, ctx.pc)
+	if err != nil {
+		return fmt.Errorf("unable to write pc: %v", err)
+	}
+	return nil
+}
+
+// callSetup sets up the registers for a call to addr returning to the trampoline.
+func callSetup(dbg rv.Debug, ctx *callContext, addr, tramp uint, args []uint) error {
+	// skip the red zone, keeping the stack 16 byte aligned
+	sp := (uint(ctx.gpr[rv.RegSp]) - callRedZone) &^ 15
+	for i, x := range args {
+		err := dbg.WrGPR(rv.RegA0+uint(i), 0, uint64(x))
+		if err != nil {
+			return fmt.Errorf("unable to write a%d: %v", i, err)
+		}
+	}
+	err := dbg.WrGPR(rv.RegSp, 0, uint64(sp))
+	if err != nil {
+		return fmt.Errorf("unable to write sp: %v", err)
+	}
+	err = dbg.WrGPR(rv.RegRa, 0, uint64(tramp))
+	if err != nil {
+		return fmt.Errorf("unable to write ra: %v", err)
+	}
+	err = dbg.WrCSR(rv.DPC, 0, uint64(addr))
+	if err != nil {
+		return fmt.Errorf("unable to write pc: %v", err)
+	}
+	return nil
+}
+
+// symbolArg returns the value of a symbol name or hex number argument.
+func symbolArg(symbols *sym.Table, arg string, maxVal uint) (uint, error) {
+	if s := symbols.LookupName(arg); s != nil {
+		return s.Addr, nil
+	}
+	return hexArg(arg, maxVal)
+}
+
+//-----------------------------------------------------------------------------
+
+// CallHelp is help for the call command.
+var CallHelp = []cli.Help{
+	{"<scratch> <addr> [args...]", "call a function"},
+	{"  scratch", "scratch RAM for the return trampoline, address (hex) or symbol name"},
+	{"  addr", "function address (hex) or symbol name"},
+	{"  args", fmt.Sprintf("up to %d arguments (hex) or symbol names, passed in a0..a7", callMaxArgs)},
+}
+
+// CmdCall calls a function on the current hart and displays the return value.
+var CmdCall = cli.Leaf{
+	Descr: "call a target function",
+	F: func(c *cli.CLI, args []string) {
+		if len(args) < 2 || len(args) > callMaxArgs+2 {
+			c.User.Put(fmt.Sprintf("need 2 to %d arguments\n", callMaxArgs+2))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		symbols := c.User.(target).GetSymbols()
+		hi := dbg.GetCurrentHart()
+		if hi.State != rv.Halted {
+			c.User.Put(fmt.Sprintf("hart%d is not halted\n", hi.ID))
+			return
+		}
+		// get the arguments
+		maxAddr := uint((1 << dbg.GetAddressSize()) - 1)
+		tramp, err := symbolArg(symbols, args[0], maxAddr)
+		if err == nil {
+			err = checkInsAlign(dbg, tramp)
+		}
+		if err != nil {
+			c.User.Put(fmt.Sprintf("scratch: %s\n", err))
+			return
+		}
+		addr, err := symbolArg(symbols, args[1], maxAddr)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		err = checkInsAlign(dbg, addr)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		if rv.RegA0+len(args)-2 > hi.Nregs {
+			c.User.Put(fmt.Sprintf("hart%d has %d argument registers\n", hi.ID, hi.Nregs-rv.RegA0))
+			return
+		}
+		val := []uint{}
+		for _, arg := range args[2:] {
+			x, err := symbolArg(symbols, arg, util.Mask(hi.MXLEN-1, 0))
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			val = append(val, x)
+		}
+		// save the context and setup the call
+		ctx, err := callSave(dbg, hi)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		b := hi.GetBreakpoints()
+		var tmp *rv.Breakpoint
+		err = callSetup(dbg, ctx, addr, tramp, val)
+		if err == nil {
+			tmp, err = b.Add(dbg, rv.BreakExecute, tramp, rv.BreakAuto)
+		}
+		// run until we halt
+		returned := false
+		if err == nil {
+			err = b.Resume(dbg)
+		}
+		if err == nil {
+			c.User.Put("running (ctrl-d to halt)\n")
+			done := c.Loop(func() bool {
+				var state rv.HartState
+				state, err = dbg.GetHartState()
+				if err != nil {
+					return true
+				}
+				if state != rv.Halted {
+					time.Sleep(nextPoll)
+					return false
+				}
+				// keep going after a semihosting request
+				return !semihostResume(dbg, c.User)
+			}, cli.KeycodeCtrlD)
+			if !done {
+				err = dbg.HaltHart()
+			}
+			if err == nil {
+				var pc uint64
+				pc, err = dbg.RdCSR(rv.DPC, 0)
+				returned = err == nil && uint(pc) == tramp
+			}
+		}
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+		// report the result
+		if returned {
+			s := []string{}
+			for _, reg := range []uint{rv.RegA0, rv.RegA0 + 1} {
+				x, err := dbg.RdGPR(reg, 0)
+				if err != nil {
+					c.User.Put(fmt.Sprintf("unable to read a%d: %v\n", reg-rv.RegA0, err))
+					break
+				}
+				s = append(s, fmt.Sprintf("a%d 0x%x", reg-rv.RegA0, x))
+			}
+			c.User.Put(fmt.Sprintf("%s\n", strings.Join(s, " ")))
+		} else if hi.State == rv.Halted {
+			c.User.Put(fmt.Sprintf("call did not return: %s\n", pcString(dbg)))
+		}
+		if hi.State != rv.Halted {
+			return
+		}
+		// remove the temporary breakpoint and restore the context
+		if tmp != nil {
+			err := b.Remove(dbg, tmp.ID)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+			}
+		}
+		err = ctx.restore(dbg)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+	},
+}
+
+//-----------------------------------------------------------------------------
@@ -12,10 +12,13 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	cli "github.com/deadsy/go-cli"
 	"github.com/deadsy/rvdbg/cpu/riscv/rv"
 	"github.com/deadsy/rvdbg/soc"
+	"github.com/deadsy/rvdbg/sym"
+	"github.com/deadsy/rvdbg/util"
 )
 
 //-----------------------------------------------------------------------------
@@ -24,6 +27,8 @@ import (
 type target interface {
 	GetRiscvDebug() rv.Debug
 	GetCSR() (*soc.Device, soc.Driver)
+	GetSymbols() *sym.Table
+	GetSemihost() *Semihost
 }
 
 //-----------------------------------------------------------------------------
@@ -33,14 +38,16 @@ type target interface {
 var CsrHelp = []cli.Help{
 	{"[register]", "register (string) - register name (or *)"},
 	{"<cr>", "display all registers"},
+	{"<register> <value>", "write a register, value (hex)"},
+	{"<register>.<field>=<value>", "write a register field, value (hex)"},
 }
 
-// CmdCSR displays the control and status registers.
+// CmdCSR displays and writes the control and status registers.
 var CmdCSR = cli.Leaf{
-	Descr: "display control and status registers",
+	Descr: "display/write control and status registers",
 	F: func(c *cli.CLI, args []string) {
 
-		err := cli.CheckArgc(args, []int{0, 1})
+		err := cli.CheckArgc(args, []int{0, 1, 2})
 		if err != nil {
 			c.User.Put(fmt.Sprintf("%s\n", err))
 			return
@@ -55,6 +62,11 @@ var CmdCSR = cli.Leaf{
 			return
 		}
 
+		if len(args) == 2 || strings.Contains(args[0], "=") {
+			csrWrite(c, p, drv, args)
+			return
+		}
+
 		if args[0] == "*" {
 			c.User.Put(fmt.Sprintf("%s\n", p.Display(drv, nil, true)))
 			return
@@ -70,6 +82,70 @@ var CmdCSR = cli.Leaf{
 	},
 }
 
+// csrWrite writes a CSR (or a field within a CSR) with a read-modify-write.
+func csrWrite(c *cli.CLI, p *soc.Peripheral, drv soc.Driver, args []string) {
+	// <register>[.<field>] <value> or <register>[.<field>]=<value>
+	lhs, rhs := args[0], ""
+	if len(args) == 2 {
+		rhs = args[1]
+	} else {
+		x := strings.SplitN(args[0], "=", 2)
+		lhs, rhs = x[0], x[1]
+	}
+	x := strings.SplitN(strings.ToLower(lhs), ".", 2)
+	r, err := p.GetRegister(x[0])
+	if err != nil {
+		c.User.Put(fmt.Sprintf("no register \"%s\" (run \"csr\" for the names)\n", x[0]))
+		return
+	}
+	var f *soc.Field
+	if len(x) == 2 {
+		f = r.GetField(x[1])
+		if f == nil {
+			c.User.Put(fmt.Sprintf("no field \"%s\" in register \"%s\"\n", x[1], r.Name))
+			return
+		}
+	}
+	size := drv.GetRegisterSize(r)
+	maxVal := util.Mask(size-1, 0)
+	if f != nil {
+		maxVal = util.Mask(f.Msb-f.Lsb, 0)
+	}
+	val, err := hexArg(rhs, maxVal)
+	if err != nil {
+		c.User.Put(fmt.Sprintf("%s\n", err))
+		return
+	}
+	dbg := c.User.(target).GetRiscvDebug()
+	var s string
+	err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+		if f != nil {
+			x, err := drv.Rd(size, r.Offset)
+			if err != nil {
+				return err
+			}
+			val = (x &^ util.Mask(f.Msb, f.Lsb)) | (val << f.Lsb)
+		}
+		err := drv.Wr(size, r.Offset, val)
+		if err != nil {
+			return err
+		}
+		s = p.Display(drv, r, true)
+		return nil
+	})
+	if err != nil {
+		c.User.Put(fmt.Sprintf("unable to write %s: %v\n", r.Name, err))
+		return
+	}
+	c.User.Put(fmt.Sprintf("%s\n", s))
+}
+
+// hexArg converts a hex argument (with an optional 0x prefix) to a uint.
+func hexArg(arg string, maxVal uint) (uint, error) {
+	arg = strings.TrimPrefix(strings.ToLower(arg), "0x")
+	return cli.UintArg(arg, [2]uint{0, maxVal}, 16)
+}
+
 //-----------------------------------------------------------------------------
 // display general purpose register set
 
@@ -111,13 +187,67 @@ func gprString(reg []uint64, xlen uint) string {
 	return strings.Join(s, "\n")
 }
 
-// CmdGpr displays the general purpose registers.
+// gprIndex returns the register number for a GPR name.
+func gprIndex(name string, nregs int) (uint, error) {
+	if name == "fp" {
+		name = "s0"
+	}
+	for i := 0; i < nregs; i++ {
+		if name == abiXName[i] || name == fmt.Sprintf("x%d", i) {
+			return uint(i), nil
+		}
+	}
+	return 0, fmt.Errorf("no register \"%s\"", name)
+}
+
+// GprHelp is help for the gpr command.
+var GprHelp = []cli.Help{
+	{"<cr>", "display all registers"},
+	{"<reg> <value>", "write a register"},
+	{"  reg", "register name (x0..x31, abi name or pc)"},
+	{"  value", "register value (hex)"},
+}
+
+// CmdGpr displays and writes the general purpose registers.
 var CmdGpr = cli.Leaf{
-	Descr: "display general purpose registers",
+	Descr: "display/write general purpose registers",
 	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 2})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
 		dbg := c.User.(target).GetRiscvDebug()
 		hi := dbg.GetCurrentHart()
-		err := dbg.HaltHart()
+		if len(args) == 2 {
+			name := strings.ToLower(args[0])
+			if name == "pc" {
+				pcWrite(c, args[1])
+				return
+			}
+			reg, err := gprIndex(name, hi.Nregs)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			if reg == 0 {
+				c.User.Put("x0 is read-only\n")
+				return
+			}
+			val, err := hexArg(args[1], util.Mask(hi.MXLEN-1, 0))
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+				return dbg.WrGPR(reg, 0, uint64(val))
+			})
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to write %s: %v\n", name, err))
+			}
+			return
+		}
+		err = dbg.HaltHart()
 		if err != nil {
 			c.User.Put(fmt.Sprintf("unable to halt hart%d: %v\n", hi.ID, err))
 			return
@@ -164,30 +294,87 @@ func fprString(reg []uint64, flen uint) string {
 	if fprCache == nil {
 		fprCache = reg
 	}
-	s := make([]string, len(reg))
+	s := [][]string{{"", "", "", "single", "half", ""}}
+	if flen == 64 {
+		s[0] = []string{"", "", "", "double", "single", "half", ""}
+	}
 	for i := 0; i < len(reg); i++ {
 		delta := ""
 		if reg[i] != fprCache[i] {
-			delta = " *"
+			delta = "*"
 		}
-		regStr := fmt.Sprintf("f%d", i)
 		valStr := "0"
 		if reg[i] != 0 {
 			valStr = fmt.Sprintf(fmtx, reg[i])
 		}
-		s[i] = fmt.Sprintf("%-4s %-4s %s%s", regStr, abiFName[i], valStr, delta)
+		x := []string{fmt.Sprintf("f%d", i), abiFName[i], valStr}
+		x = append(x, fprValues(reg[i], flen)...)
+		s = append(s, append(x, delta))
 	}
 	fprCache = reg
-	return strings.Join(s, "\n")
+	return cli.TableString(s, make([]int, len(s[0])), 1)
 }
 
-// CmdFpr displays the floating point registers.
+// fprIndex returns the register number for a FPR name.
+func fprIndex(name string) (uint, error) {
+	for i := range abiFName {
+		if name == abiFName[i] || name == fmt.Sprintf("f%d", i) {
+			return uint(i), nil
+		}
+	}
+	return 0, fmt.Errorf("no register \"%s\"", name)
+}
+
+// FprHelp is help for the fpr command.
+var FprHelp = []cli.Help{
+	{"<cr>", "display all registers"},
+	{"<reg> <value>", "write a register"},
+	{"  reg", "register name (f0..f31 or abi name)"},
+	{"  value", "register value (hex) or floating point value (1.5, -2.0e3, inf)"},
+	{"", "  an \"f\" suffix (1.5f) is a single precision value"},
+}
+
+// CmdFpr displays and writes the floating point registers.
 var CmdFpr = cli.Leaf{
-	Descr: "display floating point registers",
+	Descr: "display/write floating point registers",
 	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 2})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
 		dbg := c.User.(target).GetRiscvDebug()
 		hi := dbg.GetCurrentHart()
-		err := dbg.HaltHart()
+		if hi.FLEN == 0 {
+			c.User.Put(fmt.Sprintf("hart%d has no floating point registers\n", hi.ID))
+			return
+		}
+		if len(args) == 2 {
+			name := strings.ToLower(args[0])
+			reg, err := fprIndex(name)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			val, ok, err := floatArg(args[1], hi.FLEN)
+			if !ok {
+				var x uint
+				x, err = hexArg(args[1], util.Mask(hi.FLEN-1, 0))
+				val = uint64(x)
+			}
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+				return dbg.WrFPR(reg, 0, val)
+			})
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to write %s: %v\n", name, err))
+			}
+			return
+		}
+		err = dbg.HaltHart()
 		if err != nil {
 			c.User.Put(fmt.Sprintf("unable to halt hart%d: %v\n", hi.ID, err))
 			return
@@ -204,40 +391,158 @@ var CmdFpr = cli.Leaf{
 			}
 		}
 		c.User.Put(fmt.Sprintf("%s\n", fprString(reg, hi.FLEN)))
+		// decode fcsr
+		fcsr, err := dbg.RdCSR(rv.FCSR, 0)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("unable to read fcsr: %v\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", fcsrString(uint(fcsr))))
+	},
+}
+
+//-----------------------------------------------------------------------------
+// program counter
+
+// pcWrite sets the pc of the current hart.
+func pcWrite(c *cli.CLI, arg string) {
+	dbg := c.User.(target).GetRiscvDebug()
+	pc, err := hexArg(arg, util.Mask(dbg.GetAddressSize()-1, 0))
+	if err != nil {
+		c.User.Put(fmt.Sprintf("%s\n", err))
+		return
+	}
+	err = checkInsAlign(dbg, pc)
+	if err != nil {
+		c.User.Put(fmt.Sprintf("%s\n", err))
+		return
+	}
+	var s string
+	err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+		err := dbg.WrCSR(rv.DPC, 0, uint64(pc))
+		if err != nil {
+			return err
+		}
+		s = pcString(dbg)
+		return nil
+	})
+	if err != nil {
+		c.User.Put(fmt.Sprintf("unable to write pc: %v\n", err))
+		return
+	}
+	c.User.Put(fmt.Sprintf("%s\n", s))
+}
+
+// PcHelp is help for the pc command.
+var PcHelp = []cli.Help{
+	{"<cr>", "display the pc"},
+	{"<addr>", "set the pc, address (hex)"},
+}
+
+// CmdPc displays and sets the program counter.
+var CmdPc = cli.Leaf{
+	Descr: "display/set the program counter",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		if len(args) == 1 {
+			pcWrite(c, args[0])
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		var s string
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			s = pcString(dbg)
+			return nil
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", s))
 	},
 }
 
 //-----------------------------------------------------------------------------
 
+// HaltHelp is help for the halt command.
+var HaltHelp = []cli.Help{
+	{"<cr>", "halt the current hart"},
+	{"all", "halt all harts"},
+}
+
 // CmdHalt halts the current hart.
 var CmdHalt = cli.Leaf{
 	Descr: "halt the current hart",
 	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
 		dbg := c.User.(target).GetRiscvDebug()
+		if len(args) == 1 {
+			if args[0] != "all" {
+				c.User.Put(fmt.Sprintf("unknown argument \"%s\"\n", args[0]))
+				return
+			}
+			err := dbg.HaltAll()
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to halt all harts: %v\n", err))
+			}
+			putHartTable(c, dbg)
+			return
+		}
 		hi := dbg.GetCurrentHart()
 		if hi.State == rv.Halted {
 			c.User.Put(fmt.Sprintf("hart%d already halted\n", hi.ID))
 			return
 		}
-		err := dbg.HaltHart()
+		err = dbg.HaltHart()
 		if err != nil {
 			c.User.Put(fmt.Sprintf("unable to halt hart%d: %v\n", hi.ID, err))
 			return
 		}
+		c.User.Put(fmt.Sprintf("%s\n", haltString(dbg)))
 	},
 }
 
+// ResumeHelp is help for the resume command.
+var ResumeHelp = []cli.Help{
+	{"<cr>", "resume the current hart"},
+	{"all", "resume all harts"},
+}
+
 // CmdResume resumes the current hart.
 var CmdResume = cli.Leaf{
 	Descr: "resume the current hart",
 	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
 		dbg := c.User.(target).GetRiscvDebug()
+		if len(args) == 1 {
+			if args[0] != "all" {
+				c.User.Put(fmt.Sprintf("unknown argument \"%s\"\n", args[0]))
+				return
+			}
+			err := rv.ResumeAll(dbg)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to resume all harts: %v\n", err))
+			}
+			return
+		}
 		hi := dbg.GetCurrentHart()
 		if hi.State == rv.Running {
 			c.User.Put(fmt.Sprintf("hart%d already running\n", hi.ID))
 			return
 		}
-		err := dbg.ResumeHart()
+		err = hi.GetBreakpoints().Resume(dbg)
 		if err != nil {
 			c.User.Put(fmt.Sprintf("unable to resume hart%d: %v\n", hi.ID, err))
 			return
@@ -247,6 +552,100 @@ var CmdResume = cli.Leaf{
 
 //-----------------------------------------------------------------------------
 
+// ResetHelp is help for the reset command.
+var ResetHelp = []cli.Help{
+	{"<cr>", "reset and run"},
+	{"run", "reset and run"},
+	{"halt", "reset and halt at the reset vector"},
+	{"init", "reset, halt and run the target initialization (if any)"},
+	{"hart", "reset and halt the current hart"},
+}
+
+// resetInit is implemented by targets that need setup after a reset.
+type resetInit interface {
+	ResetInit() error
+}
+
+// CmdReset resets the system.
+var CmdReset = cli.Leaf{
+	Descr: "reset the system",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		mode := "run"
+		if len(args) == 1 {
+			mode = args[0]
+		}
+		if mode != "run" && mode != "halt" && mode != "init" && mode != "hart" {
+			c.User.Put(fmt.Sprintf("unknown reset mode \"%s\"\n", mode))
+			return
+		}
+		ri, hasInit := c.User.(resetInit)
+		if mode == "init" && !hasInit {
+			c.User.Put("the target has no reset initialization, use \"reset halt\"\n")
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		if mode == "hart" {
+			hi := dbg.GetCurrentHart()
+			err := dbg.ResetHart()
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to reset hart%d: %v\n", hi.ID, err))
+				return
+			}
+			// The reset cleared the breakpoints of the halted hart(s).
+			// The system is reset if the hart can't be reset on its own.
+			err = rv.AllHarts(dbg, func() error {
+				hi := dbg.GetCurrentHart()
+				if hi.State != rv.Halted {
+					return nil
+				}
+				return hi.GetBreakpoints().Reinsert(dbg)
+			})
+			if err == nil {
+				err = c.User.(target).GetSemihost().Reset(dbg)
+			}
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+			}
+			putHartTable(c, dbg)
+			return
+		}
+		err = dbg.ResetHalt()
+		if err != nil {
+			c.User.Put(fmt.Sprintf("unable to reset: %v\n", err))
+			return
+		}
+		// the reset cleared the breakpoints
+		err = rv.AllHarts(dbg, func() error {
+			return dbg.GetCurrentHart().GetBreakpoints().Reinsert(dbg)
+		})
+		if err == nil {
+			err = c.User.(target).GetSemihost().Reset(dbg)
+		}
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+		switch mode {
+		case "run":
+			err := rv.ResumeAll(dbg)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to resume all harts: %v\n", err))
+			}
+			return
+		case "init":
+			err := ri.ResetInit()
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to initialize target: %v\n", err))
+			}
+		}
+		putHartTable(c, dbg)
+	},
+}
+
 // HartHelp is help for the hart command.
 var HartHelp = []cli.Help{
 	{"<cr>", "display info for current hart"},
@@ -256,16 +655,77 @@ var HartHelp = []cli.Help{
 var CmdHart = cli.Leaf{
 	Descr: "hart info/select",
 	F: func(c *cli.CLI, args []string) {
-		dbg := c.User.(target).GetRiscvDebug()
-		hi := dbg.GetCurrentHart()
-		if len(args) == 0 {
-			c.User.Put(fmt.Sprintf("%s\n", hi))
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
 			return
 		}
-		// TODO
+		dbg := c.User.(target).GetRiscvDebug()
+		if len(args) == 1 {
+			id, err := cli.IntArg(args[0], [2]int{0, dbg.GetHartCount() - 1}, 10)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			_, err = dbg.SetCurrentHart(id)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to select hart%d: %v\n", id, err))
+				return
+			}
+			_, err = dbg.GetHartState()
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to get hart%d state: %v\n", id, err))
+			}
+		}
+		c.User.Put(fmt.Sprintf("%s\n", dbg.GetCurrentHart()))
 	},
 }
 
+// putHartTable displays the hart table.
+func putHartTable(c *cli.CLI, dbg rv.Debug) {
+	s, err := hartTable(dbg)
+	c.User.Put(fmt.Sprintf("%s\n", s))
+	if err != nil {
+		c.User.Put(fmt.Sprintf("%s\n", err))
+	}
+}
+
+// hartTable returns a table with the state, pc and halt cause of each hart.
+func hartTable(dbg rv.Debug) (string, error) {
+	cur := dbg.GetCurrentHart().ID
+	s := [][]string{}
+	s = append(s, []string{"", "hart", "state", "pc", "cause"})
+	for id := 0; id < dbg.GetHartCount(); id++ {
+		mark := []string{"", "*"}[util.BoolToInt(id == cur)]
+		_, err := dbg.SetCurrentHart(id)
+		if err != nil {
+			s = append(s, []string{mark, fmt.Sprintf("%d", id), err.Error(), "", ""})
+			continue
+		}
+		state, err := dbg.GetHartState()
+		if err != nil {
+			s = append(s, []string{mark, fmt.Sprintf("%d", id), err.Error(), "", ""})
+			continue
+		}
+		pc, cause := "", ""
+		if state == rv.Halted {
+			hc, x, err := rv.GetHaltInfo(dbg)
+			if err != nil {
+				pc = err.Error()
+			} else {
+				pc, cause = fmt.Sprintf("0x%x", x), hc.String()
+			}
+		}
+		s = append(s, []string{mark, fmt.Sprintf("%d", id), state.String(), pc, cause})
+	}
+	table := cli.TableString(s, []int{0, 0, 0, 0, 0}, 1)
+	_, err := dbg.SetCurrentHart(cur)
+	if err != nil {
+		return table, fmt.Errorf("unable to select hart%d: %v", cur, err)
+	}
+	return table, nil
+}
+
 //-----------------------------------------------------------------------------
 
 var DisassembleHelp = []cli.Help{
@@ -277,6 +737,23 @@ var DisassembleHelp = []cli.Help{
 
 const defSize = 0x80
 
+// checkInsAlign checks the alignment of an instruction address.
+func checkInsAlign(dbg rv.Debug, addr uint) error {
+	misa := dbg.GetCurrentHart().MISA
+	if rv.CheckExtMISA(misa, 'c') {
+		// 16-bit alignment
+		if addr&1 != 0 {
+			return errors.New("instruction address is not 16-bit aligned")
+		}
+	} else {
+		// 32-bit alignment
+		if addr&3 != 0 {
+			return errors.New("instruction address is not 32-bit aligned")
+		}
+	}
+	return nil
+}
+
 // disassembleArg converts disassemble arguments to an (address, n) tuple.
 func disassembleArg(dbg rv.Debug, args []string) (uint, int, error) {
 
@@ -302,17 +779,9 @@ func disassembleArg(dbg rv.Debug, args []string) (uint, int, error) {
 	}
 
 	// check address alignment
-	misa := dbg.GetCurrentHart().MISA
-	if rv.CheckExtMISA(misa, 'c') {
-		// 16-bit alignment
-		if addr&1 != 0 {
-			return 0, 0, errors.New("instruction address is not 16-bit aligned")
-		}
-	} else {
-		// 32-bit alignment
-		if addr&3 != 0 {
-			return 0, 0, errors.New("instruction address is not 32-bit aligned")
-		}
+	err = checkInsAlign(dbg, addr)
+	if err != nil {
+		return 0, 0, err
 	}
 
 	if len(args) == 1 {
@@ -342,15 +811,13 @@ var CmdDisassemble = cli.Leaf{
 		}
 		// disassemble
 		for n >= 0 {
-			// For a compressed instruction stream we may be reading 32-bit
-			// values with 16-bit alignment. Some chips don't allow this for
-			// data read access, so we always read 2 x 16-bit values.
-			ins, err := dbg.RdMem(16, addr, 2)
+			// read the instruction, hiding any software breakpoints
+			ins, err := hi.GetBreakpoints().RdIns(dbg, addr)
 			if err != nil {
 				c.User.Put(fmt.Sprintf("unable to read memory at %x\n", addr))
 				return
 			}
-			da := hi.ISA.Disassemble(addr, (ins[1]<<16)|ins[0])
+			da := hi.ISA.Disassemble(addr, ins)
 			c.User.Put(fmt.Sprintf("%s\n", da))
 			addr += da.InsLength
 			n -= int(da.InsLength)
@@ -358,6 +825,377 @@ var CmdDisassemble = cli.Leaf{
 	},
 }
 
+//-----------------------------------------------------------------------------
+// breakpoints and watchpoints
+
+// haltedOp runs a function with the current hart halted.
+func haltedOp(dbg rv.Debug, f func(hi *rv.HartInfo) error) error {
+	hi := dbg.GetCurrentHart()
+	wasRunning := hi.State == rv.Running
+	err := dbg.HaltHart()
+	if err != nil {
+		return fmt.Errorf("unable to halt hart%d: %v", hi.ID, err)
+	}
+	err = f(hi)
+	if wasRunning {
+		rerr := hi.GetBreakpoints().Resume(dbg)
+		if rerr != nil && err == nil {
+			err = fmt.Errorf("unable to resume hart%d: %v", hi.ID, rerr)
+		}
+	}
+	return err
+}
+
+// addBreakpoint adds a breakpoint/watchpoint to the current hart.
+func addBreakpoint(c *cli.CLI, args []string, bt rv.BreakType, mode rv.BreakMode) {
+	dbg := c.User.(target).GetRiscvDebug()
+	maxAddr := uint((1 << dbg.GetAddressSize()) - 1)
+	addr, err := cli.UintArg(args[0], [2]uint{0, maxAddr}, 16)
+	if err != nil {
+		c.User.Put(fmt.Sprintf("%s\n", err))
+		return
+	}
+	if bt == rv.BreakExecute {
+		err := checkInsAlign(dbg, addr)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+	}
+	err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+		bp, err := hi.GetBreakpoints().Add(dbg, bt, addr, mode)
+		if err != nil {
+			return err
+		}
+		c.User.Put(fmt.Sprintf("%s breakpoint %d at 0x%x (%s)\n", bt, bp.ID, bp.Addr, bp.Where()))
+		return nil
+	})
+	if err != nil {
+		c.User.Put(fmt.Sprintf("%s\n", err))
+	}
+}
+
+// BreakHelp is help for the break command.
+var BreakHelp = []cli.Help{
+	{"<addr> [mode]", "set a breakpoint"},
+	{"  addr", "instruction address (hex)"},
+	{"  mode", "hw (trigger) or sw (ebreak), default is hw if a trigger is free"},
+}
+
+// CmdBreak sets an instruction breakpoint.
+var CmdBreak = cli.Leaf{
+	Descr: "set a breakpoint",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1, 2})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		mode := rv.BreakAuto
+		if len(args) == 2 {
+			switch args[1] {
+			case "hw":
+				mode = rv.BreakHardware
+			case "sw":
+				mode = rv.BreakSoftware
+			default:
+				c.User.Put(fmt.Sprintf("unknown breakpoint mode \"%s\"\n", args[1]))
+				return
+			}
+		}
+		addBreakpoint(c, args, rv.BreakExecute, mode)
+	},
+}
+
+// WatchHelp is help for the watch/rwatch commands.
+var WatchHelp = []cli.Help{
+	{"<addr>", "data address (hex)"},
+}
+
+// CmdWatch sets a store watchpoint.
+var CmdWatch = cli.Leaf{
+	Descr: "set a watchpoint (break on store)",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		addBreakpoint(c, args, rv.BreakStore, rv.BreakHardware)
+	},
+}
+
+// CmdRwatch sets a load watchpoint.
+var CmdRwatch = cli.Leaf{
+	Descr: "set a read watchpoint (break on load)",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		addBreakpoint(c, args, rv.BreakLoad, rv.BreakHardware)
+	},
+}
+
+// DeleteHelp is help for the delete command.
+var DeleteHelp = []cli.Help{
+	{"<cr>", "delete all breakpoints"},
+	{"<id>", "delete breakpoint <id>"},
+}
+
+// CmdDelete deletes breakpoints/watchpoints.
+var CmdDelete = cli.Leaf{
+	Descr: "delete breakpoints",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		id := -1
+		if len(args) == 1 {
+			id, err = cli.IntArg(args[0], [2]int{1, 1 << 16}, 10)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			if id < 0 {
+				return hi.GetBreakpoints().RemoveAll(dbg)
+			}
+			return hi.GetBreakpoints().Remove(dbg, id)
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+	},
+}
+
+var cmdInfoBreak = cli.Leaf{
+	Descr: "display breakpoints and watchpoints",
+	F: func(c *cli.CLI, args []string) {
+		dbg := c.User.(target).GetRiscvDebug()
+		hi := dbg.GetCurrentHart()
+		c.User.Put(fmt.Sprintf("%s\n", hi.GetBreakpoints()))
+	},
+}
+
+var cmdInfoHarts = cli.Leaf{
+	Descr: "display the state of all harts",
+	F: func(c *cli.CLI, args []string) {
+		dbg := c.User.(target).GetRiscvDebug()
+		putHartTable(c, dbg)
+	},
+}
+
+// InfoMenu submenu items
+var InfoMenu = cli.Menu{
+	{"break", cmdInfoBreak},
+	{"harts", cmdInfoHarts},
+}
+
+//-----------------------------------------------------------------------------
+// single stepping
+
+// stepInterrupts enables interrupts while single stepping (dcsr.stepie).
+var stepInterrupts bool
+
+// pcString returns the disassembled instruction at the pc.
+func pcString(dbg rv.Debug) string {
+	hi := dbg.GetCurrentHart()
+	pc, err := dbg.RdCSR(rv.DPC, 0)
+	if err != nil {
+		return fmt.Sprintf("unable to read pc: %v", err)
+	}
+	ins, err := hi.GetBreakpoints().RdIns(dbg, uint(pc))
+	if err != nil {
+		return fmt.Sprintf("unable to read memory at %x", pc)
+	}
+	return fmt.Sprintf("%s", hi.ISA.Disassemble(uint(pc), ins))
+}
+
+// stepHart single steps the current hart n times.
+func stepHart(c *cli.CLI, n int) {
+	dbg := c.User.(target).GetRiscvDebug()
+	hi := dbg.GetCurrentHart()
+	if hi.State != rv.Halted {
+		c.User.Put(fmt.Sprintf("hart%d is not halted\n", hi.ID))
+		return
+	}
+	for i := 0; i < n; i++ {
+		err := hi.GetBreakpoints().Step(dbg, stepInterrupts)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("unable to step hart%d: %v\n", hi.ID, err))
+			return
+		}
+	}
+	c.User.Put(fmt.Sprintf("%s\n", pcString(dbg)))
+}
+
+// CmdStep single steps the current hart.
+var CmdStep = cli.Leaf{
+	Descr: "step one instruction",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		stepHart(c, 1)
+	},
+}
+
+// StepiHelp is help for the stepi command.
+var StepiHelp = []cli.Help{
+	{"[n]", "number of instructions (decimal), default is 1"},
+}
+
+// CmdStepi single steps the current hart n times.
+var CmdStepi = cli.Leaf{
+	Descr: "step n instructions",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		n := 1
+		if len(args) == 1 {
+			n, err = cli.IntArg(args[0], [2]int{1, 1 << 20}, 10)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+		}
+		stepHart(c, n)
+	},
+}
+
+const nextPoll = 5 * time.Millisecond
+
+// CmdNext steps the current hart over calls.
+var CmdNext = cli.Leaf{
+	Descr: "step one instruction, stepping over calls",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		hi := dbg.GetCurrentHart()
+		if hi.State != rv.Halted {
+			c.User.Put(fmt.Sprintf("hart%d is not halted\n", hi.ID))
+			return
+		}
+		b := hi.GetBreakpoints()
+		ret, call, err := b.CallReturn(dbg)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		if !call {
+			stepHart(c, 1)
+			return
+		}
+		// the stack pointer distinguishes a recursive return
+		sp, err := dbg.RdGPR(rv.RegSp, 0)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("unable to read sp: %v\n", err))
+			return
+		}
+		// set a temporary breakpoint at the return address
+		var tmp *rv.Breakpoint
+		if b.AtAddr(ret) == nil {
+			tmp, err = b.Add(dbg, rv.BreakExecute, ret, rv.BreakAuto)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+		}
+		// run until we halt
+		err = b.Resume(dbg)
+		if err == nil {
+			c.User.Put("running (ctrl-d to halt)\n")
+			done := c.Loop(func() bool {
+				var state rv.HartState
+				state, err = dbg.GetHartState()
+				if err != nil {
+					return true
+				}
+				if state != rv.Halted {
+					time.Sleep(nextPoll)
+					return false
+				}
+				// keep going after a semihosting request
+				if semihostResume(dbg, c.User) {
+					return false
+				}
+				// keep going if this is the return from a deeper frame
+				var pc, newsp uint64
+				pc, err = dbg.RdCSR(rv.DPC, 0)
+				if err == nil {
+					newsp, err = dbg.RdGPR(rv.RegSp, 0)
+				}
+				if err == nil && uint(pc) == ret && newsp < sp {
+					err = b.Resume(dbg)
+					return err != nil
+				}
+				return true
+			}, cli.KeycodeCtrlD)
+			if !done {
+				err = dbg.HaltHart()
+			}
+		}
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+		// remove the temporary breakpoint
+		if tmp != nil && hi.State == rv.Halted {
+			err := b.Remove(dbg, tmp.ID)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+			}
+		}
+		c.User.Put(fmt.Sprintf("%s\n", pcString(dbg)))
+	},
+}
+
+// StepieHelp is help for the stepie command.
+var StepieHelp = []cli.Help{
+	{"<cr>", "display the current setting"},
+	{"on", "enable interrupts while stepping"},
+	{"off", "mask interrupts while stepping (default)"},
+}
+
+// CmdStepie sets the dcsr.stepie mode for single stepping.
+var CmdStepie = cli.Leaf{
+	Descr: "interrupts while stepping",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		if len(args) == 1 {
+			switch args[0] {
+			case "on":
+				stepInterrupts = true
+			case "off":
+				stepInterrupts = false
+			default:
+				c.User.Put(fmt.Sprintf("unknown argument \"%s\"\n", args[0]))
+				return
+			}
+		}
+		state := []string{"masked", "enabled"}[util.BoolToInt(stepInterrupts)]
+		c.User.Put(fmt.Sprintf("interrupts are %s while stepping\n", state))
+	},
+}
+
 //-----------------------------------------------------------------------------
 
 var cmdRiscvTest1 = cli.Leaf{
@@ -0,0 +1,345 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Hart Context Snapshots
+
+Save the GPRs, FPRs, PC and readable CSRs of the current hart to a JSON
+file, write them back, or compare them with the live hart state.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+)
+
+//-----------------------------------------------------------------------------
+
+const contextVersion = 1
+
+// hartContext is a snapshot of the hart state.
+// Register values are hex strings to keep the file readable.
+type hartContext struct {
+	Version int               `json:"version"`
+	Hart    int               `json:"hart"`
+	MXLEN   uint              `json:"mxlen"`
+	FLEN    uint              `json:"flen"`
+	PC      string            `json:"pc"`
+	GPR     []string          `json:"gpr"`
+	FPR     []string          `json:"fpr,omitempty"`
+	CSR     map[string]string `json:"csr"`
+}
+
+func ctxHex(x uint64) string {
+	return fmt.Sprintf("0x%x", x)
+}
+
+func ctxValue(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+// csrRestore returns true if a CSR should be written back on a restore.
+func csrRestore(reg uint) bool {
+	// read-only
+	if reg>>10 == 3 {
+		return false
+	}
+	// trigger and debug registers belong to the debugger (dpc is the pc)
+	if reg >= rv.TSELECT && reg <= 0x7bf {
+		return false
+	}
+	return true
+}
+
+// csrCounter returns true if a CSR is a counter (these change as the hart runs).
+func csrCounter(reg uint) bool {
+	return (reg >= 0xb00 && reg <= 0xb9f) || (reg >= 0xc00 && reg <= 0xc9f)
+}
+
+// csrItem is a CSR name and register number.
+type csrItem struct {
+	name string
+	reg  uint
+}
+
+// csrList returns the CSRs of the current hart sorted by register number.
+func csrList(hi *rv.HartInfo) []*csrItem {
+	x := []*csrItem{}
+	if hi.CSR == nil {
+		return x
+	}
+	p, err := hi.CSR.GetPeripheral("CSR")
+	if err != nil {
+		return x
+	}
+	for _, r := range p.Registers {
+		if rv.GetCSRSize(r.Offset, hi) != 0 {
+			x = append(x, &csrItem{r.Name, r.Offset})
+		}
+	}
+	sort.Slice(x, func(i, j int) bool { return x[i].reg < x[j].reg })
+	return x
+}
+
+//-----------------------------------------------------------------------------
+
+// contextRead reads the context of the current hart.
+func contextRead(dbg rv.Debug, hi *rv.HartInfo) (*hartContext, error) {
+	ctx := &hartContext{
+		Version: contextVersion,
+		Hart:    hi.ID,
+		MXLEN:   hi.MXLEN,
+		FLEN:    hi.FLEN,
+		CSR:     map[string]string{},
+	}
+	pc, err := dbg.RdCSR(rv.DPC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read pc: %v", err)
+	}
+	ctx.PC = ctxHex(pc)
+	for i := 0; i < hi.Nregs; i++ {
+		x, err := dbg.RdGPR(uint(i), 0)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read gpr%d: %v", i, err)
+		}
+		ctx.GPR = append(ctx.GPR, ctxHex(x))
+	}
+	if hi.FLEN != 0 {
+		for i := 0; i < 32; i++ {
+			x, err := dbg.RdFPR(uint(i), 0)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read fpr%d: %v", i, err)
+			}
+			ctx.FPR = append(ctx.FPR, ctxHex(x))
+		}
+	}
+	for _, r := range csrList(hi) {
+		if r.reg == rv.DPC {
+			continue
+		}
+		x, err := dbg.RdCSR(r.reg, 0)
+		if err != nil {
+			// not implemented, or not readable
+			continue
+		}
+		ctx.CSR[r.name] = ctxHex(x)
+	}
+	return ctx, nil
+}
+
+// contextWrite writes a context to the current hart.
+// Errors for individual CSRs are returned as warnings.
+func contextWrite(dbg rv.Debug, hi *rv.HartInfo, ctx *hartContext) ([]string, error) {
+	if ctx.MXLEN != hi.MXLEN || ctx.FLEN != hi.FLEN || len(ctx.GPR) != hi.Nregs {
+		return nil, errors.New("the snapshot does not match the hart (mxlen, flen or register count)")
+	}
+	warn := []string{}
+	// CSRs first, mstatus can change the access to the FPRs
+	for _, r := range csrList(hi) {
+		s, ok := ctx.CSR[r.name]
+		if !ok || !csrRestore(r.reg) {
+			continue
+		}
+		x, err := ctxValue(s)
+		if err == nil {
+			err = dbg.WrCSR(r.reg, 0, x)
+		}
+		if err != nil {
+			warn = append(warn, fmt.Sprintf("unable to write %s: %v", r.name, err))
+		}
+	}
+	for i, s := range ctx.FPR {
+		x, err := ctxValue(s)
+		if err == nil {
+			err = dbg.WrFPR(uint(i), 0, x)
+		}
+		if err != nil {
+			return warn, fmt.Errorf("unable to write fpr%d: %v", i, err)
+		}
+	}
+	for i := 1; i < len(ctx.GPR); i++ {
+		x, err := ctxValue(ctx.GPR[i])
+		if err == nil {
+			err = dbg.WrGPR(uint(i), 0, x)
+		}
+		if err != nil {
+			return warn, fmt.Errorf("unable to write gpr%d: %v", i, err)
+		}
+	}
+	pc, err := ctxValue(ctx.PC)
+	if err == nil {
+		err = dbg.WrCSR(rv.DPC, 0, pc)
+	}
+	if err != nil {
+		return warn, fmt.Errorf("unable to write pc: %v", err)
+	}
+	return warn, nil
+}
+
+// contextDiff returns a table of the differences between two contexts.
+// Counter CSRs are not compared.
+func contextDiff(hi *rv.HartInfo, snap, live *hartContext) string {
+	s := [][]string{{"register", "snapshot", "live"}}
+	cmp := func(name, a, b string) {
+		if a != b {
+			s = append(s, []string{name, a, b})
+		}
+	}
+	cmp("pc", snap.PC, live.PC)
+	for i := range live.GPR {
+		if i < len(snap.GPR) {
+			cmp(abiXName[i], snap.GPR[i], live.GPR[i])
+		}
+	}
+	for i := range live.FPR {
+		if i < len(snap.FPR) {
+			cmp(abiFName[i], snap.FPR[i], live.FPR[i])
+		}
+	}
+	for _, r := range csrList(hi) {
+		if csrCounter(r.reg) {
+			continue
+		}
+		a, aok := snap.CSR[r.name]
+		b, bok := live.CSR[r.name]
+		if aok || bok {
+			cmp(r.name, a, b)
+		}
+	}
+	if len(s) == 1 {
+		return "no differences"
+	}
+	return cli.TableString(s, []int{0, 0, 0}, 1)
+}
+
+//-----------------------------------------------------------------------------
+
+// contextLoad reads a context snapshot file.
+func contextLoad(name string) (*hartContext, error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ctx := &hartContext{}
+	err = json.Unmarshal(buf, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if ctx.Version != contextVersion {
+		return nil, fmt.Errorf("%s: unsupported version %d", name, ctx.Version)
+	}
+	return ctx, nil
+}
+
+var contextFileHelp = []cli.Help{
+	{"<file>", "snapshot file name"},
+}
+
+var cmdContextSave = cli.Leaf{
+	Descr: "save the hart context to a file",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		var ctx *hartContext
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			var err error
+			ctx, err = contextRead(dbg, hi)
+			return err
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		buf, err := json.MarshalIndent(ctx, "", "  ")
+		if err == nil {
+			err = os.WriteFile(args[0], append(buf, '\n'), 0644)
+		}
+		if err != nil {
+			c.User.Put(fmt.Sprintf("unable to write context: %v\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("hart%d context (%d gprs, %d fprs, %d csrs) written to %s\n", ctx.Hart, len(ctx.GPR), len(ctx.FPR), len(ctx.CSR), args[0]))
+	},
+}
+
+var cmdContextRestore = cli.Leaf{
+	Descr: "restore the hart context from a file",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		ctx, err := contextLoad(args[0])
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			warn, err := contextWrite(dbg, hi, ctx)
+			for _, s := range warn {
+				c.User.Put(fmt.Sprintf("%s\n", s))
+			}
+			return err
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+	},
+}
+
+var cmdContextDiff = cli.Leaf{
+	Descr: "compare the hart context with a file",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		snap, err := contextLoad(args[0])
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		var s string
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			live, err := contextRead(dbg, hi)
+			if err != nil {
+				return err
+			}
+			s = contextDiff(hi, snap, live)
+			return nil
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", s))
+	},
+}
+
+// ContextMenu submenu items
+var ContextMenu = cli.Menu{
+	{"diff", cmdContextDiff, contextFileHelp},
+	{"restore", cmdContextRestore, contextFileHelp},
+	{"save", cmdContextSave, contextFileHelp},
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,140 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Floating Point Values
+
+Convert floating point register values to and from IEEE 754 half, single and
+double precision values. Narrower values are NaN-boxed in wider registers.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// halfFloat converts an IEEE 754 half precision value to a float64.
+func halfFloat(x uint16) float64 {
+	exp := int(x>>10) & 0x1f
+	man := float64(x & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		// zero or subnormal
+		f = math.Ldexp(man, -24)
+	case 0x1f:
+		if man == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(man+1024, exp-25)
+	}
+	if x&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// isBoxed returns true if the upper bits of a FLEN-bit register NaN-box an n-bit value.
+func isBoxed(x uint64, n, flen uint) bool {
+	if n >= flen {
+		return true
+	}
+	return x>>n == uint64(util.Mask(flen-n-1, 0))
+}
+
+// fprValues returns the double, single and half precision strings for a FPR.
+// Values that are not NaN-boxed are displayed as "-".
+func fprValues(x uint64, flen uint) []string {
+	s := []string{}
+	if flen == 64 {
+		s = append(s, strconv.FormatFloat(math.Float64frombits(x), 'g', -1, 64))
+	}
+	v := "-"
+	if isBoxed(x, 32, flen) {
+		v = strconv.FormatFloat(float64(math.Float32frombits(uint32(x))), 'g', -1, 32)
+	}
+	s = append(s, v)
+	v = "-"
+	if isBoxed(x, 16, flen) {
+		v = strconv.FormatFloat(halfFloat(uint16(x)), 'g', 5, 64)
+	}
+	return append(s, v)
+}
+
+// canonical NaN values
+const canonicalNaN32 = 0x7fc00000
+const canonicalNaN64 = 0x7ff8000000000000
+
+// floatArg converts a floating point literal to a FPR value.
+// A literal has a decimal point (or is inf/nan). An "f" suffix selects single
+// precision on a FLEN=64 hart, the value is NaN-boxed.
+// ok is false if the argument is not a floating point literal.
+func floatArg(arg string, flen uint) (val uint64, ok bool, err error) {
+	s := strings.ToLower(arg)
+	single := flen == 32
+	switch strings.TrimLeft(s, "+-") {
+	case "inf", "nan":
+	default:
+		if !strings.Contains(s, ".") {
+			return 0, false, nil
+		}
+		if strings.HasSuffix(s, "f") {
+			single = true
+			s = strings.TrimSuffix(s, "f")
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("\"%s\" is not a floating point value", arg)
+	}
+	if single {
+		val = uint64(math.Float32bits(float32(f)))
+		if math.IsNaN(f) {
+			val = canonicalNaN32
+		}
+		if flen == 64 {
+			val |= 0xffffffff << 32
+		}
+		return val, true, nil
+	}
+	if math.IsNaN(f) {
+		return canonicalNaN64, true, nil
+	}
+	return math.Float64bits(f), true, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// fcsrString returns a decode of the fcsr register.
+func fcsrString(fcsr uint) string {
+	flags := []string{}
+	for i := len(rv.FflagsName) - 1; i >= 0; i-- {
+		if fcsr&(1<<i) != 0 {
+			flags = append(flags, rv.FflagsName[i])
+		}
+	}
+	if len(flags) == 0 {
+		flags = append(flags, "none")
+	}
+	frm := util.Bits(fcsr, 7, 5)
+	name, ok := rv.FrmName[frm]
+	if !ok {
+		name = "?"
+	}
+	return fmt.Sprintf("fcsr 0x%02x frm %s(%d) fflags %s", fcsr&0xff, name, frm, strings.Join(flags, ","))
+}
+
+//-----------------------------------------------------------------------------
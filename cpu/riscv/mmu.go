@@ -0,0 +1,56 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Virtual Memory Menu Items
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"fmt"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// VtopHelp is help for the vtop command.
+var VtopHelp = []cli.Help{
+	{"<vaddr>", "virtual address (hex)"},
+}
+
+// CmdVtop translates a virtual address to a physical address.
+var CmdVtop = cli.Leaf{
+	Descr: "virtual to physical address translation",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		vaddr, err := hexArg(args[0], util.Mask64)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		var w *rv.Walk
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			var err error
+			w, err = rv.Translate(dbg, vaddr)
+			return err
+		})
+		if w != nil {
+			c.User.Put(fmt.Sprintf("%s\n", w))
+		}
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+		}
+	},
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,58 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V PMP Menu Items
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"fmt"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+)
+
+//-----------------------------------------------------------------------------
+
+// PmpHelp is help for the pmp command.
+var PmpHelp = []cli.Help{
+	{"<cr>", "display the enabled pmp entries"},
+	{"all", "display all implemented pmp entries"},
+}
+
+// CmdPmp displays the decoded PMP configuration.
+var CmdPmp = cli.Leaf{
+	Descr: "display physical memory protection",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		all := false
+		if len(args) == 1 {
+			if args[0] != "all" {
+				c.User.Put(fmt.Sprintf("unknown argument \"%s\"\n", args[0]))
+				return
+			}
+			all = true
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		var pmp []rv.PmpEntry
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			var err error
+			pmp, err = rv.GetPmp(dbg)
+			return err
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%d pmp entries\n%s\n", len(pmp), rv.PmpString(pmp, all)))
+	},
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,213 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Hart Poller
+
+The poller runs in the background and reports harts that halt without user
+input (breakpoints, triggers, etc.). The halt summary is read on each poll and
+a hart is only selected when it reports a new halt. The CLI leaf functions and
+the poller share a lock so debug transport operations are never interleaved.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/util/log"
+)
+
+//-----------------------------------------------------------------------------
+
+const pollInterval = 250 * time.Millisecond
+
+// Poller polls the hart state in the background.
+type Poller struct {
+	mu   sync.Mutex    // serializes debugger access
+	dbg  rv.Debug      // debugger
+	name string        // target name for the prompt
+	user cli.USER      // output notifications
+	quit chan struct{} // stop the poller
+	done chan struct{} // the poller has stopped
+}
+
+// NewPoller returns a hart poller.
+func NewPoller(dbg rv.Debug, name string, user cli.USER) *Poller {
+	return &Poller{
+		dbg:  dbg,
+		name: name,
+		user: user,
+	}
+}
+
+// GetPrompt returns the target prompt string.
+func (p *Poller) GetPrompt() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dbg.GetPrompt(p.name)
+}
+
+// Start starts the poller.
+func (p *Poller) Start() {
+	if p.quit != nil {
+		return
+	}
+	p.quit = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run()
+}
+
+// Stop stops the poller.
+func (p *Poller) Stop() {
+	if p.quit == nil {
+		return
+	}
+	close(p.quit)
+	<-p.done
+	p.quit = nil
+}
+
+func (p *Poller) run() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-time.After(pollInterval):
+			p.mu.Lock()
+			s := p.poll()
+			if s != "" {
+				// the user is probably at the prompt, so redisplay it
+				p.user.Put(fmt.Sprintf("\n%s\n%s", s, p.dbg.GetPrompt(p.name)))
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// poll checks all harts for a running to halted transition.
+func (p *Poller) poll() string {
+	// which harts are halted?
+	summary, err := p.dbg.HaltedHarts()
+	if err != nil {
+		log.Debug.Printf("poll: %v", err)
+		return ""
+	}
+	cur := p.dbg.GetCurrentHart().ID
+	s := []string{}
+	for id := 0; id < p.dbg.GetHartCount(); id++ {
+		hi, err := p.dbg.GetHartInfo(id)
+		if err != nil {
+			log.Debug.Printf("poll hart%d: %v", id, err)
+			continue
+		}
+		// only a new halt needs a closer look
+		prev := hi.State
+		if prev == rv.Halted || (summary != nil && !summary[id]) {
+			continue
+		}
+		_, err = p.dbg.SetCurrentHart(id)
+		if err != nil {
+			log.Debug.Printf("poll hart%d: %v", id, err)
+			continue
+		}
+		state, err := p.dbg.GetHartState()
+		if err != nil {
+			log.Debug.Printf("poll hart%d: %v", id, err)
+			continue
+		}
+		if prev != rv.Halted && state == rv.Halted {
+			if msg := p.semihost(); msg != "" {
+				s = append(s, msg)
+			}
+		}
+	}
+	if p.dbg.GetCurrentHart().ID != cur {
+		_, err := p.dbg.SetCurrentHart(cur)
+		if err != nil {
+			log.Debug.Printf("poll hart%d: %v", cur, err)
+		}
+	}
+	return strings.Join(s, "\n")
+}
+
+// semihost services semihosting requests for the current (halted) hart.
+// It returns a message for the user if the hart stays halted.
+func (p *Poller) semihost() string {
+	for i := 0; i < shMaxRequests; i++ {
+		if i != 0 {
+			// the hart has resumed, has it made another request?
+			state, err := p.dbg.GetHartState()
+			if err != nil {
+				log.Debug.Printf("poll hart%d: %v", p.dbg.GetCurrentHart().ID, err)
+				return ""
+			}
+			if state != rv.Halted {
+				return ""
+			}
+		}
+		ok, msg := semihostHalt(p.dbg, p.user)
+		if !ok {
+			return haltString(p.dbg)
+		}
+		if msg != "" {
+			return msg
+		}
+	}
+	// the hart is running, any further requests are serviced on the next poll
+	return ""
+}
+
+//-----------------------------------------------------------------------------
+
+// Wrap returns a copy of a menu with the leaf functions holding the poller lock.
+func (p *Poller) Wrap(menu cli.Menu) cli.Menu {
+	m := make(cli.Menu, len(menu))
+	for i, item := range menu {
+		x := make(cli.MenuItem, len(item))
+		copy(x, item)
+		switch v := x[1].(type) {
+		case cli.Leaf:
+			f := v.F
+			x[1] = cli.Leaf{
+				Descr: v.Descr,
+				F: func(c *cli.CLI, args []string) {
+					p.mu.Lock()
+					defer p.mu.Unlock()
+					f(c, args)
+				},
+			}
+		case cli.Menu:
+			x[1] = p.Wrap(v)
+		}
+		m[i] = x
+	}
+	return m
+}
+
+//-----------------------------------------------------------------------------
+
+// haltString returns a string describing why the current hart halted.
+func haltString(dbg rv.Debug) string {
+	hi := dbg.GetCurrentHart()
+	cause, pc, err := rv.GetHaltInfo(dbg)
+	if err != nil {
+		return fmt.Sprintf("hart%d halted: %v", hi.ID, err)
+	}
+	s := fmt.Sprintf("hart%d halted: %s at 0x%x", hi.ID, cause, pc)
+	if cause == rv.CauseEbreak || cause == rv.CauseTrigger {
+		if bp := hi.GetBreakpoints().AtAddr(pc); bp != nil {
+			s += fmt.Sprintf(" (breakpoint %d)", bp.ID)
+		}
+	}
+	return s
+}
+
+//-----------------------------------------------------------------------------
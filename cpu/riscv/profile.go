@@ -0,0 +1,198 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V PC Sampling Profiler
+
+The debug spec has no standard PC sampling register, so the PC of a running
+hart is sampled by halting it, reading dpc and resuming it. Profiling stops if
+the hart halts by itself (breakpoint, trigger, etc.). The samples are
+bucketed by function when a symbol table is loaded, or by address range
+otherwise. The samples can be saved in the folded stack format used by
+flamegraph.pl, inferno and speedscope.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/sym"
+)
+
+//-----------------------------------------------------------------------------
+
+// profileBucketSize is the address range size when there is no symbol for an address.
+const profileBucketSize = 256
+
+// profileMaxRows is the maximum number of rows in the hot-spot table.
+const profileMaxRows = 32
+
+// profileInterval is the time between samples.
+const profileInterval = 5 * time.Millisecond
+
+// profileBucket is a profile histogram bucket.
+type profileBucket struct {
+	name  string
+	count int
+}
+
+// samplePC halts the current hart, reads the pc and resumes the hart.
+// It returns false if the hart halted by itself, the hart is left halted.
+func samplePC(dbg rv.Debug, hi *rv.HartInfo) (uint, bool, error) {
+	state, err := dbg.GetHartState()
+	if err != nil {
+		return 0, false, err
+	}
+	if state != rv.Running {
+		return 0, false, nil
+	}
+	err = dbg.HaltHart()
+	if err != nil {
+		return 0, false, err
+	}
+	// the hart may have halted by itself before the halt request
+	cause, pc, err := rv.GetHaltInfo(dbg)
+	if err != nil {
+		return 0, false, err
+	}
+	if cause != rv.CauseHaltreq {
+		return 0, false, nil
+	}
+	return pc, true, hi.GetBreakpoints().Resume(dbg)
+}
+
+// profileName returns the bucket name for an address.
+func profileName(symbols *sym.Table, addr uint) string {
+	if s := symbols.Lookup(addr); s != nil {
+		return s.Name
+	}
+	base := addr & ^uint(profileBucketSize-1)
+	return fmt.Sprintf("0x%x-0x%x", base, base+profileBucketSize-1)
+}
+
+// profileTable returns the sorted hot-spot table for a set of samples.
+func profileTable(symbols *sym.Table, samples map[uint]int, total int) string {
+	hist := map[string]int{}
+	for pc, n := range samples {
+		hist[profileName(symbols, pc)] += n
+	}
+	buckets := make([]profileBucket, 0, len(hist))
+	for name, n := range hist {
+		buckets = append(buckets, profileBucket{name, n})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].count == buckets[j].count {
+			return buckets[i].name < buckets[j].name
+		}
+		return buckets[i].count > buckets[j].count
+	})
+	s := [][]string{{"samples", "%", "location"}}
+	for i, b := range buckets {
+		if i == profileMaxRows {
+			s = append(s, []string{"", "", fmt.Sprintf("(%d more)", len(buckets)-i)})
+			break
+		}
+		pct := 100.0 * float64(b.count) / float64(total)
+		s = append(s, []string{fmt.Sprintf("%d", b.count), fmt.Sprintf("%.1f", pct), b.name})
+	}
+	return cli.TableString(s, []int{0, 0, 0}, 1)
+}
+
+// profileWrite writes the samples to a file in folded stack format.
+// Each line is "<function>;<pc> <count>".
+func profileWrite(name string, symbols *sym.Table, samples map[uint]int) error {
+	pcs := make([]uint, 0, len(samples))
+	for pc := range samples {
+		pcs = append(pcs, pc)
+	}
+	sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+	s := []string{}
+	for _, pc := range pcs {
+		s = append(s, fmt.Sprintf("%s;0x%x %d", profileName(symbols, pc), pc, samples[pc]))
+	}
+	return os.WriteFile(name, []byte(strings.Join(s, "\n")+"\n"), 0644)
+}
+
+//-----------------------------------------------------------------------------
+
+// ProfileHelp is help for the profile command.
+var ProfileHelp = []cli.Help{
+	{"<seconds> [file]", "sample the pc of the running hart"},
+	{"  seconds", "profile duration (decimal)"},
+	{"  file", "save the samples in folded stack format"},
+}
+
+// CmdProfile samples the pc of the current hart.
+var CmdProfile = cli.Leaf{
+	Descr: "pc sampling profiler",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1, 2})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		secs, err := cli.UintArg(args[0], [2]uint{1, 3600}, 10)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		symbols := c.User.(target).GetSymbols()
+		hi := dbg.GetCurrentHart()
+		if hi.State != rv.Running {
+			c.User.Put(fmt.Sprintf("hart%d is not running\n", hi.ID))
+			return
+		}
+
+		samples := map[uint]int{}
+		total := 0
+		start := time.Now()
+		t := start.Add(time.Duration(secs) * time.Second)
+		c.User.Put("profiling (ctrl-d to stop)\n")
+		c.Loop(func() bool {
+			if !t.After(time.Now()) {
+				return true
+			}
+			pc, ok, err := samplePC(dbg, hi)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to sample hart%d pc: %v\n", hi.ID, err))
+				return true
+			}
+			if !ok {
+				// the hart halted by itself
+				c.User.Put(fmt.Sprintf("%s\n", haltString(dbg)))
+				return true
+			}
+			samples[pc]++
+			total++
+			time.Sleep(profileInterval)
+			return false
+		}, cli.KeycodeCtrlD)
+		elapsed := time.Since(start)
+
+		if total == 0 {
+			c.User.Put("no samples\n")
+			return
+		}
+		c.User.Put(fmt.Sprintf("%d samples in %.1fs (%.0f samples/s)\n", total, elapsed.Seconds(), float64(total)/elapsed.Seconds()))
+		c.User.Put(fmt.Sprintf("%s\n", profileTable(symbols, samples, total)))
+		if len(args) == 2 {
+			err := profileWrite(args[1], symbols, samples)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to write samples: %v\n", err))
+				return
+			}
+			c.User.Put(fmt.Sprintf("samples written to %s\n", args[1]))
+		}
+	},
+}
+
+//-----------------------------------------------------------------------------
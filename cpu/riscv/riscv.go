@@ -32,7 +32,8 @@ const drDtmLength = 32
 //-----------------------------------------------------------------------------
 
 // NewDebug returns a new RISC-V debugger interface.
-func NewDebug(dev *jtag.Device) (rv.Debug, error) {
+// csrExt returns the vendor specific CSRs for each hart (nil == none).
+func NewDebug(dev *jtag.Device, csrExt rv.CsrExtension) (rv.Debug, error) {
 
 	// check the IR length
 	if dev.GetIRLength() != irLength {
@@ -58,9 +59,9 @@ func NewDebug(dev *jtag.Device) (rv.Debug, error) {
 	version &= 15
 	switch version {
 	case 0:
-		return rv11.New(dev)
+		return rv11.New(dev, csrExt)
 	case 1:
-		return rv13.New(dev)
+		return rv13.New(dev, csrExt)
 	}
 
 	return nil, fmt.Errorf("unknown dtm version %d", version)
@@ -0,0 +1,1085 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Assembler
+
+Assemble RV32/RV64 IMAFDC, Zicsr and Zifencei instructions.
+
+* One instruction per line (or separated with ';').
+* Comments start with '#'.
+* Labels end with ':'.
+* The common pseudo-instructions are supported.
+* Compressed instructions are only used for explicit "c." mnemonics.
+* Expressions are sums/differences of numbers, labels, symbols, '.' (the current address) and %hi()/%lo().
+* Branch and jump targets are addresses, not offsets.
+* .half and .word emit data.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+
+// asmOp describes the encoding of an instruction.
+type asmOp struct {
+	args  string // operand types
+	match uint32 // fixed instruction bits
+	xlen  uint   // 64 == RV64 only, 32 == RV32 only, 0 == any
+}
+
+// Operand types:
+// d,s,t = integer rd, rs1, rs2
+// D,S,T,R = float rd, rs1, rs2, rs3
+// j = 12-bit signed immediate
+// o = load/jalr offset(rs1)
+// q = store offset(rs1)
+// A = amo address (rs1)
+// u = 20-bit upper immediate
+// a = jal target address
+// p = branch target address
+// > = shift amount (0..xlen-1)
+// < = shift amount (0..31)
+// E = csr
+// Z = 5-bit unsigned immediate
+// m = optional rounding mode (default dyn)
+// M = optional rounding mode (default rne, for exact conversions)
+// P,Q = fence predecessor/successor
+
+var asmOps = map[string]asmOp{
+	// RV32I
+	"lui":    {"d,u", 0x00000037, 0},
+	"auipc":  {"d,u", 0x00000017, 0},
+	"jal":    {"d,a", 0x0000006f, 0},
+	"jalr":   {"d,o", 0x00000067, 0},
+	"beq":    {"s,t,p", 0x00000063, 0},
+	"bne":    {"s,t,p", 0x00001063, 0},
+	"blt":    {"s,t,p", 0x00004063, 0},
+	"bge":    {"s,t,p", 0x00005063, 0},
+	"bltu":   {"s,t,p", 0x00006063, 0},
+	"bgeu":   {"s,t,p", 0x00007063, 0},
+	"lb":     {"d,o", 0x00000003, 0},
+	"lh":     {"d,o", 0x00001003, 0},
+	"lw":     {"d,o", 0x00002003, 0},
+	"lbu":    {"d,o", 0x00004003, 0},
+	"lhu":    {"d,o", 0x00005003, 0},
+	"sb":     {"t,q", 0x00000023, 0},
+	"sh":     {"t,q", 0x00001023, 0},
+	"sw":     {"t,q", 0x00002023, 0},
+	"addi":   {"d,s,j", 0x00000013, 0},
+	"slti":   {"d,s,j", 0x00002013, 0},
+	"sltiu":  {"d,s,j", 0x00003013, 0},
+	"xori":   {"d,s,j", 0x00004013, 0},
+	"ori":    {"d,s,j", 0x00006013, 0},
+	"andi":   {"d,s,j", 0x00007013, 0},
+	"slli":   {"d,s,>", 0x00001013, 0},
+	"srli":   {"d,s,>", 0x00005013, 0},
+	"srai":   {"d,s,>", 0x40005013, 0},
+	"add":    {"d,s,t", 0x00000033, 0},
+	"sub":    {"d,s,t", 0x40000033, 0},
+	"sll":    {"d,s,t", 0x00001033, 0},
+	"slt":    {"d,s,t", 0x00002033, 0},
+	"sltu":   {"d,s,t", 0x00003033, 0},
+	"xor":    {"d,s,t", 0x00004033, 0},
+	"srl":    {"d,s,t", 0x00005033, 0},
+	"sra":    {"d,s,t", 0x40005033, 0},
+	"or":     {"d,s,t", 0x00006033, 0},
+	"and":    {"d,s,t", 0x00007033, 0},
+	"fence":  {"P,Q", 0x0000000f, 0},
+	"ecall":  {"", 0x00000073, 0},
+	"ebreak": {"", 0x00100073, 0},
+	// RV64I
+	"lwu":   {"d,o", 0x00006003, 64},
+	"ld":    {"d,o", 0x00003003, 64},
+	"sd":    {"t,q", 0x00003023, 64},
+	"addiw": {"d,s,j", 0x0000001b, 64},
+	"slliw": {"d,s,<", 0x0000101b, 64},
+	"srliw": {"d,s,<", 0x0000501b, 64},
+	"sraiw": {"d,s,<", 0x4000501b, 64},
+	"addw":  {"d,s,t", 0x0000003b, 64},
+	"subw":  {"d,s,t", 0x4000003b, 64},
+	"sllw":  {"d,s,t", 0x0000103b, 64},
+	"srlw":  {"d,s,t", 0x0000503b, 64},
+	"sraw":  {"d,s,t", 0x4000503b, 64},
+	// privileged
+	"mret":       {"", 0x30200073, 0},
+	"sret":       {"", 0x10200073, 0},
+	"wfi":        {"", 0x10500073, 0},
+	"sfence.vma": {"s,t", 0x12000073, 0},
+	// Zifencei
+	"fence.i": {"", 0x0000100f, 0},
+	// Zicsr
+	"csrrw":  {"d,E,s", 0x00001073, 0},
+	"csrrs":  {"d,E,s", 0x00002073, 0},
+	"csrrc":  {"d,E,s", 0x00003073, 0},
+	"csrrwi": {"d,E,Z", 0x00005073, 0},
+	"csrrsi": {"d,E,Z", 0x00006073, 0},
+	"csrrci": {"d,E,Z", 0x00007073, 0},
+	// M
+	"mul":    {"d,s,t", 0x02000033, 0},
+	"mulh":   {"d,s,t", 0x02001033, 0},
+	"mulhsu": {"d,s,t", 0x02002033, 0},
+	"mulhu":  {"d,s,t", 0x02003033, 0},
+	"div":    {"d,s,t", 0x02004033, 0},
+	"divu":   {"d,s,t", 0x02005033, 0},
+	"rem":    {"d,s,t", 0x02006033, 0},
+	"remu":   {"d,s,t", 0x02007033, 0},
+	"mulw":   {"d,s,t", 0x0200003b, 64},
+	"divw":   {"d,s,t", 0x0200403b, 64},
+	"divuw":  {"d,s,t", 0x0200503b, 64},
+	"remw":   {"d,s,t", 0x0200603b, 64},
+	"remuw":  {"d,s,t", 0x0200703b, 64},
+	// A
+	"lr.w":      {"d,A", 0x1000202f, 0},
+	"sc.w":      {"d,t,A", 0x1800202f, 0},
+	"amoswap.w": {"d,t,A", 0x0800202f, 0},
+	"amoadd.w":  {"d,t,A", 0x0000202f, 0},
+	"amoxor.w":  {"d,t,A", 0x2000202f, 0},
+	"amoand.w":  {"d,t,A", 0x6000202f, 0},
+	"amoor.w":   {"d,t,A", 0x4000202f, 0},
+	"amomin.w":  {"d,t,A", 0x8000202f, 0},
+	"amomax.w":  {"d,t,A", 0xa000202f, 0},
+	"amominu.w": {"d,t,A", 0xc000202f, 0},
+	"amomaxu.w": {"d,t,A", 0xe000202f, 0},
+	"lr.d":      {"d,A", 0x1000302f, 64},
+	"sc.d":      {"d,t,A", 0x1800302f, 64},
+	"amoswap.d": {"d,t,A", 0x0800302f, 64},
+	"amoadd.d":  {"d,t,A", 0x0000302f, 64},
+	"amoxor.d":  {"d,t,A", 0x2000302f, 64},
+	"amoand.d":  {"d,t,A", 0x6000302f, 64},
+	"amoor.d":   {"d,t,A", 0x4000302f, 64},
+	"amomin.d":  {"d,t,A", 0x8000302f, 64},
+	"amomax.d":  {"d,t,A", 0xa000302f, 64},
+	"amominu.d": {"d,t,A", 0xc000302f, 64},
+	"amomaxu.d": {"d,t,A", 0xe000302f, 64},
+	// F
+	"flw":       {"D,o", 0x00002007, 0},
+	"fsw":       {"T,q", 0x00002027, 0},
+	"fmadd.s":   {"D,S,T,R,m", 0x00000043, 0},
+	"fmsub.s":   {"D,S,T,R,m", 0x00000047, 0},
+	"fnmsub.s":  {"D,S,T,R,m", 0x0000004b, 0},
+	"fnmadd.s":  {"D,S,T,R,m", 0x0000004f, 0},
+	"fadd.s":    {"D,S,T,m", 0x00000053, 0},
+	"fsub.s":    {"D,S,T,m", 0x08000053, 0},
+	"fmul.s":    {"D,S,T,m", 0x10000053, 0},
+	"fdiv.s":    {"D,S,T,m", 0x18000053, 0},
+	"fsqrt.s":   {"D,S,m", 0x58000053, 0},
+	"fsgnj.s":   {"D,S,T", 0x20000053, 0},
+	"fsgnjn.s":  {"D,S,T", 0x20001053, 0},
+	"fsgnjx.s":  {"D,S,T", 0x20002053, 0},
+	"fmin.s":    {"D,S,T", 0x28000053, 0},
+	"fmax.s":    {"D,S,T", 0x28001053, 0},
+	"fcvt.w.s":  {"d,S,m", 0xc0000053, 0},
+	"fcvt.wu.s": {"d,S,m", 0xc0100053, 0},
+	"fmv.x.w":   {"d,S", 0xe0000053, 0},
+	"feq.s":     {"d,S,T", 0xa0002053, 0},
+	"flt.s":     {"d,S,T", 0xa0001053, 0},
+	"fle.s":     {"d,S,T", 0xa0000053, 0},
+	"fclass.s":  {"d,S", 0xe0001053, 0},
+	"fcvt.s.w":  {"D,s,m", 0xd0000053, 0},
+	"fcvt.s.wu": {"D,s,m", 0xd0100053, 0},
+	"fmv.w.x":   {"D,s", 0xf0000053, 0},
+	"fcvt.l.s":  {"d,S,m", 0xc0200053, 64},
+	"fcvt.lu.s": {"d,S,m", 0xc0300053, 64},
+	"fcvt.s.l":  {"D,s,m", 0xd0200053, 64},
+	"fcvt.s.lu": {"D,s,m", 0xd0300053, 64},
+	// D
+	"fld":       {"D,o", 0x00003007, 0},
+	"fsd":       {"T,q", 0x00003027, 0},
+	"fmadd.d":   {"D,S,T,R,m", 0x02000043, 0},
+	"fmsub.d":   {"D,S,T,R,m", 0x02000047, 0},
+	"fnmsub.d":  {"D,S,T,R,m", 0x0200004b, 0},
+	"fnmadd.d":  {"D,S,T,R,m", 0x0200004f, 0},
+	"fadd.d":    {"D,S,T,m", 0x02000053, 0},
+	"fsub.d":    {"D,S,T,m", 0x0a000053, 0},
+	"fmul.d":    {"D,S,T,m", 0x12000053, 0},
+	"fdiv.d":    {"D,S,T,m", 0x1a000053, 0},
+	"fsqrt.d":   {"D,S,m", 0x5a000053, 0},
+	"fsgnj.d":   {"D,S,T", 0x22000053, 0},
+	"fsgnjn.d":  {"D,S,T", 0x22001053, 0},
+	"fsgnjx.d":  {"D,S,T", 0x22002053, 0},
+	"fmin.d":    {"D,S,T", 0x2a000053, 0},
+	"fmax.d":    {"D,S,T", 0x2a001053, 0},
+	"fcvt.s.d":  {"D,S,m", 0x40100053, 0},
+	"fcvt.d.s":  {"D,S,M", 0x42000053, 0},
+	"feq.d":     {"d,S,T", 0xa2002053, 0},
+	"flt.d":     {"d,S,T", 0xa2001053, 0},
+	"fle.d":     {"d,S,T", 0xa2000053, 0},
+	"fclass.d":  {"d,S", 0xe2001053, 0},
+	"fcvt.w.d":  {"d,S,m", 0xc2000053, 0},
+	"fcvt.wu.d": {"d,S,m", 0xc2100053, 0},
+	"fcvt.d.w":  {"D,s,M", 0xd2000053, 0},
+	"fcvt.d.wu": {"D,s,M", 0xd2100053, 0},
+	"fcvt.l.d":  {"d,S,m", 0xc2200053, 64},
+	"fcvt.lu.d": {"d,S,m", 0xc2300053, 64},
+	"fmv.x.d":   {"d,S", 0xe2000053, 64},
+	"fcvt.d.l":  {"D,s,m", 0xd2200053, 64},
+	"fcvt.d.lu": {"D,s,m", 0xd2300053, 64},
+	"fmv.d.x":   {"D,s", 0xf2000053, 64},
+}
+
+//-----------------------------------------------------------------------------
+
+var xRegName = map[string]uint{
+	"zero": 0, "ra": 1, "sp": 2, "gp": 3, "tp": 4, "t0": 5, "t1": 6, "t2": 7,
+	"s0": 8, "fp": 8, "s1": 9, "a0": 10, "a1": 11, "a2": 12, "a3": 13, "a4": 14, "a5": 15,
+	"a6": 16, "a7": 17, "s2": 18, "s3": 19, "s4": 20, "s5": 21, "s6": 22, "s7": 23,
+	"s8": 24, "s9": 25, "s10": 26, "s11": 27, "t3": 28, "t4": 29, "t5": 30, "t6": 31,
+}
+
+var fRegName = map[string]uint{
+	"ft0": 0, "ft1": 1, "ft2": 2, "ft3": 3, "ft4": 4, "ft5": 5, "ft6": 6, "ft7": 7,
+	"fs0": 8, "fs1": 9, "fa0": 10, "fa1": 11, "fa2": 12, "fa3": 13, "fa4": 14, "fa5": 15,
+	"fa6": 16, "fa7": 17, "fs2": 18, "fs3": 19, "fs4": 20, "fs5": 21, "fs6": 22, "fs7": 23,
+	"fs8": 24, "fs9": 25, "fs10": 26, "fs11": 27, "ft8": 28, "ft9": 29, "ft10": 30, "ft11": 31,
+}
+
+// rmValue returns the value of a rounding mode name.
+func rmValue(s string) (uint32, bool) {
+	for k, v := range FrmName {
+		if v == s {
+			return uint32(k), true
+		}
+	}
+	return 0, false
+}
+
+// csrName are the default CSR names (the hart CSR decodes add to these).
+var csrName = map[string]uint{
+	"fflags": FFLAGS, "frm": FRM, "fcsr": FCSR,
+	"cycle": 0xc00, "time": 0xc01, "instret": 0xc02,
+	"cycleh": 0xc80, "timeh": 0xc81, "instreth": 0xc82,
+	"sstatus": SSTATUS, "sie": 0x104, "stvec": 0x105, "sscratch": SSCRATCH,
+	"sepc": SEPC, "scause": SCAUSE, "stval": STVAL, "sip": 0x144, "satp": SATP,
+	"mstatus": MSTATUS, "misa": MISA, "medeleg": 0x302, "mideleg": 0x303, "mie": 0x304, "mtvec": 0x305,
+	"mscratch": MSCRATCH, "mepc": MEPC, "mcause": MCAUSE, "mtval": MTVAL, "mip": 0x344,
+	"tselect": TSELECT, "tdata1": TDATA1, "tdata2": TDATA2, "tdata3": TDATA3,
+	"dcsr": DCSR, "dpc": DPC, "dscratch0": DSCRATCH0, "dscratch1": DSCRATCH1,
+	"mvendorid": MVENDORID, "marchid": MARCHID, "mimpid": MIMPID, "mhartid": MHARTID,
+}
+
+//-----------------------------------------------------------------------------
+
+// AsmIns is an assembled instruction (or data).
+type AsmIns struct {
+	Addr uint   // address
+	Ins  uint32 // encoding
+	Size uint   // size in bytes (2 or 4)
+	Src  string // source line
+}
+
+// asmCode is an encoded instruction.
+type asmCode struct {
+	ins  uint32
+	size uint
+}
+
+// asmLine is a parsed source line.
+type asmLine struct {
+	n    int      // line number
+	src  string   // source text
+	mn   string   // mnemonic
+	ops  []string // operands
+	addr uint     // address
+	size uint     // size in bytes
+}
+
+// Assembler assembles RISC-V instructions.
+type Assembler struct {
+	xlen   uint
+	csr    map[string]uint
+	lookup func(name string) (uint, bool) // external symbol lookup
+	label  map[string]uint                // labels for the current assembly
+}
+
+// NewAssembler returns an assembler for a hart.
+// The symbol lookup function (may be nil) resolves names that are not labels.
+func NewAssembler(hi *HartInfo, lookup func(name string) (uint, bool)) *Assembler {
+	a := &Assembler{
+		xlen:   hi.MXLEN,
+		csr:    map[string]uint{},
+		lookup: lookup,
+	}
+	if a.xlen == 0 {
+		a.xlen = 32
+	}
+	for k, v := range csrName {
+		a.csr[k] = v
+	}
+	if hi.CSR != nil {
+		for _, p := range hi.CSR.Peripherals {
+			for _, r := range p.Registers {
+				a.csr[r.Name] = r.Offset
+			}
+		}
+	}
+	return a
+}
+
+//-----------------------------------------------------------------------------
+// parsing
+
+// parse splits the source into lines of labels and instructions.
+func (a *Assembler) parse(src string) ([]*asmLine, []map[string]bool, error) {
+	lines := []*asmLine{}
+	labels := []map[string]bool{}
+	for i, s := range strings.Split(src, "\n") {
+		if k := strings.IndexByte(s, '#'); k >= 0 {
+			s = s[:k]
+		}
+		for _, stmt := range strings.Split(s, ";") {
+			l := &asmLine{n: i + 1, src: strings.TrimSpace(stmt)}
+			stmt = l.src
+			lab := map[string]bool{}
+			// labels
+			for {
+				k := strings.IndexByte(stmt, ':')
+				if k < 0 || strings.ContainsAny(stmt[:k], " \t,()") {
+					break
+				}
+				name := stmt[:k]
+				if !isSymbol(name) {
+					return nil, nil, fmt.Errorf("line %d: bad label \"%s\"", l.n, name)
+				}
+				lab[name] = true
+				stmt = strings.TrimSpace(stmt[k+1:])
+			}
+			if stmt == "" && len(lab) == 0 {
+				continue
+			}
+			l.src = stmt
+			if stmt != "" {
+				f := strings.Fields(stmt)
+				l.mn = strings.ToLower(f[0])
+				args := strings.TrimSpace(stmt[len(f[0]):])
+				if args != "" {
+					for _, op := range strings.Split(args, ",") {
+						l.ops = append(l.ops, strings.TrimSpace(op))
+					}
+				}
+			}
+			lines = append(lines, l)
+			labels = append(labels, lab)
+		}
+	}
+	return lines, labels, nil
+}
+
+// isSymbol returns true if the string is a valid symbol name.
+func isSymbol(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c == '.' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
+// expressions
+
+// errUndefined is returned for an undefined symbol.
+var errUndefined = errors.New("undefined symbol")
+
+type asmExpr struct {
+	a   *Assembler
+	s   string
+	pos int
+	pc  uint
+}
+
+func (e *asmExpr) skip() {
+	for e.pos < len(e.s) && (e.s[e.pos] == ' ' || e.s[e.pos] == '\t') {
+		e.pos++
+	}
+}
+
+// expr := {'+'|'-'} term {('+'|'-') {'+'|'-'} term}
+func (e *asmExpr) expr() (int64, error) {
+	var x int64
+	for {
+		sign := int64(1)
+		e.skip()
+		for e.pos < len(e.s) && (e.s[e.pos] == '+' || e.s[e.pos] == '-') {
+			if e.s[e.pos] == '-' {
+				sign = -sign
+			}
+			e.pos++
+			e.skip()
+		}
+		t, err := e.term()
+		if err != nil {
+			return 0, err
+		}
+		x += sign * t
+		e.skip()
+		if e.pos >= len(e.s) || (e.s[e.pos] != '+' && e.s[e.pos] != '-') {
+			return x, nil
+		}
+	}
+}
+
+// term := number | symbol | '.' | %hi(expr) | %lo(expr) | (expr)
+func (e *asmExpr) term() (int64, error) {
+	e.skip()
+	if e.pos >= len(e.s) {
+		return 0, fmt.Errorf("bad expression \"%s\"", e.s)
+	}
+	if e.s[e.pos] == '(' || e.s[e.pos] == '%' {
+		fn := ""
+		if e.s[e.pos] == '%' {
+			k := strings.IndexByte(e.s[e.pos:], '(')
+			if k < 0 {
+				return 0, fmt.Errorf("bad expression \"%s\"", e.s)
+			}
+			fn = e.s[e.pos+1 : e.pos+k]
+			e.pos += k
+		}
+		e.pos++
+		x, err := e.expr()
+		if err != nil {
+			return 0, err
+		}
+		if e.pos >= len(e.s) || e.s[e.pos] != ')' {
+			return 0, fmt.Errorf("missing ')' in \"%s\"", e.s)
+		}
+		e.pos++
+		switch fn {
+		case "":
+			return x, nil
+		case "hi":
+			return ((x + 0x800) >> 12) & 0xfffff, nil
+		case "lo":
+			return x << 52 >> 52, nil
+		}
+		return 0, fmt.Errorf("unknown function \"%%%s\"", fn)
+	}
+	start := e.pos
+	for e.pos < len(e.s) && !strings.ContainsRune(" \t+-()", rune(e.s[e.pos])) {
+		e.pos++
+	}
+	tok := e.s[start:e.pos]
+	if tok == "." {
+		return int64(e.pc), nil
+	}
+	if tok[0] >= '0' && tok[0] <= '9' {
+		x, err := strconv.ParseUint(tok, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad number \"%s\"", tok)
+		}
+		return int64(x), nil
+	}
+	if !isSymbol(tok) {
+		return 0, fmt.Errorf("bad symbol \"%s\"", tok)
+	}
+	if x, ok := e.a.label[tok]; ok {
+		return int64(x), nil
+	}
+	if e.a.lookup != nil {
+		if x, ok := e.a.lookup(tok); ok {
+			return int64(x), nil
+		}
+	}
+	return 0, fmt.Errorf("%w \"%s\"", errUndefined, tok)
+}
+
+// eval evaluates an expression.
+func (a *Assembler) eval(s string, pc uint) (int64, error) {
+	e := &asmExpr{a: a, s: s, pc: pc}
+	x, err := e.expr()
+	if err != nil {
+		return 0, err
+	}
+	if e.pos != len(e.s) {
+		return 0, fmt.Errorf("bad expression \"%s\"", s)
+	}
+	return x, nil
+}
+
+//-----------------------------------------------------------------------------
+// operands
+
+// signed returns true if a value fits in an n-bit signed field.
+func signed(x int64, n uint) bool {
+	return x >= -(1<<(n-1)) && x < (1<<(n-1))
+}
+
+func (a *Assembler) xreg(s string) (uint32, error) {
+	s = strings.ToLower(s)
+	if r, ok := xRegName[s]; ok {
+		return uint32(r), nil
+	}
+	if len(s) > 1 && s[0] == 'x' {
+		if r, err := strconv.ParseUint(s[1:], 10, 8); err == nil && r < 32 {
+			return uint32(r), nil
+		}
+	}
+	return 0, fmt.Errorf("bad register \"%s\"", s)
+}
+
+func (a *Assembler) freg(s string) (uint32, error) {
+	s = strings.ToLower(s)
+	if r, ok := fRegName[s]; ok {
+		return uint32(r), nil
+	}
+	if len(s) > 1 && s[0] == 'f' {
+		if r, err := strconv.ParseUint(s[1:], 10, 8); err == nil && r < 32 {
+			return uint32(r), nil
+		}
+	}
+	return 0, fmt.Errorf("bad float register \"%s\"", s)
+}
+
+// imm evaluates a signed n-bit immediate.
+func (a *Assembler) imm(s string, pc uint, n uint) (int64, error) {
+	x, err := a.eval(s, pc)
+	if err != nil {
+		return 0, err
+	}
+	if !signed(x, n) {
+		return 0, fmt.Errorf("immediate %d out of range", x)
+	}
+	return x, nil
+}
+
+// uimm evaluates an unsigned immediate (less than max).
+func (a *Assembler) uimm(s string, pc uint, max uint64) (uint32, error) {
+	x, err := a.eval(s, pc)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(x) >= max {
+		return 0, fmt.Errorf("immediate %d out of range", x)
+	}
+	return uint32(x), nil
+}
+
+// target evaluates a pc relative target address and returns the offset.
+func (a *Assembler) target(s string, pc uint, n uint) (int64, error) {
+	x, err := a.eval(s, pc)
+	if err != nil {
+		return 0, err
+	}
+	ofs := x - int64(pc)
+	if a.xlen == 32 {
+		ofs = int64(int32(ofs))
+	}
+	if ofs&1 != 0 {
+		return 0, fmt.Errorf("target 0x%x is misaligned", x)
+	}
+	if !signed(ofs, n) {
+		return 0, fmt.Errorf("target 0x%x out of range", x)
+	}
+	return ofs, nil
+}
+
+// mem parses an "offset(reg)" operand.
+func (a *Assembler) mem(s string, pc uint) (int64, string, error) {
+	if !strings.HasSuffix(s, ")") {
+		return 0, "", fmt.Errorf("bad memory operand \"%s\"", s)
+	}
+	k := strings.LastIndexByte(s, '(')
+	if k < 0 {
+		return 0, "", fmt.Errorf("bad memory operand \"%s\"", s)
+	}
+	reg := strings.TrimSpace(s[k+1 : len(s)-1])
+	ofs := strings.TrimSpace(s[:k])
+	if ofs == "" {
+		return 0, reg, nil
+	}
+	x, err := a.imm(ofs, pc, 12)
+	return x, reg, err
+}
+
+func (a *Assembler) csrArg(s string, pc uint) (uint32, error) {
+	if x, ok := a.csr[strings.ToLower(s)]; ok {
+		return uint32(x), nil
+	}
+	return a.uimm(s, pc, 1<<12)
+}
+
+func fenceArg(s string) (uint32, error) {
+	var x uint32
+	for _, c := range strings.ToLower(s) {
+		k := strings.IndexRune("wroi", c)
+		if k < 0 {
+			return 0, fmt.Errorf("bad fence operand \"%s\"", s)
+		}
+		x |= 1 << k
+	}
+	return x, nil
+}
+
+//-----------------------------------------------------------------------------
+// encoding
+
+// encodeOp encodes an instruction from the operation table.
+func (a *Assembler) encodeOp(op *asmOp, ops []string, pc uint) (uint32, error) {
+	if op.xlen != 0 && op.xlen != a.xlen {
+		return 0, fmt.Errorf("not supported for rv%d", a.xlen)
+	}
+	args := []string{}
+	if op.args != "" {
+		args = strings.Split(op.args, ",")
+	}
+	// optional rounding mode
+	if len(args) != 0 && len(ops) == len(args)-1 {
+		switch args[len(args)-1] {
+		case "m":
+			ops = append(ops, "dyn")
+		case "M":
+			ops = append(ops, "rne")
+		}
+	}
+	if len(ops) != len(args) {
+		return 0, fmt.Errorf("needs %d operands", len(args))
+	}
+	ins := op.match
+	for i, arg := range args {
+		s := ops[i]
+		var r uint32
+		var err error
+		switch arg {
+		case "d", "s", "t":
+			r, err = a.xreg(s)
+			ins |= r << map[string]uint{"d": 7, "s": 15, "t": 20}[arg]
+		case "D", "S", "T", "R":
+			r, err = a.freg(s)
+			ins |= r << map[string]uint{"D": 7, "S": 15, "T": 20, "R": 27}[arg]
+		case "j":
+			var x int64
+			x, err = a.imm(s, pc, 12)
+			ins |= uint32(x&0xfff) << 20
+		case "o", "q", "A":
+			var x int64
+			var reg string
+			x, reg, err = a.mem(s, pc)
+			if err == nil {
+				r, err = a.xreg(reg)
+			}
+			if arg == "A" && x != 0 {
+				err = errors.New("amo address offset must be 0")
+			}
+			ins |= r << 15
+			if arg == "q" {
+				ins |= (uint32(x&0xfe0) << 20) | (uint32(x&0x1f) << 7)
+			} else {
+				ins |= uint32(x&0xfff) << 20
+			}
+		case "u":
+			var x int64
+			x, err = a.eval(s, pc)
+			if x < -(1<<19) || x >= (1<<20) {
+				err = fmt.Errorf("immediate %d out of range", x)
+			}
+			ins |= uint32(x&0xfffff) << 12
+		case "a":
+			var x int64
+			x, err = a.target(s, pc, 21)
+			ins |= encJ(uint32(x))
+		case "p":
+			var x int64
+			x, err = a.target(s, pc, 13)
+			ins |= encB(uint32(x))
+		case ">":
+			r, err = a.uimm(s, pc, uint64(a.xlen))
+			ins |= r << 20
+		case "<", "Z":
+			r, err = a.uimm(s, pc, 32)
+			ins |= r << map[string]uint{"<": 20, "Z": 15}[arg]
+		case "E":
+			r, err = a.csrArg(s, pc)
+			ins |= r << 20
+		case "m", "M":
+			var ok bool
+			r, ok = rmValue(strings.ToLower(s))
+			if !ok {
+				err = fmt.Errorf("bad rounding mode \"%s\"", s)
+			}
+			ins |= r << 12
+		case "P", "Q":
+			r, err = fenceArg(s)
+			ins |= r << map[string]uint{"P": 24, "Q": 20}[arg]
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return ins, nil
+}
+
+// encB returns the B-type immediate bits.
+func encB(x uint32) uint32 {
+	return ((x >> 12) & 1 << 31) | ((x >> 5) & 0x3f << 25) | ((x >> 1) & 0xf << 8) | ((x >> 11) & 1 << 7)
+}
+
+// encJ returns the J-type immediate bits.
+func encJ(x uint32) uint32 {
+	return ((x >> 20) & 1 << 31) | ((x >> 1) & 0x3ff << 21) | ((x >> 11) & 1 << 20) | ((x >> 12) & 0xff << 12)
+}
+
+// amoOp returns the operation for an amo mnemonic with .aq/.rl suffixes.
+func amoOp(mn string) (*asmOp, bool) {
+	for sfx, bits := range map[string]uint32{".aq": 1 << 26, ".rl": 1 << 25, ".aqrl": 3 << 25} {
+		if base := strings.TrimSuffix(mn, sfx); base != mn {
+			if op, ok := asmOps[base]; ok && (strings.HasPrefix(base, "amo") || strings.HasPrefix(base, "lr.") || strings.HasPrefix(base, "sc.")) {
+				op.match |= bits
+				return &op, true
+			}
+		}
+	}
+	return nil, false
+}
+
+//-----------------------------------------------------------------------------
+// pseudo instructions
+
+// seq encodes a sequence of instructions.
+func (a *Assembler) seq(pc uint, ins ...[]string) ([]asmCode, error) {
+	code := []asmCode{}
+	for _, x := range ins {
+		c, err := a.encode(x[0], x[1:], pc)
+		if err != nil {
+			return nil, err
+		}
+		code = append(code, c...)
+		pc += 4
+	}
+	return code, nil
+}
+
+// li returns the instructions to load a constant into a register.
+func (a *Assembler) li(rd string, x int64) [][]string {
+	itoa := func(x int64) string { return strconv.FormatInt(x, 10) }
+	if signed(x, 12) {
+		return [][]string{{"addi", rd, "zero", itoa(x)}}
+	}
+	if signed(x, 32) {
+		hi := (x + 0x800) >> 12
+		lo := x - (hi << 12)
+		ins := [][]string{{"lui", rd, itoa(hi & 0xfffff)}}
+		if lo != 0 {
+			op := "addi"
+			if a.xlen == 64 {
+				op = "addiw"
+			}
+			ins = append(ins, []string{op, rd, rd, itoa(lo)})
+		}
+		return ins
+	}
+	// load the upper bits, then shift and add the lower 12 bits
+	lo := x << 52 >> 52
+	hi := (x - lo) >> 12
+	shift := int64(12)
+	for hi&1 == 0 {
+		hi >>= 1
+		shift++
+	}
+	ins := a.li(rd, hi)
+	ins = append(ins, []string{"slli", rd, rd, itoa(shift)})
+	if lo != 0 {
+		ins = append(ins, []string{"addi", rd, rd, itoa(lo)})
+	}
+	return ins
+}
+
+// liValue evaluates the constant for a li instruction.
+func (a *Assembler) liValue(s string, pc uint) (int64, error) {
+	x, err := a.eval(s, pc)
+	if err != nil {
+		return 0, err
+	}
+	if a.xlen == 32 {
+		if !signed(x, 32) && uint64(x) > 0xffffffff {
+			return 0, fmt.Errorf("immediate %d out of range", x)
+		}
+		x = int64(int32(x))
+	}
+	return x, nil
+}
+
+// pcrel returns the auipc/lo12 split of a pc relative address.
+func (a *Assembler) pcrel(s string, pc uint) (string, string, error) {
+	x, err := a.eval(s, pc)
+	if err != nil {
+		return "", "", err
+	}
+	ofs := x - int64(pc)
+	if a.xlen == 32 {
+		ofs = int64(int32(ofs))
+	}
+	if !signed(ofs, 32) {
+		return "", "", fmt.Errorf("address 0x%x out of range", x)
+	}
+	hi := (ofs + 0x800) >> 12
+	lo := ofs - (hi << 12)
+	return strconv.FormatInt(hi&0xfffff, 10), strconv.FormatInt(lo, 10), nil
+}
+
+// pseudo encodes a pseudo instruction.
+func (a *Assembler) pseudo(mn string, ops []string, pc uint) ([]asmCode, bool, error) {
+	n := len(ops)
+	var ins [][]string
+	switch {
+	case mn == "nop" && n == 0:
+		ins = [][]string{{"addi", "zero", "zero", "0"}}
+	case mn == "li" && n == 2:
+		x, err := a.liValue(ops[1], pc)
+		if err != nil {
+			return nil, true, err
+		}
+		ins = a.li(ops[0], x)
+	case (mn == "la" || mn == "lla") && n == 2:
+		hi, lo, err := a.pcrel(ops[1], pc)
+		if err != nil {
+			return nil, true, err
+		}
+		ins = [][]string{{"auipc", ops[0], hi}, {"addi", ops[0], ops[0], lo}}
+	case mn == "call" && n == 1, mn == "tail" && n == 1:
+		hi, lo, err := a.pcrel(ops[0], pc)
+		if err != nil {
+			return nil, true, err
+		}
+		if mn == "call" {
+			ins = [][]string{{"auipc", "ra", hi}, {"jalr", "ra", lo + "(ra)"}}
+		} else {
+			ins = [][]string{{"auipc", "t1", hi}, {"jalr", "zero", lo + "(t1)"}}
+		}
+	case mn == "mv" && n == 2:
+		ins = [][]string{{"addi", ops[0], ops[1], "0"}}
+	case mn == "not" && n == 2:
+		ins = [][]string{{"xori", ops[0], ops[1], "-1"}}
+	case mn == "neg" && n == 2:
+		ins = [][]string{{"sub", ops[0], "zero", ops[1]}}
+	case mn == "negw" && n == 2:
+		ins = [][]string{{"subw", ops[0], "zero", ops[1]}}
+	case mn == "sext.w" && n == 2:
+		ins = [][]string{{"addiw", ops[0], ops[1], "0"}}
+	case mn == "seqz" && n == 2:
+		ins = [][]string{{"sltiu", ops[0], ops[1], "1"}}
+	case mn == "snez" && n == 2:
+		ins = [][]string{{"sltu", ops[0], "zero", ops[1]}}
+	case mn == "sltz" && n == 2:
+		ins = [][]string{{"slt", ops[0], ops[1], "zero"}}
+	case mn == "sgtz" && n == 2:
+		ins = [][]string{{"slt", ops[0], "zero", ops[1]}}
+	case mn == "beqz" && n == 2:
+		ins = [][]string{{"beq", ops[0], "zero", ops[1]}}
+	case mn == "bnez" && n == 2:
+		ins = [][]string{{"bne", ops[0], "zero", ops[1]}}
+	case mn == "blez" && n == 2:
+		ins = [][]string{{"bge", "zero", ops[0], ops[1]}}
+	case mn == "bgez" && n == 2:
+		ins = [][]string{{"bge", ops[0], "zero", ops[1]}}
+	case mn == "bltz" && n == 2:
+		ins = [][]string{{"blt", ops[0], "zero", ops[1]}}
+	case mn == "bgtz" && n == 2:
+		ins = [][]string{{"blt", "zero", ops[0], ops[1]}}
+	case mn == "bgt" && n == 3:
+		ins = [][]string{{"blt", ops[1], ops[0], ops[2]}}
+	case mn == "ble" && n == 3:
+		ins = [][]string{{"bge", ops[1], ops[0], ops[2]}}
+	case mn == "bgtu" && n == 3:
+		ins = [][]string{{"bltu", ops[1], ops[0], ops[2]}}
+	case mn == "bleu" && n == 3:
+		ins = [][]string{{"bgeu", ops[1], ops[0], ops[2]}}
+	case mn == "j" && n == 1:
+		ins = [][]string{{"jal", "zero", ops[0]}}
+	case mn == "jal" && n == 1:
+		ins = [][]string{{"jal", "ra", ops[0]}}
+	case mn == "jr" && n == 1:
+		ins = [][]string{{"jalr", "zero", "0(" + ops[0] + ")"}}
+	case mn == "jalr" && n == 1:
+		ins = [][]string{{"jalr", "ra", "0(" + ops[0] + ")"}}
+	case mn == "jalr" && n == 3:
+		ins = [][]string{{"jalr", ops[0], ops[2] + "(" + ops[1] + ")"}}
+	case mn == "ret" && n == 0:
+		ins = [][]string{{"jalr", "zero", "0(ra)"}}
+	case mn == "fence" && n == 0:
+		ins = [][]string{{"fence", "iorw", "iorw"}}
+	case mn == "sfence.vma" && n == 0:
+		ins = [][]string{{"sfence.vma", "zero", "zero"}}
+	case mn == "sfence.vma" && n == 1:
+		ins = [][]string{{"sfence.vma", ops[0], "zero"}}
+	case mn == "csrr" && n == 2:
+		ins = [][]string{{"csrrs", ops[0], ops[1], "zero"}}
+	case mn == "csrw" && n == 2, mn == "csrs" && n == 2, mn == "csrc" && n == 2:
+		ins = [][]string{{"csrr" + mn[3:], "zero", ops[0], ops[1]}}
+	case mn == "csrwi" && n == 2, mn == "csrsi" && n == 2, mn == "csrci" && n == 2:
+		ins = [][]string{{"csrr" + mn[3:], "zero", ops[0], ops[1]}}
+	case mn == "rdcycle" && n == 1, mn == "rdtime" && n == 1, mn == "rdinstret" && n == 1,
+		mn == "rdcycleh" && n == 1, mn == "rdtimeh" && n == 1, mn == "rdinstreth" && n == 1:
+		ins = [][]string{{"csrrs", ops[0], mn[2:], "zero"}}
+	case mn == "frcsr" && n == 1, mn == "frrm" && n == 1, mn == "frflags" && n == 1:
+		csr := map[string]string{"frcsr": "fcsr", "frrm": "frm", "frflags": "fflags"}[mn]
+		ins = [][]string{{"csrrs", ops[0], csr, "zero"}}
+	case mn == "fscsr" && n <= 2, mn == "fsrm" && n <= 2, mn == "fsflags" && n <= 2:
+		if n == 0 {
+			return nil, true, errors.New("needs 1 or 2 operands")
+		}
+		csr := map[string]string{"fscsr": "fcsr", "fsrm": "frm", "fsflags": "fflags"}[mn]
+		rd := "zero"
+		if n == 2 {
+			rd = ops[0]
+		}
+		ins = [][]string{{"csrrw", rd, csr, ops[n-1]}}
+	case (mn == "fmv.s" || mn == "fmv.d") && n == 2:
+		ins = [][]string{{"fsgnj" + mn[3:], ops[0], ops[1], ops[1]}}
+	case (mn == "fabs.s" || mn == "fabs.d") && n == 2:
+		ins = [][]string{{"fsgnjx" + mn[4:], ops[0], ops[1], ops[1]}}
+	case (mn == "fneg.s" || mn == "fneg.d") && n == 2:
+		ins = [][]string{{"fsgnjn" + mn[4:], ops[0], ops[1], ops[1]}}
+	default:
+		return nil, false, nil
+	}
+	code, err := a.seq(pc, ins...)
+	return code, true, err
+}
+
+//-----------------------------------------------------------------------------
+
+// encode encodes an instruction.
+func (a *Assembler) encode(mn string, ops []string, pc uint) ([]asmCode, error) {
+	// data
+	if mn == ".word" || mn == ".half" {
+		size := map[string]uint{".word": 4, ".half": 2}[mn]
+		code := []asmCode{}
+		for _, s := range ops {
+			x, err := a.eval(s, pc)
+			if err != nil {
+				return nil, err
+			}
+			if uint64(x)>>(size*8) != 0 && !signed(x, size*8) {
+				return nil, fmt.Errorf("value %d out of range", x)
+			}
+			code = append(code, asmCode{uint32(x) & uint32((1<<(size*8))-1), size})
+			pc += size
+		}
+		return code, nil
+	}
+	// compressed instructions
+	if strings.HasPrefix(mn, "c.") {
+		ins, err := a.encodeRVC(mn, ops, pc)
+		if err != nil {
+			return nil, err
+		}
+		return []asmCode{{ins, 2}}, nil
+	}
+	// pseudo instructions
+	code, ok, err := a.pseudo(mn, ops, pc)
+	if ok {
+		return code, err
+	}
+	// normal instructions
+	op, ok := amoOp(mn)
+	if !ok {
+		x, ok := asmOps[mn]
+		if !ok {
+			return nil, errors.New("unknown instruction")
+		}
+		op = &x
+	}
+	ins, err := a.encodeOp(op, ops, pc)
+	if err != nil {
+		return nil, err
+	}
+	return []asmCode{{ins, 4}}, nil
+}
+
+// size returns the size of an instruction in bytes.
+func (a *Assembler) size(l *asmLine) (uint, error) {
+	switch {
+	case l.mn == "":
+		return 0, nil
+	case l.mn == ".word":
+		return 4 * uint(len(l.ops)), nil
+	case l.mn == ".half":
+		return 2 * uint(len(l.ops)), nil
+	case strings.HasPrefix(l.mn, "c."):
+		return 2, nil
+	case l.mn == "li" && len(l.ops) == 2:
+		// the constant must be known in the first pass
+		x, err := a.liValue(l.ops[1], l.addr)
+		if err != nil {
+			return 0, err
+		}
+		return 4 * uint(len(a.li(l.ops[0], x))), nil
+	case (l.mn == "la" || l.mn == "lla") && len(l.ops) == 2, (l.mn == "call" || l.mn == "tail") && len(l.ops) == 1:
+		return 8, nil
+	}
+	return 4, nil
+}
+
+// Assemble assembles source text at an address.
+func (a *Assembler) Assemble(addr uint, src string) ([]AsmIns, error) {
+	lines, labels, err := a.parse(src)
+	if err != nil {
+		return nil, err
+	}
+	// pass 1: assign addresses to the labels
+	a.label = map[string]uint{}
+	pc := addr
+	for i, l := range lines {
+		for name := range labels[i] {
+			if _, ok := a.label[name]; ok {
+				return nil, fmt.Errorf("line %d: label \"%s\" redefined", l.n, name)
+			}
+			a.label[name] = pc
+		}
+		l.addr = pc
+		l.size, err = a.size(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", l.n, l.src, err)
+		}
+		pc += l.size
+	}
+	// pass 2: encode the instructions
+	x := []AsmIns{}
+	for _, l := range lines {
+		if l.mn == "" {
+			continue
+		}
+		code, err := a.encode(l.mn, l.ops, l.addr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", l.n, l.src, err)
+		}
+		pc := l.addr
+		for _, c := range code {
+			x = append(x, AsmIns{Addr: pc, Ins: c.ins, Size: c.size, Src: l.src})
+			pc += c.size
+		}
+		if pc != l.addr+l.size {
+			return nil, fmt.Errorf("line %d: %s: size changed between passes", l.n, l.src)
+		}
+	}
+	return x, nil
+}
+
+// Program assembles source text for a program buffer.
+// Compressed instructions and data are not allowed.
+func (a *Assembler) Program(src string) ([]uint32, error) {
+	code, err := a.Assemble(0, src)
+	if err != nil {
+		return nil, err
+	}
+	x := make([]uint32, len(code))
+	for i, c := range code {
+		if c.Size != 4 {
+			return nil, fmt.Errorf("%s: compressed instructions are not allowed", c.Src)
+		}
+		x[i] = c.Ins
+	}
+	return x, nil
+}
+
+//-----------------------------------------------------------------------------
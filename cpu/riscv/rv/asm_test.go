@@ -0,0 +1,125 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Assembler test functions.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"fmt"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+func asmCodes(t *testing.T, xlen uint, addr uint, src string) []uint32 {
+	a := NewAssembler(&HartInfo{MXLEN: xlen}, nil)
+	x, err := a.Assemble(addr, src)
+	if err != nil {
+		t.Errorf("\"%s\": %s", src, err)
+		return nil
+	}
+	code := []uint32{}
+	for _, ins := range x {
+		code = append(code, ins.Ins)
+	}
+	return code
+}
+
+func codeEqual(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Assemble(t *testing.T) {
+	tests := []struct {
+		xlen uint
+		src  string
+		code []uint32
+	}{
+		{32, "addi a0, a0, -1", []uint32{0xfff50513}},
+		{32, "nop", []uint32{0x00000013}},
+		{32, "ret", []uint32{0x00008067}},
+		{32, "ebreak", []uint32{0x00100073}},
+		{32, "mul a0, a1, a2", []uint32{0x02c58533}},
+		{32, "lr.w.aq a0, (a1)", []uint32{0x1405a52f}},
+		{32, "fence rw, w", []uint32{0x0310000f}},
+		{32, "csrr a0, mstatus", []uint32{0x30002573}},
+		{32, "li a2, 0x7fffffff", []uint32{0x80000637, 0xfff60613}},
+		{32, "loop: addi a0, a0, -1; bnez a0, loop", []uint32{0xfff50513, 0xfe051ee3}},
+		{32, "fcvt.d.w fa0, a0", []uint32{0xd2050553}},
+		{32, "fcvt.d.s fa0, fa1", []uint32{0x42058553}},
+		{32, "fcvt.w.d a0, fa0", []uint32{0xc2057553}},
+		{32, "c.addi16sp sp, -64", []uint32{0x7139}},
+		{64, "c.sdsp ra, 8(sp)", []uint32{0xe406}},
+		{64, "c.fldsp fa0, 16(sp)", []uint32{0x2542}},
+		{64, "c.fsdsp fs0, 504(sp)", []uint32{0xbfa2}},
+	}
+	for _, v := range tests {
+		code := asmCodes(t, v.xlen, 0, v.src)
+		if code != nil && !codeEqual(code, v.code) {
+			t.Errorf("\"%s\": got %08x, expected %08x", v.src, code, v.code)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// liExec executes an li sequence and returns the final register value.
+func liExec(t *testing.T, code []uint32) uint64 {
+	var x uint64
+	for _, ins := range code {
+		imm := uint64(int64(int32(ins)) >> 20)
+		if ins&0x7f == 0x37 { // lui
+			x = uint64(int64(int32(ins & 0xfffff000)))
+			continue
+		}
+		switch ins & 0x707f {
+		case 0x0013: // addi
+			x += imm
+		case 0x001b: // addiw
+			x = uint64(int64(int32(x + imm)))
+		case 0x1013: // slli
+			x <<= imm & 63
+		default:
+			t.Errorf("unexpected li instruction %08x", ins)
+		}
+	}
+	return x
+}
+
+func Test_Li64(t *testing.T) {
+	tests := []uint64{
+		0,
+		1,
+		0x7ff,
+		0x800,
+		0xffffffff,
+		0x80000000,
+		0x7fffffff,
+		0x123456789abcdef0,
+		0x8000000000000000,
+		0xffffffffffffffff,
+		0xfffffffffffff800,
+	}
+	for _, v := range tests {
+		code := asmCodes(t, 64, 0, fmt.Sprintf("li a0, 0x%x", v))
+		if x := liExec(t, code); x != v {
+			t.Errorf("li 0x%x: got 0x%x", v, x)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
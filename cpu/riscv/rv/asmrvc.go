@@ -0,0 +1,392 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Assembler: Compressed Instructions
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"errors"
+	"fmt"
+)
+
+//-----------------------------------------------------------------------------
+
+// rvcBits returns x[msb:lsb] shifted to a position.
+func rvcBits(x uint32, msb, lsb, pos uint) uint32 {
+	return ((x >> lsb) & ((1 << (msb - lsb + 1)) - 1)) << pos
+}
+
+// cxreg returns a compressed integer register (x8..x15).
+func (a *Assembler) cxreg(s string) (uint32, error) {
+	r, err := a.xreg(s)
+	if err != nil {
+		return 0, err
+	}
+	if r < 8 || r > 15 {
+		return 0, fmt.Errorf("register \"%s\" is not x8..x15", s)
+	}
+	return r - 8, nil
+}
+
+// cfreg returns a compressed float register (f8..f15).
+func (a *Assembler) cfreg(s string) (uint32, error) {
+	r, err := a.freg(s)
+	if err != nil {
+		return 0, err
+	}
+	if r < 8 || r > 15 {
+		return 0, fmt.Errorf("register \"%s\" is not f8..f15", s)
+	}
+	return r - 8, nil
+}
+
+// cimm evaluates a compressed immediate.
+// The value must be a multiple of scale and fit in n bits (signed or unsigned).
+func (a *Assembler) cimm(s string, pc uint, n uint, sign bool, scale int64) (uint32, error) {
+	x, err := a.eval(s, pc)
+	if err != nil {
+		return 0, err
+	}
+	if x%scale != 0 {
+		return 0, fmt.Errorf("immediate %d is not a multiple of %d", x, scale)
+	}
+	if sign && !signed(x, n) || !sign && (x < 0 || x >= 1<<n) {
+		return 0, fmt.Errorf("immediate %d out of range", x)
+	}
+	return uint32(x), nil
+}
+
+// cmem parses an "offset(reg)" operand for a compressed load/store.
+func (a *Assembler) cmem(s string, pc uint, sp bool, scale int64, n uint) (uint32, uint32, error) {
+	ofs, reg, err := a.mem(s, pc)
+	if err != nil {
+		return 0, 0, err
+	}
+	var r uint32
+	if sp {
+		r, err = a.xreg(reg)
+		if err == nil && r != RegSp {
+			err = errors.New("base register must be sp")
+		}
+	} else {
+		r, err = a.cxreg(reg)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if ofs < 0 || ofs%scale != 0 || ofs >= 1<<n {
+		return 0, 0, fmt.Errorf("offset %d out of range", ofs)
+	}
+	return uint32(ofs), r, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// compressed instruction formats
+func encCR(f4, rd, rs2, op uint32) uint32 {
+	return (f4 << 12) | (rd << 7) | (rs2 << 2) | op
+}
+
+func encCI(f3, rd, imm, op uint32) uint32 {
+	return (f3 << 13) | rvcBits(imm, 5, 5, 12) | (rd << 7) | rvcBits(imm, 4, 0, 2) | op
+}
+
+func encCA(f6, rd, f2, rs2 uint32) uint32 {
+	return (f6 << 10) | (rd << 7) | (f2 << 5) | (rs2 << 2) | 1
+}
+
+// offsets for 32-bit (word) and 64-bit (double) compressed loads/stores
+func clsWord(ofs uint32) uint32 {
+	return rvcBits(ofs, 5, 3, 10) | rvcBits(ofs, 2, 2, 6) | rvcBits(ofs, 6, 6, 5)
+}
+
+func clsDouble(ofs uint32) uint32 {
+	return rvcBits(ofs, 5, 3, 10) | rvcBits(ofs, 7, 6, 5)
+}
+
+// encodeRVC encodes a compressed instruction.
+func (a *Assembler) encodeRVC(mn string, ops []string, pc uint) (uint32, error) {
+	type rvcOp struct {
+		n    int  // number of operands
+		xlen uint // 64 == RV64 only, 32 == RV32 only, 0 == any
+	}
+	rvcOps := map[string]rvcOp{
+		"c.nop": {0, 0}, "c.ebreak": {0, 0},
+		"c.addi": {2, 0}, "c.li": {2, 0}, "c.lui": {2, 0}, "c.addi16sp": {2, 0}, "c.addi4spn": {3, 0},
+		"c.addiw": {2, 64}, "c.slli": {2, 0}, "c.srli": {2, 0}, "c.srai": {2, 0}, "c.andi": {2, 0},
+		"c.mv": {2, 0}, "c.add": {2, 0}, "c.sub": {2, 0}, "c.xor": {2, 0}, "c.or": {2, 0}, "c.and": {2, 0},
+		"c.subw": {2, 64}, "c.addw": {2, 64},
+		"c.j": {1, 0}, "c.jal": {1, 32}, "c.jr": {1, 0}, "c.jalr": {1, 0}, "c.beqz": {2, 0}, "c.bnez": {2, 0},
+		"c.lw": {2, 0}, "c.sw": {2, 0}, "c.ld": {2, 64}, "c.sd": {2, 64},
+		"c.flw": {2, 32}, "c.fsw": {2, 32}, "c.fld": {2, 0}, "c.fsd": {2, 0},
+		"c.lwsp": {2, 0}, "c.swsp": {2, 0}, "c.ldsp": {2, 64}, "c.sdsp": {2, 64},
+		"c.flwsp": {2, 32}, "c.fswsp": {2, 32}, "c.fldsp": {2, 0}, "c.fsdsp": {2, 0},
+	}
+	op, ok := rvcOps[mn]
+	if !ok {
+		return 0, errors.New("unknown instruction")
+	}
+	if op.xlen != 0 && op.xlen != a.xlen {
+		return 0, fmt.Errorf("not supported for rv%d", a.xlen)
+	}
+	if len(ops) != op.n {
+		return 0, fmt.Errorf("needs %d operands", op.n)
+	}
+
+	switch mn {
+	case "c.nop":
+		return 0x0001, nil
+	case "c.ebreak":
+		return opcodeCEBREAK, nil
+
+	case "c.addi", "c.li", "c.addiw", "c.lui", "c.slli":
+		rd, err := a.xreg(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		switch mn {
+		case "c.addi":
+			imm, err := a.cimm(ops[1], pc, 6, true, 1)
+			return encCI(0, rd, imm, 1), err
+		case "c.li":
+			imm, err := a.cimm(ops[1], pc, 6, true, 1)
+			return encCI(2, rd, imm, 1), err
+		case "c.addiw":
+			if rd == 0 {
+				return 0, errors.New("rd can't be x0")
+			}
+			imm, err := a.cimm(ops[1], pc, 6, true, 1)
+			return encCI(1, rd, imm, 1), err
+		case "c.lui":
+			if rd == 0 || rd == RegSp {
+				return 0, errors.New("rd can't be x0 or sp")
+			}
+			// 6-bit signed value of the upper immediate (or the 20-bit field value)
+			x, err := a.eval(ops[1], pc)
+			if err != nil {
+				return 0, err
+			}
+			if x >= 0xfffe0 && x <= 0xfffff {
+				x -= 1 << 20
+			}
+			if x == 0 || !signed(x, 6) {
+				return 0, fmt.Errorf("immediate %d out of range", x)
+			}
+			return encCI(3, rd, uint32(x), 1), nil
+		case "c.slli":
+			imm, err := a.uimm(ops[1], pc, uint64(a.xlen))
+			return encCI(0, rd, imm, 2), err
+		}
+
+	case "c.addi16sp":
+		if r, err := a.xreg(ops[0]); err != nil || r != RegSp {
+			return 0, errors.New("destination register must be sp")
+		}
+		imm, err := a.cimm(ops[1], pc, 10, true, 16)
+		if err != nil {
+			return 0, err
+		}
+		if imm == 0 {
+			return 0, errors.New("immediate can't be 0")
+		}
+		return (3 << 13) | rvcBits(imm, 9, 9, 12) | (RegSp << 7) | rvcBits(imm, 4, 4, 6) | rvcBits(imm, 6, 6, 5) | rvcBits(imm, 8, 7, 3) | rvcBits(imm, 5, 5, 2) | 1, nil
+
+	case "c.addi4spn":
+		rd, err := a.cxreg(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		if r, err := a.xreg(ops[1]); err != nil || r != RegSp {
+			return 0, errors.New("source register must be sp")
+		}
+		imm, err := a.cimm(ops[2], pc, 10, false, 4)
+		if err != nil {
+			return 0, err
+		}
+		if imm == 0 {
+			return 0, errors.New("immediate can't be 0")
+		}
+		return rvcBits(imm, 5, 4, 11) | rvcBits(imm, 9, 6, 7) | rvcBits(imm, 2, 2, 6) | rvcBits(imm, 3, 3, 5) | (rd << 2), nil
+
+	case "c.srli", "c.srai", "c.andi":
+		rd, err := a.cxreg(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		var imm uint32
+		if mn == "c.andi" {
+			imm, err = a.cimm(ops[1], pc, 6, true, 1)
+		} else {
+			imm, err = a.uimm(ops[1], pc, uint64(a.xlen))
+		}
+		f2 := map[string]uint32{"c.srli": 0, "c.srai": 1, "c.andi": 2}[mn]
+		return (4 << 13) | rvcBits(imm, 5, 5, 12) | (f2 << 10) | (rd << 7) | rvcBits(imm, 4, 0, 2) | 1, err
+
+	case "c.sub", "c.xor", "c.or", "c.and", "c.subw", "c.addw":
+		rd, err := a.cxreg(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		rs2, err := a.cxreg(ops[1])
+		if err != nil {
+			return 0, err
+		}
+		f6 := uint32(0x23)
+		if mn == "c.subw" || mn == "c.addw" {
+			f6 = 0x27
+		}
+		f2 := map[string]uint32{"c.sub": 0, "c.xor": 1, "c.or": 2, "c.and": 3, "c.subw": 0, "c.addw": 1}[mn]
+		return encCA(f6, rd, f2, rs2), nil
+
+	case "c.mv", "c.add":
+		rd, err := a.xreg(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		rs2, err := a.xreg(ops[1])
+		if err != nil {
+			return 0, err
+		}
+		if rs2 == 0 {
+			return 0, errors.New("rs2 can't be x0")
+		}
+		if mn == "c.mv" {
+			return encCR(8, rd, rs2, 2), nil
+		}
+		return encCR(9, rd, rs2, 2), nil
+
+	case "c.jr", "c.jalr":
+		rs1, err := a.xreg(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		if rs1 == 0 {
+			return 0, errors.New("rs1 can't be x0")
+		}
+		if mn == "c.jr" {
+			return encCR(8, rs1, 0, 2), nil
+		}
+		return encCR(9, rs1, 0, 2), nil
+
+	case "c.j", "c.jal":
+		x, err := a.target(ops[0], pc, 12)
+		if err != nil {
+			return 0, err
+		}
+		ofs := uint32(x)
+		f3 := uint32(5)
+		if mn == "c.jal" {
+			f3 = 1
+		}
+		return (f3 << 13) | rvcBits(ofs, 11, 11, 12) | rvcBits(ofs, 4, 4, 11) | rvcBits(ofs, 9, 8, 9) | rvcBits(ofs, 10, 10, 8) |
+			rvcBits(ofs, 6, 6, 7) | rvcBits(ofs, 7, 7, 6) | rvcBits(ofs, 3, 1, 3) | rvcBits(ofs, 5, 5, 2) | 1, nil
+
+	case "c.beqz", "c.bnez":
+		rs1, err := a.cxreg(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		x, err := a.target(ops[1], pc, 9)
+		if err != nil {
+			return 0, err
+		}
+		ofs := uint32(x)
+		f3 := uint32(6)
+		if mn == "c.bnez" {
+			f3 = 7
+		}
+		return (f3 << 13) | rvcBits(ofs, 8, 8, 12) | rvcBits(ofs, 4, 3, 10) | (rs1 << 7) | rvcBits(ofs, 7, 6, 5) |
+			rvcBits(ofs, 2, 1, 3) | rvcBits(ofs, 5, 5, 2) | 1, nil
+
+	case "c.lw", "c.sw", "c.flw", "c.fsw", "c.ld", "c.sd", "c.fld", "c.fsd":
+		var r uint32
+		var err error
+		if mn[2] == 'f' {
+			r, err = a.cfreg(ops[0])
+		} else {
+			r, err = a.cxreg(ops[0])
+		}
+		if err != nil {
+			return 0, err
+		}
+		double := mn[len(mn)-1] == 'd'
+		scale, n := int64(4), uint(7)
+		if double {
+			scale, n = 8, 8
+		}
+		ofs, rs1, err := a.cmem(ops[1], pc, false, scale, n)
+		if err != nil {
+			return 0, err
+		}
+		f3 := map[string]uint32{"c.fld": 1, "c.lw": 2, "c.flw": 3, "c.ld": 3, "c.fsd": 5, "c.sw": 6, "c.fsw": 7, "c.sd": 7}[mn]
+		imm := clsWord(ofs)
+		if double {
+			imm = clsDouble(ofs)
+		}
+		return (f3 << 13) | imm | (rs1 << 7) | (r << 2), nil
+
+	case "c.lwsp", "c.flwsp", "c.ldsp", "c.fldsp":
+		var r uint32
+		var err error
+		if mn[2] == 'f' {
+			r, err = a.freg(ops[0])
+		} else {
+			r, err = a.xreg(ops[0])
+			if err == nil && r == 0 {
+				err = errors.New("rd can't be x0")
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		double := mn == "c.ldsp" || mn == "c.fldsp"
+		scale, n := int64(4), uint(8)
+		if double {
+			scale, n = 8, 9
+		}
+		ofs, _, err := a.cmem(ops[1], pc, true, scale, n)
+		if err != nil {
+			return 0, err
+		}
+		f3 := map[string]uint32{"c.fldsp": 1, "c.lwsp": 2, "c.flwsp": 3, "c.ldsp": 3}[mn]
+		imm := rvcBits(ofs, 5, 5, 12) | rvcBits(ofs, 4, 2, 4) | rvcBits(ofs, 7, 6, 2)
+		if double {
+			imm = rvcBits(ofs, 5, 5, 12) | rvcBits(ofs, 4, 3, 5) | rvcBits(ofs, 8, 6, 2)
+		}
+		return (f3 << 13) | imm | (r << 7) | 2, nil
+
+	case "c.swsp", "c.fswsp", "c.sdsp", "c.fsdsp":
+		var r uint32
+		var err error
+		if mn[2] == 'f' {
+			r, err = a.freg(ops[0])
+		} else {
+			r, err = a.xreg(ops[0])
+		}
+		if err != nil {
+			return 0, err
+		}
+		double := mn == "c.sdsp" || mn == "c.fsdsp"
+		scale, n := int64(4), uint(8)
+		if double {
+			scale, n = 8, 9
+		}
+		ofs, _, err := a.cmem(ops[1], pc, true, scale, n)
+		if err != nil {
+			return 0, err
+		}
+		f3 := map[string]uint32{"c.fsdsp": 5, "c.swsp": 6, "c.fswsp": 7, "c.sdsp": 7}[mn]
+		imm := rvcBits(ofs, 5, 2, 9) | rvcBits(ofs, 7, 6, 7)
+		if double {
+			imm = rvcBits(ofs, 5, 3, 10) | rvcBits(ofs, 8, 6, 7)
+		}
+		return (f3 << 13) | imm | (r << 2) | 2, nil
+	}
+	return 0, errors.New("unknown instruction")
+}
+
+//-----------------------------------------------------------------------------
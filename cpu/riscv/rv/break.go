@@ -0,0 +1,385 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Breakpoints and Watchpoints
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"errors"
+	"fmt"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// BreakType is the type of a breakpoint/watchpoint.
+type BreakType int
+
+// BreakType values.
+const (
+	BreakExecute BreakType = iota // break on instruction execution
+	BreakLoad                     // break on a load from the address
+	BreakStore                    // break on a store to the address
+)
+
+var breakName = map[BreakType]string{
+	BreakExecute: "execute",
+	BreakLoad:    "load",
+	BreakStore:   "store",
+}
+
+func (bt BreakType) String() string {
+	if name, ok := breakName[bt]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+//-----------------------------------------------------------------------------
+
+// BreakMode selects hardware or software breakpoints.
+type BreakMode int
+
+// BreakMode values.
+const (
+	BreakAuto     BreakMode = iota // hardware if a trigger is free, else software
+	BreakHardware                  // trigger module
+	BreakSoftware                  // ebreak instruction
+)
+
+//-----------------------------------------------------------------------------
+
+// Breakpoint is a breakpoint/watchpoint.
+type Breakpoint struct {
+	ID      int       // breakpoint identifier
+	Type    BreakType // breakpoint type
+	Addr    uint      // breakpoint address
+	trigger *trigger  // hardware trigger (nil == software breakpoint)
+	orig    uint      // original instruction (software)
+	width   uint      // instruction width (software)
+}
+
+// swInsert writes an ebreak instruction at the breakpoint address.
+func (bp *Breakpoint) swInsert(dbg Debug, hi *HartInfo) error {
+	width, ins := uint(32), uint(InsEBREAK())
+	if CheckExtMISA(hi.MISA, 'c') {
+		width, ins = 16, uint(InsCEBREAK())
+	}
+	// save the original instruction
+	x, err := dbg.RdMem(width, bp.Addr, 1)
+	if err != nil {
+		return err
+	}
+	bp.orig, bp.width = x[0], width
+	err = dbg.WrMem(width, bp.Addr, []uint{ins})
+	if err == nil {
+		// read back to check the write (e.g. flash, rom)
+		x, err = dbg.RdMem(width, bp.Addr, 1)
+		if err == nil && x[0] != ins {
+			err = fmt.Errorf("unable to write ebreak at 0x%x, is it read-only memory?", bp.Addr)
+		}
+	}
+	if err != nil {
+		// a partial write may have changed the memory, put back the original instruction
+		rerr := dbg.WrMem(width, bp.Addr, []uint{bp.orig})
+		if rerr != nil {
+			return fmt.Errorf("%v (unable to restore 0x%x: %v)", err, bp.Addr, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// insert sets the breakpoint on the current (halted) hart.
+func (bp *Breakpoint) insert(dbg Debug, hi *HartInfo) error {
+	if bp.trigger != nil {
+		return bp.trigger.set(dbg, hi, bp.Type, bp.Addr)
+	}
+	return bp.swInsert(dbg, hi)
+}
+
+// remove clears the breakpoint on the current (halted) hart.
+func (bp *Breakpoint) remove(dbg Debug) error {
+	if bp.trigger != nil {
+		return bp.trigger.clr(dbg)
+	}
+	// restore the original instruction
+	return dbg.WrMem(bp.width, bp.Addr, []uint{bp.orig})
+}
+
+// Where returns a string describing how the breakpoint is implemented.
+func (bp *Breakpoint) Where() string {
+	if bp.trigger != nil {
+		return fmt.Sprintf("trigger%d", bp.trigger.index)
+	}
+	return []string{"ebreak", "c.ebreak"}[util.BoolToInt(bp.width == 16)]
+}
+
+//-----------------------------------------------------------------------------
+
+// Breakpoints is the set of breakpoints/watchpoints for a hart.
+type Breakpoints struct {
+	hi      *HartInfo     // hart for these breakpoints
+	probed  bool          // has the trigger module been probed?
+	trigger []*trigger    // trigger module triggers
+	bp      []*Breakpoint // current breakpoints
+	nextID  int           // next breakpoint identifier
+}
+
+// GetBreakpoints returns the breakpoint set for the hart.
+func (hi *HartInfo) GetBreakpoints() *Breakpoints {
+	if hi.bp == nil {
+		hi.bp = &Breakpoints{
+			hi:     hi,
+			nextID: 1,
+		}
+	}
+	return hi.bp
+}
+
+// Probe enumerates the trigger module. The hart must be current and halted.
+func (b *Breakpoints) Probe(dbg Debug) error {
+	if b.probed {
+		return nil
+	}
+	tl, err := probeTriggers(dbg, b.hi)
+	if err != nil {
+		return err
+	}
+	b.trigger = tl
+	b.probed = true
+	return nil
+}
+
+// NumTriggers returns the number of address match triggers.
+func (b *Breakpoints) NumTriggers() int {
+	n := 0
+	for _, t := range b.trigger {
+		if t.canMatch() {
+			n++
+		}
+	}
+	return n
+}
+
+// freeTrigger returns an unused address match trigger.
+func (b *Breakpoints) freeTrigger() *trigger {
+	for _, t := range b.trigger {
+		if t.bp == nil && t.canMatch() {
+			return t
+		}
+	}
+	return nil
+}
+
+// lookup returns the breakpoint with a given id.
+func (b *Breakpoints) lookup(id int) (*Breakpoint, int) {
+	for i, bp := range b.bp {
+		if bp.ID == id {
+			return bp, i
+		}
+	}
+	return nil, -1
+}
+
+// Add adds a breakpoint. The hart must be current and halted.
+func (b *Breakpoints) Add(dbg Debug, bt BreakType, addr uint, mode BreakMode) (*Breakpoint, error) {
+	err := b.Probe(dbg)
+	if err != nil {
+		return nil, err
+	}
+	// is this a duplicate?
+	for _, bp := range b.bp {
+		if bp.Type == bt && bp.Addr == addr {
+			return nil, fmt.Errorf("%s breakpoint %d is already at 0x%x", bt, bp.ID, addr)
+		}
+	}
+	t := b.freeTrigger()
+	if mode == BreakAuto {
+		mode = BreakHardware
+		if t == nil && bt == BreakExecute {
+			mode = BreakSoftware
+		}
+	}
+	bp := &Breakpoint{
+		ID:   b.nextID,
+		Type: bt,
+		Addr: addr,
+	}
+	if mode == BreakHardware {
+		if t == nil {
+			if b.NumTriggers() == 0 {
+				return nil, fmt.Errorf("hart%d has no address match triggers", b.hi.ID)
+			}
+			return nil, fmt.Errorf("all %d triggers are in use", b.NumTriggers())
+		}
+		bp.trigger = t
+	} else {
+		if bt != BreakExecute {
+			return nil, errors.New("software watchpoints are not supported")
+		}
+		// ebreak needs to enter debug mode
+		err := SetEbreak(dbg, b.hi)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = bp.insert(dbg, b.hi)
+	if err != nil {
+		return nil, err
+	}
+	if bp.trigger != nil {
+		bp.trigger.bp = bp
+	}
+	b.nextID++
+	b.bp = append(b.bp, bp)
+	return bp, nil
+}
+
+// Remove removes a breakpoint. The hart must be current and halted.
+func (b *Breakpoints) Remove(dbg Debug, id int) error {
+	bp, i := b.lookup(id)
+	if bp == nil {
+		return fmt.Errorf("no breakpoint %d", id)
+	}
+	err := bp.remove(dbg)
+	if err != nil {
+		return err
+	}
+	if bp.trigger != nil {
+		bp.trigger.bp = nil
+	}
+	b.bp = append(b.bp[:i], b.bp[i+1:]...)
+	return nil
+}
+
+// RemoveAll removes all breakpoints. The hart must be current and halted.
+func (b *Breakpoints) RemoveAll(dbg Debug) error {
+	for len(b.bp) != 0 {
+		err := b.Remove(dbg, b.bp[0].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AtAddr returns the execute breakpoint at an address (or nil).
+func (b *Breakpoints) AtAddr(addr uint) *Breakpoint {
+	for _, bp := range b.bp {
+		if bp.Type == BreakExecute && bp.Addr == addr {
+			return bp
+		}
+	}
+	return nil
+}
+
+// Step single steps the current (halted) hart. A breakpoint at the pc is stepped over.
+// If stepie is false interrupts are masked during the step.
+func (b *Breakpoints) Step(dbg Debug, stepie bool) error {
+	pc, err := dbg.RdCSR(DPC, 0)
+	if err != nil {
+		return err
+	}
+	bp := b.AtAddr(uint(pc))
+	if bp != nil {
+		err := bp.remove(dbg)
+		if err != nil {
+			return err
+		}
+	}
+	err = singleStep(dbg, stepie)
+	if bp != nil {
+		ierr := bp.insert(dbg, b.hi)
+		if err == nil {
+			err = ierr
+		}
+	}
+	return err
+}
+
+// stepOver steps the current hart over a breakpoint at the pc.
+func (b *Breakpoints) stepOver(dbg Debug) error {
+	pc, err := dbg.RdCSR(DPC, 0)
+	if err != nil {
+		return err
+	}
+	if b.AtAddr(uint(pc)) != nil {
+		return b.Step(dbg, false)
+	}
+	return nil
+}
+
+// Reinsert sets the breakpoints again after the hart has been reset.
+func (b *Breakpoints) Reinsert(dbg Debug) error {
+	for _, bp := range b.bp {
+		if bp.trigger == nil {
+			// is the ebreak still there (e.g. retained memory)?
+			x, err := dbg.RdMem(bp.width, bp.Addr, 1)
+			if err != nil {
+				return err
+			}
+			ins := []uint{uint(InsEBREAK()), uint(InsCEBREAK())}[util.BoolToInt(bp.width == 16)]
+			if x[0] == ins {
+				continue
+			}
+		}
+		err := bp.insert(dbg, b.hi)
+		if err != nil {
+			return fmt.Errorf("breakpoint %d: %v", bp.ID, err)
+		}
+	}
+	return nil
+}
+
+// Resume resumes the current hart. A breakpoint at the pc is stepped over.
+func (b *Breakpoints) Resume(dbg Debug) error {
+	err := b.stepOver(dbg)
+	if err != nil {
+		return err
+	}
+	return dbg.ResumeHart()
+}
+
+// ResumeAll resumes all harts. Breakpoints at the pc of halted harts are stepped over.
+func ResumeAll(dbg Debug) error {
+	cur := dbg.GetCurrentHart().ID
+	for id := 0; id < dbg.GetHartCount(); id++ {
+		hi, err := dbg.SetCurrentHart(id)
+		if err != nil {
+			return err
+		}
+		if hi.State != Halted {
+			continue
+		}
+		err = hi.GetBreakpoints().stepOver(dbg)
+		if err != nil {
+			return fmt.Errorf("hart%d: %v", id, err)
+		}
+	}
+	_, err := dbg.SetCurrentHart(cur)
+	if err != nil {
+		return err
+	}
+	return dbg.ResumeAll()
+}
+
+func (b *Breakpoints) String() string {
+	if len(b.bp) == 0 {
+		return fmt.Sprintf("hart%d: no breakpoints (%d triggers)", b.hi.ID, b.NumTriggers())
+	}
+	s := [][]string{}
+	s = append(s, []string{"id", "type", "address", "where"})
+	for _, bp := range b.bp {
+		s = append(s, []string{fmt.Sprintf("%d", bp.ID), bp.Type.String(), fmt.Sprintf("0x%x", bp.Addr), bp.Where()})
+	}
+	return cli.TableString(s, []int{0, 0, 0, 0}, 1)
+}
+
+//-----------------------------------------------------------------------------
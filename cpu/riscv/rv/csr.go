@@ -27,9 +27,19 @@ func (hi *HartInfo) NewCsr() *soc.Device {
 				Registers: []soc.Register{
 					// User CSRs 0x000 - 0x0ff (read/write)
 					{Offset: 0x000, Name: "ustatus"},
-					{Offset: 0x001, Name: "fflags"},
-					{Offset: 0x002, Name: "frm"},
-					{Offset: 0x003, Name: "fcsr"},
+					{Offset: 0x001, Name: "fflags", Fields: fflagsFields()},
+					{Offset: 0x002,
+						Name: "frm",
+						Fields: []soc.Field{
+							{Name: "frm", Msb: 2, Lsb: 0, Enums: FrmName},
+						},
+					},
+					{Offset: 0x003,
+						Name: "fcsr",
+						Fields: append([]soc.Field{
+							{Name: "frm", Msb: 7, Lsb: 5, Enums: FrmName},
+						}, fflagsFields()...),
+					},
 					{Offset: 0x004, Name: "uie"},
 					{Offset: 0x005, Name: "utvec"},
 					{Offset: 0x040, Name: "uscratch"},
@@ -341,6 +351,8 @@ func (hi *HartInfo) NewCsr() *soc.Device {
 					{Offset: 0x7a1, Name: "tdata1"},
 					{Offset: 0x7a2, Name: "tdata2"},
 					{Offset: 0x7a3, Name: "tdata3"},
+					{Offset: 0x7a4, Name: "tinfo"},
+					{Offset: 0x7a5, Name: "tcontrol"},
 					// Machine Debug Mode Only CSRs 0x7b0 - 0x7bf (read/write)
 					{Offset: 0x7b0,
 						Name: "dcsr",
@@ -401,12 +413,117 @@ func (hi *HartInfo) NewCsr() *soc.Device {
 		}
 	}
 
-	// TODO differences to DCSR decode based on debugger version
+	// vector extension
+	if CheckExtMISA(hi.MISA, 'v') {
+		p, _ := csr.GetPeripheral("CSR")
+		p.Registers = append(p.Registers, vectorRegisters(hi.MXLEN)...)
+	}
+
+	// the dcsr decode depends on the debug spec version
+	if hi.Version != Debug011 {
+		p, _ := csr.GetPeripheral("CSR")
+		r, _ := p.GetRegister("dcsr")
+		r.Fields = append([]soc.Field{}, dcsrFields[hi.Version]...)
+	}
+
+	// vendor specific CSRs
+	if hi.CsrExt != nil {
+		p, _ := csr.GetPeripheral("CSR")
+		addRegisters(p, hi.CsrExt(hi))
+	}
 
 	hi.CSR = csr
 	return csr
 }
 
+//-----------------------------------------------------------------------------
+// Vendor CSRs
+
+// CsrExtension returns the vendor specific CSRs for a hart.
+// They are added to the CSR decodes as each hart is examined.
+type CsrExtension func(hi *HartInfo) []soc.Register
+
+// addRegisters adds registers to a peripheral.
+// An existing register with the same offset is replaced.
+func addRegisters(p *soc.Peripheral, regs []soc.Register) {
+	for _, r := range regs {
+		replaced := false
+		for i := range p.Registers {
+			if p.Registers[i].Offset == r.Offset {
+				p.Registers[i] = r
+				replaced = true
+			}
+		}
+		if !replaced {
+			p.Registers = append(p.Registers, r)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// FrmName are the floating point rounding modes.
+var FrmName = soc.Enum{0: "rne", 1: "rtz", 2: "rdn", 3: "rup", 4: "rmm", 7: "dyn"}
+
+// FflagsName are the floating point accrued exceptions (indexed by bit).
+var FflagsName = [5]string{"nx", "uf", "of", "dz", "nv"}
+
+// fflagsFields returns the floating point accrued exception fields.
+func fflagsFields() []soc.Field {
+	f := make([]soc.Field, len(FflagsName))
+	for i, name := range FflagsName {
+		f[len(f)-1-i] = soc.Field{Name: name, Msb: uint(i), Lsb: uint(i)}
+	}
+	return f
+}
+
+var dcsrCause = soc.Enum{
+	1: "ebreak",
+	2: "trigger",
+	3: "haltreq",
+	4: "step",
+	5: "resethaltreq",
+	6: "group",
+	7: "other",
+}
+
+// dcsrFields are the 0.13 and 1.0 dcsr decodes.
+var dcsrFields = map[DebugVersion][]soc.Field{
+	Debug013: {
+		{Name: "xdebugver", Msb: 31, Lsb: 28},
+		{Name: "ebreakm", Msb: 15, Lsb: 15},
+		{Name: "ebreaks", Msb: 13, Lsb: 13},
+		{Name: "ebreaku", Msb: 12, Lsb: 12},
+		{Name: "stepie", Msb: 11, Lsb: 11},
+		{Name: "stopcount", Msb: 10, Lsb: 10},
+		{Name: "stoptime", Msb: 9, Lsb: 9},
+		{Name: "cause", Msb: 8, Lsb: 6, Enums: dcsrCause},
+		{Name: "mprven", Msb: 4, Lsb: 4},
+		{Name: "nmip", Msb: 3, Lsb: 3},
+		{Name: "step", Msb: 2, Lsb: 2},
+		{Name: "prv", Msb: 1, Lsb: 0},
+	},
+	Debug10: {
+		{Name: "debugver", Msb: 31, Lsb: 28},
+		{Name: "extcause", Msb: 26, Lsb: 24},
+		{Name: "cetrig", Msb: 19, Lsb: 19},
+		{Name: "ebreakvs", Msb: 17, Lsb: 17},
+		{Name: "ebreakvu", Msb: 16, Lsb: 16},
+		{Name: "ebreakm", Msb: 15, Lsb: 15},
+		{Name: "ebreaks", Msb: 13, Lsb: 13},
+		{Name: "ebreaku", Msb: 12, Lsb: 12},
+		{Name: "stepie", Msb: 11, Lsb: 11},
+		{Name: "stopcount", Msb: 10, Lsb: 10},
+		{Name: "stoptime", Msb: 9, Lsb: 9},
+		{Name: "cause", Msb: 8, Lsb: 6, Enums: dcsrCause},
+		{Name: "v", Msb: 5, Lsb: 5},
+		{Name: "mprven", Msb: 4, Lsb: 4},
+		{Name: "nmip", Msb: 3, Lsb: 3},
+		{Name: "step", Msb: 2, Lsb: 2},
+		{Name: "prv", Msb: 1, Lsb: 0},
+	},
+}
+
 //-----------------------------------------------------------------------------
 
 // CSR register addresses.
@@ -414,10 +531,24 @@ const (
 	FFLAGS    = 0x001
 	FRM       = 0x002
 	FCSR      = 0x003
+	SSTATUS   = 0x100
 	SSCRATCH  = 0x140
+	SEPC      = 0x141
+	SCAUSE    = 0x142
+	STVAL     = 0x143
+	SATP      = 0x180
 	MSTATUS   = 0x300
 	MISA      = 0x301
 	MSCRATCH  = 0x340
+	MEPC      = 0x341
+	MCAUSE    = 0x342
+	MTVAL     = 0x343
+	TSELECT   = 0x7a0
+	TDATA1    = 0x7a1
+	TDATA2    = 0x7a2
+	TDATA3    = 0x7a3
+	TINFO     = 0x7a4
+	TCONTROL  = 0x7a5
 	DCSR      = 0x7b0
 	DPC       = 0x7b1
 	DSCRATCH0 = 0x7b2
@@ -426,6 +557,13 @@ const (
 	MARCHID   = 0xf12
 	MIMPID    = 0xf13
 	MHARTID   = 0xf14
+	VSTART    = 0x008
+	VXSAT     = 0x009
+	VXRM      = 0x00a
+	VCSR      = 0x00f
+	VL        = 0xc20
+	VTYPE     = 0xc21
+	VLENB     = 0xc22
 )
 
 // CSR address modes.
@@ -486,6 +624,8 @@ func GetCSRSize(reg uint, hi *HartInfo) uint {
 		return 0
 	case DPC:
 		return hi.DXLEN
+	case VSTART, VXSAT, VXRM, VCSR, VL, VTYPE, VLENB:
+		return hi.MXLEN
 	}
 	// normal
 	switch reg & modeMask {
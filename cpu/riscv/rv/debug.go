@@ -9,7 +9,9 @@ RISC-V Debugger API
 package rv
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	cli "github.com/deadsy/go-cli"
 	"github.com/deadsy/rvda"
@@ -40,21 +42,49 @@ func (s HartState) String() string {
 	return "unknown"
 }
 
+// DebugVersion is the version of the debug specification implemented by a debug module.
+type DebugVersion int
+
+// DebugVersion values.
+const (
+	Debug011 DebugVersion = iota // debug spec 0.11
+	Debug013                     // debug spec 0.13
+	Debug10                      // debug spec 1.0
+)
+
+var versionName = map[DebugVersion]string{
+	Debug011: "0.11",
+	Debug013: "0.13",
+	Debug10:  "1.0",
+}
+
+func (v DebugVersion) String() string {
+	if name, ok := versionName[v]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 // HartInfo stores generic hart information.
 type HartInfo struct {
-	ID      int         // hart identifier
-	State   HartState   // hart state
-	Nregs   int         // number of GPRs (normally 32, 16 for rv32e)
-	MXLEN   uint        // machine XLEN
-	SXLEN   uint        // supervisor XLEN (0 == no S-mode)
-	UXLEN   uint        // user XLEN (0 == no U-mode)
-	HXLEN   uint        // hypervisor XLEN (0 == no H-mode)
-	DXLEN   uint        // debug XLEN
-	FLEN    uint        // foating point register width (0 == no floating point)
-	MISA    uint        // MISA value
-	MHARTID uint        // MHARTID value
-	CSR     *soc.Device // CSR registers/fields
-	ISA     *rvda.ISA   // ISA for the disassembler
+	ID      int          // hart identifier
+	Version DebugVersion // debug spec version
+	State   HartState    // hart state
+	Cause   HaltCause    // cause of the last halt
+	Nregs   int          // number of GPRs (normally 32, 16 for rv32e)
+	MXLEN   uint         // machine XLEN
+	SXLEN   uint         // supervisor XLEN (0 == no S-mode)
+	UXLEN   uint         // user XLEN (0 == no U-mode)
+	HXLEN   uint         // hypervisor XLEN (0 == no H-mode)
+	DXLEN   uint         // debug XLEN
+	FLEN    uint         // foating point register width (0 == no floating point)
+	VLEN    uint         // vector register width (0 == no vector unit)
+	MISA    uint         // MISA value
+	MHARTID uint         // MHARTID value
+	CSR     *soc.Device  // CSR registers/fields
+	CsrExt  CsrExtension // vendor specific CSRs (nil == none)
+	ISA     *rvda.ISA    // ISA for the disassembler
+	bp      *Breakpoints // breakpoints/watchpoints
 }
 
 func xlenString(n uint, msg string) string {
@@ -67,6 +97,9 @@ func xlenString(n uint, msg string) string {
 func (hi *HartInfo) String() string {
 	s := make([][]string, 0)
 	s = append(s, []string{fmt.Sprintf("hart%d", hi.ID), fmt.Sprintf("%s", hi.State)})
+	if hi.State == Halted {
+		s = append(s, []string{"cause", fmt.Sprintf("%s", hi.Cause)})
+	}
 	s = append(s, []string{"mhartid", fmt.Sprintf("%d", hi.MHARTID)})
 	s = append(s, []string{"nregs", fmt.Sprintf("%d", hi.Nregs)})
 	s = append(s, []string{"mxlen", fmt.Sprintf("%d", hi.MXLEN)})
@@ -74,6 +107,7 @@ func (hi *HartInfo) String() string {
 	s = append(s, []string{"uxlen", xlenString(hi.UXLEN, "u-mode")})
 	s = append(s, []string{"hxlen", xlenString(hi.HXLEN, "h-mode")})
 	s = append(s, []string{"flen", xlenString(hi.FLEN, "floating point")})
+	s = append(s, []string{"vlen", xlenString(hi.VLEN, "vector unit")})
 	s = append(s, []string{"dxlen", fmt.Sprintf("%d", hi.DXLEN)})
 	return cli.TableString(s, []int{0, 0}, 1)
 }
@@ -90,6 +124,12 @@ type Debug interface {
 	SetCurrentHart(id int) (*HartInfo, error) // set the current hart
 	HaltHart() error                          // halt the current hart
 	ResumeHart() error                        // resume the current hart
+	GetHartState() (HartState, error)         // get the running state of the current hart
+	HaltedHarts() ([]bool, error)             // halt summary for all harts (nil == no summary)
+	HaltAll() error                           // halt all harts
+	ResumeAll() error                         // resume all harts
+	ResetHalt() error                         // reset the system and halt all harts
+	ResetHart() error                         // reset and halt the current hart
 	// registers
 	RdGPR(reg, size uint) (uint64, error)   // read general purpose register
 	RdFPR(reg, size uint) (uint64, error)   // read floating point register
@@ -97,6 +137,8 @@ type Debug interface {
 	WrGPR(reg, size uint, val uint64) error // write general purpose register
 	WrFPR(reg, size uint, val uint64) error // write floating point register
 	WrCSR(reg, size uint, val uint64) error // write control and status register
+	RdVPR(reg uint) ([]uint, error)         // read vector register (VLEN/MXLEN elements)
+	WrVPR(reg uint, val []uint) error       // write vector register (VLEN/MXLEN elements)
 	// memory
 	GetAddressSize() uint                      // get address size in bits
 	RdMem(width, addr, n uint) ([]uint, error) // read width-bit memory buffer
@@ -107,3 +149,28 @@ type Debug interface {
 }
 
 //-----------------------------------------------------------------------------
+
+// AllHarts runs a function on each hart, restoring the current hart afterwards.
+func AllHarts(dbg Debug, f func() error) error {
+	cur := dbg.GetCurrentHart().ID
+	var errs []string
+	for id := 0; id < dbg.GetHartCount(); id++ {
+		_, err := dbg.SetCurrentHart(id)
+		if err == nil {
+			err = f()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("hart%d: %v", id, err))
+		}
+	}
+	_, err := dbg.SetCurrentHart(cur)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("hart%d: %v", cur, err))
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
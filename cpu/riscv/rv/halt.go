@@ -0,0 +1,64 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Halt Cause
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import "github.com/deadsy/rvdbg/util"
+
+//-----------------------------------------------------------------------------
+
+// HaltCause is the reason a hart entered debug mode (dcsr.cause).
+type HaltCause int
+
+// HaltCause values.
+const (
+	CauseNone         HaltCause = iota // no halt/unknown
+	CauseEbreak                        // ebreak instruction
+	CauseTrigger                       // trigger module
+	CauseHaltreq                       // debugger halt request
+	CauseStep                          // single step
+	CauseResetHaltreq                  // halt after reset
+	CauseGroup                         // halt group
+	CauseOther                         // other (1.0, see dcsr.extcause)
+)
+
+var causeName = map[HaltCause]string{
+	CauseEbreak:       "ebreak",
+	CauseTrigger:      "trigger",
+	CauseHaltreq:      "haltreq",
+	CauseStep:         "step",
+	CauseResetHaltreq: "resethaltreq",
+	CauseGroup:        "halt group",
+	CauseOther:        "other",
+}
+
+func (c HaltCause) String() string {
+	if name, ok := causeName[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+//-----------------------------------------------------------------------------
+
+// GetHaltInfo returns the halt cause and pc for the current (halted) hart.
+func GetHaltInfo(dbg Debug) (HaltCause, uint, error) {
+	hi := dbg.GetCurrentHart()
+	dcsr, err := dbg.RdCSR(DCSR, 0)
+	if err != nil {
+		return CauseNone, 0, err
+	}
+	pc, err := dbg.RdCSR(DPC, 0)
+	if err != nil {
+		return CauseNone, 0, err
+	}
+	hi.Cause = HaltCause(util.Bits(uint(dcsr), 8, 6))
+	return hi.Cause, uint(pc), nil
+}
+
+//-----------------------------------------------------------------------------
@@ -27,9 +27,13 @@ const (
 	opcodeSRLI    = 0x00005013 // srli
 	opcodeADDI    = 0x00000013 // addi
 	opcodeEBREAK  = 0x00100073 // ebreak
+	opcodeCEBREAK = 0x00009002 // c.ebreak
+	opcodeFENCE   = 0x0ff0000f // fence iorw, iorw
+	opcodeFENCE_I = 0x0000100f // fence.i
 	opcodeCSRRW   = 0x00001073 // csrrw
 	opcodeCSRRS   = 0x00002073 // csrrs
 	opcodeCSRRSI  = 0x00006073 // csrrsi
+	opcodeCSRRCI  = 0x00007073 // csrrci
 	opcodeFMV_X_W = 0xe0000053 // fmv.x.w
 	opcodeFMV_W_X = 0xf0000053 // fmv.w.x
 	opcodeFMV_D_X = 0xf2000053 // fmv.d.x
@@ -38,6 +42,7 @@ const (
 	opcodeFSD     = 0x00003027 // fsd
 	opcodeFLW     = 0x00002007 // flw
 	opcodeFSW     = 0x00002027 // fsw
+	opcodeOPV     = 0x00000057 // vector
 )
 
 //-----------------------------------------------------------------------------
@@ -97,6 +102,21 @@ func InsEBREAK() uint32 {
 	return uint32(opcodeEBREAK)
 }
 
+// InsCEBREAK returns "c.ebreak"
+func InsCEBREAK() uint32 {
+	return uint32(opcodeCEBREAK)
+}
+
+// InsFENCE returns "fence iorw, iorw"
+func InsFENCE() uint32 {
+	return uint32(opcodeFENCE)
+}
+
+// InsFENCE_I returns "fence.i"
+func InsFENCE_I() uint32 {
+	return uint32(opcodeFENCE_I)
+}
+
 // InsCSRR returns "csrr rd, csr"
 func InsCSRR(rd, csr uint) uint32 {
 	// csrrs rd, csr, x0
@@ -115,6 +135,12 @@ func InsCSRSI(csr, imm uint) uint32 {
 	return uint32((csr << 20) | (util.Bits(imm, 4, 0) << 15) | (RegZero << 7) | opcodeCSRRSI)
 }
 
+// InsCSRCI returns "csrci csr, imm"
+func InsCSRCI(csr, imm uint) uint32 {
+	// csrrci x0, csr, imm
+	return uint32((csr << 20) | (util.Bits(imm, 4, 0) << 15) | (RegZero << 7) | opcodeCSRRCI)
+}
+
 // InsJAL returns "jal rd, ofs"
 func InsJAL(rd, ofs uint) uint32 {
 	offset := (util.Bit(ofs, 20) << 19) |
@@ -155,3 +181,28 @@ func InsFLW(rd, ofs, rs1 uint) uint32 {
 }
 
 //-----------------------------------------------------------------------------
+// vector instructions
+
+// InsVSETVLI returns "vsetvli rd, rs1, vtypei"
+func InsVSETVLI(rd, rs1, vtypei uint) uint32 {
+	return uint32((util.Bits(vtypei, 10, 0) << 20) | (rs1 << 15) | (7 << 12) | (rd << 7) | opcodeOPV)
+}
+
+// InsVSETVL returns "vsetvl rd, rs1, rs2"
+func InsVSETVL(rd, rs1, rs2 uint) uint32 {
+	return uint32((1 << 31) | (rs2 << 20) | (rs1 << 15) | (7 << 12) | (rd << 7) | opcodeOPV)
+}
+
+// InsVMV_X_S returns "vmv.x.s rd, vs2"
+func InsVMV_X_S(rd, vs2 uint) uint32 {
+	// funct6 010000, vm = 1, OPMVV
+	return uint32((0x10 << 26) | (1 << 25) | (vs2 << 20) | (2 << 12) | (rd << 7) | opcodeOPV)
+}
+
+// InsVSLIDE1DOWN_VX returns "vslide1down.vx vd, vs2, rs1"
+func InsVSLIDE1DOWN_VX(vd, vs2, rs1 uint) uint32 {
+	// funct6 001111, vm = 1, OPMVX
+	return uint32((0x0f << 26) | (1 << 25) | (vs2 << 20) | (rs1 << 15) | (6 << 12) | (vd << 7) | opcodeOPV)
+}
+
+//-----------------------------------------------------------------------------
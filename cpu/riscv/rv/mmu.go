@@ -0,0 +1,255 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Virtual Memory
+
+Translate virtual addresses by walking the Sv32/Sv39/Sv48/Sv57 page tables
+from satp. Privileged spec 1.9.1 harts (E.g. K210) have the page table base
+in sptbr (same CSR address as satp) and the translation mode in mstatus.vm.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// PageSize is the base page size for all translation modes.
+const PageSize = 4096
+
+// vmMode describes a virtual memory translation mode.
+type vmMode struct {
+	name    string
+	levels  int  // page table levels
+	vaBits  uint // virtual address bits
+	pteSize uint // bytes per page table entry
+	ppnBits uint // ppn bits in a pte
+}
+
+var sv32 = &vmMode{"sv32", 2, 32, 4, 22}
+var sv39 = &vmMode{"sv39", 3, 39, 8, 44}
+var sv48 = &vmMode{"sv48", 4, 48, 8, 44}
+var sv57 = &vmMode{"sv57", 5, 57, 8, 44}
+
+// vpnBits returns the number of vpn bits per level.
+func (m *vmMode) vpnBits() uint {
+	if m.pteSize == 4 {
+		return 10
+	}
+	return 9
+}
+
+// satpMode returns the translation mode and root page table address from satp.
+func satpMode(satp uint64, sxlen uint) (*vmMode, uint) {
+	if sxlen == 32 {
+		root := uint(util.Bits(uint(satp), 21, 0)) * PageSize
+		if satp&(1<<31) != 0 {
+			return sv32, root
+		}
+		return nil, root
+	}
+	root := uint(util.Bits(uint(satp), 43, 0)) * PageSize
+	switch satp >> 60 {
+	case 8:
+		return sv39, root
+	case 9:
+		return sv48, root
+	case 10:
+		return sv57, root
+	}
+	return nil, root
+}
+
+// vmMode191 returns the translation mode and root page table address for a 1.9.1 hart.
+// The mode is in mstatus.vm, sptbr has the ASID in the upper bits.
+func vmMode191(mstatus, sptbr uint64, sxlen uint) (*vmMode, uint) {
+	var root uint
+	if sxlen == 32 {
+		root = uint(util.Bits(uint(sptbr), 21, 0)) * PageSize
+	} else {
+		root = uint(util.Bits(uint(sptbr), 37, 0)) * PageSize
+	}
+	switch util.Bits(uint(mstatus), 28, 24) {
+	case 8:
+		return sv32, root
+	case 9:
+		return sv39, root
+	case 10:
+		return sv48, root
+	}
+	return nil, root
+}
+
+//-----------------------------------------------------------------------------
+
+// pte bits
+const (
+	pteV = (1 << 0) // valid
+	pteR = (1 << 1) // readable
+	pteW = (1 << 2) // writeable
+	pteX = (1 << 3) // executable
+	pteU = (1 << 4) // user mode
+	pteG = (1 << 5) // global
+	pteA = (1 << 6) // accessed
+	pteD = (1 << 7) // dirty
+)
+
+// pteFlags returns the pte permission bits string.
+func pteFlags(pte uint) string {
+	s := []byte("DAGUXWRV")
+	for i := range s {
+		if pte&(1<<(7-i)) == 0 {
+			s[i] = '-'
+		}
+	}
+	return string(s)
+}
+
+// WalkLevel is a page table level visited while translating an address.
+type WalkLevel struct {
+	Level int  // page table level
+	Addr  uint // pte address
+	PTE   uint // pte value
+	Leaf  bool // leaf pte
+}
+
+func (wl *WalkLevel) String() string {
+	return fmt.Sprintf("level %d: pte 0x%x @ 0x%x %s", wl.Level, wl.PTE, wl.Addr, pteFlags(wl.PTE))
+}
+
+// Walk is the result of an address translation.
+type Walk struct {
+	Mode   string      // translation mode
+	VAddr  uint        // virtual address
+	PAddr  uint        // physical address
+	Levels []WalkLevel // page table levels
+}
+
+func (w *Walk) String() string {
+	s := []string{fmt.Sprintf("%s vaddr 0x%x", w.Mode, w.VAddr)}
+	for i := range w.Levels {
+		s = append(s, w.Levels[i].String())
+	}
+	s = append(s, fmt.Sprintf("paddr 0x%x", w.PAddr))
+	return strings.Join(s, "\n")
+}
+
+// rdPTE reads a page table entry.
+func rdPTE(dbg Debug, addr, size uint) (uint, error) {
+	val, err := dbg.RdMem(size*8, addr, 1)
+	if err != nil {
+		return 0, err
+	}
+	return val[0], nil
+}
+
+// getVMMode returns the translation mode and root page table address for the current hart.
+func getVMMode(dbg Debug) (*vmMode, uint, error) {
+	hi := dbg.GetCurrentHart()
+	if hi.SXLEN == 0 {
+		return nil, 0, fmt.Errorf("hart%d has no s-mode", hi.ID)
+	}
+	satp, err := dbg.RdCSR(SATP, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	var mode *vmMode
+	var root uint
+	if hi.Version == Debug011 {
+		// privileged spec 1.9.1, satp is sptbr and the mode is in mstatus.vm
+		mstatus, err := dbg.RdCSR(MSTATUS, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		mode, root = vmMode191(mstatus, satp, hi.SXLEN)
+	} else {
+		mode, root = satpMode(satp, hi.SXLEN)
+	}
+	if mode == nil {
+		return nil, 0, errors.New("address translation is off (bare mode)")
+	}
+	return mode, root, nil
+}
+
+// Translate walks the page tables to translate a virtual address for the current (halted) hart.
+func Translate(dbg Debug, vaddr uint) (*Walk, error) {
+	mode, a, err := getVMMode(dbg)
+	if err != nil {
+		return nil, err
+	}
+	w := &Walk{Mode: mode.name, VAddr: vaddr}
+
+	// the upper virtual address bits must match the msb
+	if mode.vaBits < 64 && dbg.GetCurrentHart().SXLEN == 64 {
+		upper := vaddr >> (mode.vaBits - 1)
+		if upper != 0 && upper != (util.Mask64>>(mode.vaBits-1)) {
+			return nil, fmt.Errorf("0x%x is not a valid %s address", vaddr, mode.name)
+		}
+	}
+
+	bits := mode.vpnBits()
+	for i := mode.levels - 1; i >= 0; i-- {
+		vpn := (vaddr >> (12 + uint(i)*bits)) & ((1 << bits) - 1)
+		addr := a + vpn*mode.pteSize
+		pte, err := rdPTE(dbg, addr, mode.pteSize)
+		if err != nil {
+			return nil, err
+		}
+		wl := WalkLevel{Level: i, Addr: addr, PTE: pte}
+		if pte&pteV == 0 || (pte&pteR == 0 && pte&pteW != 0) {
+			w.Levels = append(w.Levels, wl)
+			return w, fmt.Errorf("page fault at level %d, invalid pte", i)
+		}
+		ppn := (pte >> 10) & ((1 << mode.ppnBits) - 1)
+		if pte&(pteR|pteX) != 0 {
+			// leaf pte
+			wl.Leaf = true
+			w.Levels = append(w.Levels, wl)
+			// superpages use the virtual address for the lower ppn bits
+			mask := uint(1<<(uint(i)*bits)) - 1
+			if ppn&mask != 0 {
+				return w, fmt.Errorf("page fault at level %d, misaligned superpage", i)
+			}
+			w.PAddr = ((ppn | ((vaddr >> 12) & mask)) * PageSize) | (vaddr & (PageSize - 1))
+			return w, nil
+		}
+		w.Levels = append(w.Levels, wl)
+		a = ppn * PageSize
+	}
+	return w, errors.New("page fault, no leaf pte")
+}
+
+//-----------------------------------------------------------------------------
+
+// Translator translates virtual addresses for the current hart.
+type Translator struct {
+	dbg Debug
+}
+
+// NewTranslator returns a virtual address translator.
+func NewTranslator(dbg Debug) *Translator {
+	return &Translator{dbg: dbg}
+}
+
+// Translate returns the physical address for a virtual address.
+func (t *Translator) Translate(vaddr uint) (uint, error) {
+	hi := t.dbg.GetCurrentHart()
+	if hi.State != Halted {
+		return 0, fmt.Errorf("hart%d is not halted", hi.ID)
+	}
+	w, err := Translate(t.dbg, vaddr)
+	if err != nil {
+		return 0, err
+	}
+	return w.PAddr, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,259 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Physical Memory Protection
+
+Read and decode the PMP configuration. Unimplemented PMP entries are WARL
+read-zero and the lowest numbered entries are implemented first. A zero
+pmpaddr is probed by writing all ones and reading it back (then restoring
+zero), so the entries are read until the first probe that reads back zero.
+A hart without PMP may also trap on the CSR accesses.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	cli "github.com/deadsy/go-cli"
+)
+
+//-----------------------------------------------------------------------------
+
+// PMP CSR addresses.
+const (
+	PMPCFG0  = 0x3a0
+	PMPADDR0 = 0x3b0
+)
+
+const pmpEntries = 64
+
+// PmpMode is the address matching mode of a PMP entry.
+type PmpMode int
+
+// PmpMode values.
+const (
+	PmpOff   PmpMode = iota // disabled
+	PmpTor                  // top of range
+	PmpNa4                  // naturally aligned 4 byte region
+	PmpNapot                // naturally aligned power of 2 region
+)
+
+var pmpModeName = [4]string{"off", "tor", "na4", "napot"}
+
+func (m PmpMode) String() string {
+	return pmpModeName[m&3]
+}
+
+// pmpcfg bits
+const (
+	pmpR = (1 << 0) // readable
+	pmpW = (1 << 1) // writeable
+	pmpX = (1 << 2) // executable
+	pmpL = (1 << 7) // locked
+)
+
+// PmpEntry is a decoded PMP entry.
+type PmpEntry struct {
+	Index int      // entry number
+	Cfg   uint     // pmpcfg byte
+	Addr  uint     // pmpaddr value
+	Mode  PmpMode  // address matching mode
+	Base  uint     // start address of the region
+	End   uint     // end address of the region (exclusive, 0 = top of memory)
+	Notes []string // configuration problems
+}
+
+// Locked returns true if the entry is locked.
+func (e *PmpEntry) Locked() bool {
+	return e.Cfg&pmpL != 0
+}
+
+// Perm returns the permission string for the entry.
+func (e *PmpEntry) Perm() string {
+	s := []byte("rwx")
+	for i := range s {
+		if e.Cfg&(1<<i) == 0 {
+			s[i] = '-'
+		}
+	}
+	return string(s)
+}
+
+// Range returns the address range string for the entry.
+func (e *PmpEntry) Range() string {
+	if e.Mode == PmpOff {
+		return ""
+	}
+	if e.empty() {
+		return "empty"
+	}
+	return fmt.Sprintf("0x%x-0x%x", e.Base, e.End-1)
+}
+
+// empty returns true if the entry matches no addresses.
+func (e *PmpEntry) empty() bool {
+	return e.Mode == PmpTor && e.End <= e.Base
+}
+
+// contains returns true if the entry region contains another entry region.
+func (e *PmpEntry) contains(x *PmpEntry) bool {
+	return x.Base >= e.Base && (e.End == 0 || (x.End != 0 && x.End <= e.End))
+}
+
+// overlaps returns true if the entry region overlaps another entry region.
+func (e *PmpEntry) overlaps(x *PmpEntry) bool {
+	return (e.End == 0 || x.Base < e.End) && (x.End == 0 || e.Base < x.End)
+}
+
+//-----------------------------------------------------------------------------
+
+// decode decodes the address range of a PMP entry.
+func (e *PmpEntry) decode(prev uint) {
+	e.Mode = PmpMode((e.Cfg >> 3) & 3)
+	switch e.Mode {
+	case PmpTor:
+		e.Base = prev << 2
+		e.End = e.Addr << 2
+	case PmpNa4:
+		e.Base = e.Addr << 2
+		e.End = e.Base + 4
+	case PmpNapot:
+		n := uint(bits.TrailingZeros(^e.Addr))
+		if n+3 >= 64 {
+			// all of memory
+			e.Base = 0
+			e.End = 0
+			break
+		}
+		e.Base = (e.Addr &^ ((1 << n) - 1)) << 2
+		e.End = e.Base + (8 << n)
+	}
+}
+
+// check flags problems with the enabled PMP entries.
+func pmpCheck(pmp []PmpEntry) {
+	for i := range pmp {
+		e := &pmp[i]
+		if e.Mode == PmpOff {
+			continue
+		}
+		if e.Cfg&(pmpW|pmpR) == pmpW {
+			e.Notes = append(e.Notes, "reserved w without r")
+		}
+		if e.empty() {
+			e.Notes = append(e.Notes, "tor range is empty")
+			continue
+		}
+		// the lowest numbered matching entry has priority
+		for j := 0; j < i; j++ {
+			x := &pmp[j]
+			if x.Mode == PmpOff || x.empty() {
+				continue
+			}
+			if x.contains(e) {
+				e.Notes = append(e.Notes, fmt.Sprintf("shadowed by %d", x.Index))
+				break
+			}
+			if x.overlaps(e) {
+				e.Notes = append(e.Notes, fmt.Sprintf("overlaps %d", x.Index))
+			}
+		}
+	}
+}
+
+// pmpProbe returns true if the (zero valued) pmpaddr register is implemented.
+func pmpProbe(dbg Debug, i int) (bool, error) {
+	reg := PMPADDR0 + uint(i)
+	err := dbg.WrCSR(reg, 0, ^uint64(0))
+	if err != nil {
+		return false, err
+	}
+	x, err := dbg.RdCSR(reg, 0)
+	if err != nil {
+		return false, err
+	}
+	// restore the original value
+	err = dbg.WrCSR(reg, 0, 0)
+	if err != nil {
+		return false, err
+	}
+	return x != 0, nil
+}
+
+// GetPmp reads and decodes the PMP entries of the current (halted) hart.
+func GetPmp(dbg Debug) ([]PmpEntry, error) {
+	hi := dbg.GetCurrentHart()
+	// pmpcfg registers hold MXLEN/8 entries (only even registers for RV64)
+	k := int(hi.MXLEN / 8)
+	pmp := []PmpEntry{}
+	var cfg uint64
+	var prev uint
+	for i := 0; i < pmpEntries; i++ {
+		if i%k == 0 {
+			var err error
+			cfg, err = dbg.RdCSR(PMPCFG0+uint(i/4), 0)
+			if err != nil {
+				break
+			}
+		}
+		addr, err := dbg.RdCSR(PMPADDR0+uint(i), 0)
+		if err != nil {
+			break
+		}
+		e := PmpEntry{
+			Index: i,
+			Cfg:   uint(cfg>>(8*uint(i%k))) & 0xff,
+			Addr:  uint(addr),
+		}
+		// a locked entry ignores writes, but it is implemented
+		if addr == 0 && !e.Locked() {
+			ok, err := pmpProbe(dbg, i)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+		}
+		e.decode(prev)
+		pmp = append(pmp, e)
+		prev = e.Addr
+	}
+	if len(pmp) == 0 {
+		return nil, fmt.Errorf("hart%d has no pmp entries", hi.ID)
+	}
+	pmpCheck(pmp)
+	return pmp, nil
+}
+
+// PmpString returns a decoded display string for the PMP entries.
+func PmpString(pmp []PmpEntry, all bool) string {
+	s := [][]string{{"entry", "mode", "lock", "perm", "range", "pmpaddr", "notes"}}
+	for i := range pmp {
+		e := &pmp[i]
+		if e.Mode == PmpOff && !all {
+			continue
+		}
+		lock := ""
+		if e.Locked() {
+			lock = "L"
+		}
+		s = append(s, []string{
+			fmt.Sprintf("%d", e.Index),
+			e.Mode.String(),
+			lock,
+			e.Perm(),
+			e.Range(),
+			fmt.Sprintf("0x%x", e.Addr),
+			strings.Join(e.Notes, ", "),
+		})
+	}
+	return cli.TableString(s, []int{0, 0, 0, 0, 0, 0, 0}, 1)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,190 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Single Stepping
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"errors"
+	"time"
+
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// dcsr bits
+const (
+	dcsrStep    = (1 << 2)
+	dcsrStepie  = (1 << 11)
+	dcsrEbreakU = (1 << 12)
+	dcsrEbreakS = (1 << 13)
+	dcsrEbreakM = (1 << 15)
+)
+
+// SetEbreak sets dcsr on the current (halted) hart so ebreak instructions enter debug mode.
+func SetEbreak(dbg Debug, hi *HartInfo) error {
+	dcsr, err := dbg.RdCSR(DCSR, 0)
+	if err != nil {
+		return err
+	}
+	x := dcsr | dcsrEbreakM
+	if hi.SXLEN != 0 {
+		x |= dcsrEbreakS
+	}
+	if hi.UXLEN != 0 {
+		x |= dcsrEbreakU
+	}
+	if x == dcsr {
+		return nil
+	}
+	return dbg.WrCSR(DCSR, 0, x)
+}
+
+const stepTimeout = 100 * time.Millisecond
+
+// waitHalt waits for the current hart to halt.
+func waitHalt(dbg Debug, to time.Duration) (bool, error) {
+	t := time.Now().Add(to)
+	for {
+		state, err := dbg.GetHartState()
+		if err != nil {
+			return false, err
+		}
+		if state == Halted {
+			return true, nil
+		}
+		if !t.After(time.Now()) {
+			return false, nil
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+// singleStep executes a single instruction on the current (halted) hart.
+// If stepie is false interrupts are masked during the step.
+func singleStep(dbg Debug, stepie bool) error {
+	dcsr, err := dbg.RdCSR(DCSR, 0)
+	if err != nil {
+		return err
+	}
+	// set the step bit
+	x := (dcsr | dcsrStep) &^ dcsrStepie
+	if stepie {
+		x |= dcsrStepie
+	}
+	err = dbg.WrCSR(DCSR, 0, x)
+	if err != nil {
+		return err
+	}
+	// resume, the hart will execute one instruction and re-enter debug mode
+	err = dbg.ResumeHart()
+	if err != nil {
+		return err
+	}
+	// wait for the re-halt
+	halted, err := waitHalt(dbg, stepTimeout)
+	if err != nil {
+		return err
+	}
+	if !halted {
+		// the step didn't complete (e.g. wfi), halt the hart
+		err = dbg.HaltHart()
+		if err != nil {
+			return err
+		}
+	}
+	// Debug entry updates dcsr.prv and dcsr.cause so re-read dcsr.
+	// Clear the step bit and restore the original stepie bit.
+	x, err = dbg.RdCSR(DCSR, 0)
+	if err != nil {
+		return err
+	}
+	x = (x &^ (dcsrStep | dcsrStepie)) | (dcsr & dcsrStepie)
+	err = dbg.WrCSR(DCSR, 0, x)
+	if err != nil {
+		return err
+	}
+	if !halted {
+		return errors.New("single step did not complete")
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// isCall returns the length of a call (jal/jalr/c.jal/c.jalr) instruction, 0 if it's not a call.
+func isCall(ins, xlen uint) uint {
+	if ins&3 != 3 {
+		// compressed instruction
+		ins &= 0xffff
+		// c.jal (rv32 only)
+		if xlen == 32 && ins&0xe003 == 0x2001 {
+			return 2
+		}
+		// c.jalr (rs1 != 0, c.ebreak otherwise)
+		if ins&0xf07f == 0x9002 && util.Bits(ins, 11, 7) != 0 {
+			return 2
+		}
+		return 0
+	}
+	// jal/jalr with a link register
+	rd := util.Bits(ins, 11, 7)
+	if rd != RegRa && rd != RegT0 {
+		return 0
+	}
+	switch ins & 0x7f {
+	case 0x6f, 0x67:
+		return 4
+	}
+	return 0
+}
+
+// RdIns reads 32 bits at an instruction address with any software breakpoints removed.
+func (b *Breakpoints) RdIns(dbg Debug, addr uint) (uint, error) {
+	// For a compressed instruction stream we may be reading 32-bit
+	// values with 16-bit alignment. Some chips don't allow this for
+	// data read access, so we always read 2 x 16-bit values.
+	x, err := dbg.RdMem(16, addr, 2)
+	if err != nil {
+		return 0, err
+	}
+	for _, bp := range b.bp {
+		if bp.trigger != nil {
+			continue
+		}
+		switch bp.Addr {
+		case addr:
+			x[0] = bp.orig & 0xffff
+			if bp.width == 32 {
+				x[1] = bp.orig >> 16
+			}
+		case addr + 2:
+			x[1] = bp.orig & 0xffff
+		}
+	}
+	return (x[1] << 16) | x[0], nil
+}
+
+// CallReturn returns the return address if the instruction at the pc is a call.
+func (b *Breakpoints) CallReturn(dbg Debug) (uint, bool, error) {
+	pc, err := dbg.RdCSR(DPC, 0)
+	if err != nil {
+		return 0, false, err
+	}
+	ins, err := b.RdIns(dbg, uint(pc))
+	if err != nil {
+		return 0, false, err
+	}
+	n := isCall(ins, b.hi.MXLEN)
+	if n == 0 {
+		return 0, false, nil
+	}
+	return uint(pc) + n, true, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,156 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Traps
+
+Read and decode the machine and supervisor mode trap CSRs.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"fmt"
+
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+var exceptionName = map[uint]string{
+	0:  "instruction address misaligned",
+	1:  "instruction access fault",
+	2:  "illegal instruction",
+	3:  "breakpoint",
+	4:  "load address misaligned",
+	5:  "load access fault",
+	6:  "store/amo address misaligned",
+	7:  "store/amo access fault",
+	8:  "environment call from u-mode",
+	9:  "environment call from s-mode",
+	10: "environment call from vs-mode",
+	11: "environment call from m-mode",
+	12: "instruction page fault",
+	13: "load page fault",
+	15: "store/amo page fault",
+	16: "double trap",
+	18: "software check",
+	19: "hardware error",
+	20: "instruction guest-page fault",
+	21: "load guest-page fault",
+	22: "virtual instruction",
+	23: "store/amo guest-page fault",
+}
+
+var interruptName = map[uint]string{
+	1:  "supervisor software interrupt",
+	2:  "virtual supervisor software interrupt",
+	3:  "machine software interrupt",
+	5:  "supervisor timer interrupt",
+	6:  "virtual supervisor timer interrupt",
+	7:  "machine timer interrupt",
+	9:  "supervisor external interrupt",
+	10: "virtual supervisor external interrupt",
+	11: "machine external interrupt",
+	12: "supervisor guest external interrupt",
+	13: "counter overflow interrupt",
+}
+
+// CauseName returns the name of a trap cause.
+func CauseName(interrupt bool, code uint) string {
+	if interrupt {
+		if s, ok := interruptName[code]; ok {
+			return s
+		}
+		if code >= 16 {
+			return fmt.Sprintf("local interrupt %d", code)
+		}
+		return fmt.Sprintf("reserved interrupt %d", code)
+	}
+	if s, ok := exceptionName[code]; ok {
+		return s
+	}
+	if code >= 24 && code <= 31 || code >= 48 && code <= 63 {
+		return fmt.Sprintf("custom exception %d", code)
+	}
+	return fmt.Sprintf("reserved exception %d", code)
+}
+
+// tvalAddress returns true if the tval for an exception is a memory address.
+func tvalAddress(code uint) bool {
+	switch code {
+	case 0, 1, 3, 4, 5, 6, 7, 12, 13, 15, 20, 21, 23:
+		return true
+	}
+	return false
+}
+
+var privName = [4]string{"u", "s", "h", "m"}
+
+//-----------------------------------------------------------------------------
+
+// Trap is the decoded trap state for a privilege mode.
+type Trap struct {
+	Mode      string // trap handling mode (m or s)
+	Interrupt bool   // the trap was an interrupt
+	Code      uint   // exception/interrupt code (xcause bits 11:0)
+	Cause     uint   // xcause value
+	EPC       uint   // xepc value
+	TVAL      uint   // xtval value
+	PrevPriv  string // privilege mode before the trap (xPP)
+	PrevIE    bool   // interrupt enable before the trap (xPIE)
+}
+
+// Name returns the name of the trap cause.
+func (t *Trap) Name() string {
+	return CauseName(t.Interrupt, t.Code)
+}
+
+// TvalAddress returns true if the trap value is a memory address.
+func (t *Trap) TvalAddress() bool {
+	return !t.Interrupt && tvalAddress(t.Code)
+}
+
+// GetTrap reads the trap CSRs for machine or supervisor mode from the current (halted) hart.
+func GetTrap(dbg Debug, supervisor bool) (*Trap, error) {
+	hi := dbg.GetCurrentHart()
+	regs := []uint{MCAUSE, MEPC, MTVAL, MSTATUS}
+	xlen := hi.MXLEN
+	mode := "m"
+	if supervisor {
+		if hi.SXLEN == 0 {
+			return nil, fmt.Errorf("hart%d has no s-mode", hi.ID)
+		}
+		regs = []uint{SCAUSE, SEPC, STVAL, SSTATUS}
+		xlen = hi.SXLEN
+		mode = "s"
+	}
+	val := make([]uint, len(regs))
+	for i, reg := range regs {
+		x, err := dbg.RdCSR(reg, 0)
+		if err != nil {
+			return nil, err
+		}
+		val[i] = uint(x)
+	}
+	// the code is the low 12 bits (e.g. the eclic keeps other state in bits xlen-2:12)
+	t := &Trap{
+		Mode:      mode,
+		Interrupt: util.Bit(val[0], xlen-1) != 0,
+		Code:      util.Bits(val[0], 11, 0),
+		Cause:     val[0],
+		EPC:       val[1],
+		TVAL:      val[2],
+	}
+	if supervisor {
+		t.PrevPriv = privName[util.Bits(val[3], 8, 8)]
+		t.PrevIE = util.Bit(val[3], 5) != 0
+	} else {
+		t.PrevPriv = privName[util.Bits(val[3], 12, 11)]
+		t.PrevIE = util.Bit(val[3], 7) != 0
+	}
+	return t, nil
+}
+
+//-----------------------------------------------------------------------------
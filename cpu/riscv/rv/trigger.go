@@ -0,0 +1,212 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Trigger Module
+
+The trigger module is accessed through the tselect/tdata1/tdata2/tinfo CSRs.
+It provides the address match triggers used for hardware breakpoints and
+watchpoints.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import (
+	"fmt"
+
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// tdata1.type values
+const (
+	triggerNone      = 0  // no trigger at this tselect
+	triggerLegacy    = 1  // legacy SiFive address match
+	triggerMcontrol  = 2  // address/data match (0.13)
+	triggerIcount    = 3  // instruction count
+	triggerItrigger  = 4  // interrupt
+	triggerEtrigger  = 5  // exception
+	triggerMcontrol6 = 6  // address/data match (1.0)
+	triggerTmext     = 7  // external trigger
+	triggerDisabled  = 15 // trigger exists but is disabled
+)
+
+var triggerName = map[uint]string{
+	triggerLegacy:    "legacy",
+	triggerMcontrol:  "mcontrol",
+	triggerIcount:    "icount",
+	triggerItrigger:  "itrigger",
+	triggerEtrigger:  "etrigger",
+	triggerMcontrol6: "mcontrol6",
+	triggerTmext:     "tmexttrigger",
+	triggerDisabled:  "disabled",
+}
+
+// maxTriggers is a sanity limit on trigger enumeration.
+const maxTriggers = 32
+
+// mcontrol/mcontrol6 common bit fields
+const (
+	mcLoad    = (1 << 0)
+	mcStore   = (1 << 1)
+	mcExecute = (1 << 2)
+	mcU       = (1 << 3)
+	mcS       = (1 << 4)
+	mcM       = (1 << 6)
+	mcAction  = (1 << 12) // action = 1, enter debug mode
+)
+
+//-----------------------------------------------------------------------------
+
+// trigger stores the state of a trigger module trigger.
+type trigger struct {
+	index uint        // tselect value for this trigger
+	types uint        // bitmap of supported trigger types
+	bp    *Breakpoint // breakpoint using this trigger (nil == free)
+}
+
+func (t *trigger) String() string {
+	s := []string{}
+	for i := uint(0); i < 16; i++ {
+		if t.types&(1<<i) != 0 {
+			if name, ok := triggerName[i]; ok {
+				s = append(s, name)
+			} else {
+				s = append(s, fmt.Sprintf("type%d", i))
+			}
+		}
+	}
+	return fmt.Sprintf("trigger%d %v", t.index, s)
+}
+
+// canMatch returns true if the trigger supports address matching.
+func (t *trigger) canMatch() bool {
+	return t.types&((1<<triggerMcontrol)|(1<<triggerMcontrol6)) != 0
+}
+
+// tdataType returns the type field of a tdata1 value.
+func tdataType(x uint64, xlen uint) uint {
+	return util.Bits(uint(x>>(xlen-4)), 3, 0)
+}
+
+// mcontrol returns a tdata1 value for an address match trigger.
+func mcontrol(hi *HartInfo, typ uint, bt BreakType) uint64 {
+	xlen := hi.MXLEN
+	x := uint64(typ) << (xlen - 4)
+	// only debug mode can write the trigger
+	x |= 1 << (xlen - 5)
+	// enter debug mode on match, match on all modes
+	x |= mcAction | mcM
+	if hi.SXLEN != 0 {
+		x |= mcS
+	}
+	if hi.UXLEN != 0 {
+		x |= mcU
+	}
+	switch bt {
+	case BreakExecute:
+		x |= mcExecute
+	case BreakLoad:
+		x |= mcLoad
+	case BreakStore:
+		x |= mcStore
+	}
+	return x
+}
+
+//-----------------------------------------------------------------------------
+
+// probeTriggers enumerates the triggers for the current hart.
+func probeTriggers(dbg Debug, hi *HartInfo) ([]*trigger, error) {
+	tl := []*trigger{}
+	for i := uint(0); i < maxTriggers; i++ {
+		// select the trigger, an exception means no trigger module
+		err := dbg.WrCSR(TSELECT, 0, uint64(i))
+		if err != nil {
+			break
+		}
+		x, err := dbg.RdCSR(TSELECT, 0)
+		if err != nil {
+			break
+		}
+		// no such trigger
+		if x != uint64(i) {
+			break
+		}
+		// tinfo is optional, fallback to tdata1.type
+		var types uint
+		x, err = dbg.RdCSR(TINFO, 0)
+		if err == nil {
+			types = util.Bits(uint(x), 15, 0)
+		} else {
+			x, err = dbg.RdCSR(TDATA1, 0)
+			if err != nil {
+				return nil, err
+			}
+			typ := tdataType(x, hi.MXLEN)
+			types = 1 << typ
+			if typ == triggerDisabled {
+				// we don't know, so try both address match types
+				types = (1 << triggerMcontrol) | (1 << triggerMcontrol6)
+			}
+		}
+		if types == 1<<triggerNone {
+			break
+		}
+		tl = append(tl, &trigger{index: i, types: types})
+	}
+	return tl, nil
+}
+
+// set programs the trigger as an address match.
+func (t *trigger) set(dbg Debug, hi *HartInfo, bt BreakType, addr uint) error {
+	err := dbg.WrCSR(TSELECT, 0, uint64(t.index))
+	if err != nil {
+		return err
+	}
+	// disable the trigger while we change tdata2
+	err = dbg.WrCSR(TDATA1, 0, 0)
+	if err != nil {
+		return err
+	}
+	err = dbg.WrCSR(TDATA2, 0, uint64(addr))
+	if err != nil {
+		return err
+	}
+	// try the supported address match types, newest first
+	for _, typ := range []uint{triggerMcontrol6, triggerMcontrol} {
+		if t.types&(1<<typ) == 0 {
+			continue
+		}
+		val := mcontrol(hi, typ, bt)
+		err = dbg.WrCSR(TDATA1, 0, val)
+		if err != nil {
+			return err
+		}
+		// read back to check the WARL fields stuck
+		x, err := dbg.RdCSR(TDATA1, 0)
+		if err != nil {
+			return err
+		}
+		mask := uint64(mcAction | mcExecute | mcStore | mcLoad)
+		if tdataType(x, hi.MXLEN) == typ && x&mask == val&mask {
+			return nil
+		}
+	}
+	// leave it disabled
+	dbg.WrCSR(TDATA1, 0, 0)
+	return fmt.Errorf("trigger%d does not support %s address match", t.index, bt)
+}
+
+// clr disables the trigger.
+func (t *trigger) clr(dbg Debug) error {
+	err := dbg.WrCSR(TSELECT, 0, uint64(t.index))
+	if err != nil {
+		return err
+	}
+	return dbg.WrCSR(TDATA1, 0, 0)
+}
+
+//-----------------------------------------------------------------------------
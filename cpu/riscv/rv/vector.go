@@ -0,0 +1,90 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Vector Extension
+
+Vector CSR decodes and helpers for accessing the vector registers.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv
+
+import "github.com/deadsy/rvdbg/soc"
+
+//-----------------------------------------------------------------------------
+
+// vectorRegisters returns the vector CSR decodes.
+func vectorRegisters(xlen uint) []soc.Register {
+	return []soc.Register{
+		{Offset: VSTART, Name: "vstart"},
+		{Offset: VXSAT, Name: "vxsat"},
+		{Offset: VXRM, Name: "vxrm"},
+		{Offset: VCSR,
+			Name: "vcsr",
+			Fields: []soc.Field{
+				{Name: "vxrm", Msb: 2, Lsb: 1},
+				{Name: "vxsat", Msb: 0, Lsb: 0},
+			},
+		},
+		{Offset: VL, Name: "vl"},
+		{Offset: VTYPE,
+			Name: "vtype",
+			Fields: []soc.Field{
+				{Name: "vill", Msb: xlen - 1, Lsb: xlen - 1},
+				{Name: "vma", Msb: 7, Lsb: 7},
+				{Name: "vta", Msb: 6, Lsb: 6},
+				{Name: "vsew", Msb: 5, Lsb: 3, Enums: soc.Enum{0: "e8", 1: "e16", 2: "e32", 3: "e64"}},
+				{Name: "vlmul", Msb: 2, Lsb: 0, Enums: soc.Enum{0: "m1", 1: "m2", 2: "m4", 3: "m8", 5: "mf8", 6: "mf4", 7: "mf2"}},
+			},
+		},
+		{Offset: VLENB, Name: "vlenb"},
+	}
+}
+
+// VectorNames are the vector CSR names (in display order).
+var VectorNames = []string{"vtype", "vl", "vlenb", "vstart", "vxrm", "vxsat", "vcsr"}
+
+//-----------------------------------------------------------------------------
+
+// mstatus.vs field
+const mstatusVS = (3 << 9)
+const mstatusVSInitial = (1 << 9)
+
+// VectorOp runs a function with the vector unit of the current (halted) hart enabled.
+// Vector instructions and CSR accesses trap if mstatus.vs is off.
+func VectorOp(dbg Debug, f func() error) error {
+	mstatus, err := dbg.RdCSR(MSTATUS, 0)
+	if err != nil {
+		return err
+	}
+	if mstatus&mstatusVS != 0 {
+		return f()
+	}
+	err = dbg.WrCSR(MSTATUS, 0, mstatus|mstatusVSInitial)
+	if err != nil {
+		return err
+	}
+	err = f()
+	// restore mstatus.vs
+	rerr := dbg.WrCSR(MSTATUS, 0, mstatus)
+	if err != nil {
+		return err
+	}
+	return rerr
+}
+
+// VtypeSEW returns a vtype value for a selected element width and LMUL = 1.
+func VtypeSEW(sew uint) uint {
+	switch sew {
+	case 16:
+		return 1 << 3
+	case 32:
+		return 2 << 3
+	case 64:
+		return 3 << 3
+	}
+	return 0
+}
+
+//-----------------------------------------------------------------------------
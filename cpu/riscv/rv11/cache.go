@@ -238,4 +238,13 @@ func (cache *ramCache) reset() error {
 	return cache.flush(false)
 }
 
+// sync reads the debug ram into the cache.
+func (cache *ramCache) sync() error {
+	for i := range cache.entry {
+		cache.entry[i].wr = false
+		cache.read(uint(i))
+	}
+	return cache.flush(false)
+}
+
 //-----------------------------------------------------------------------------
@@ -12,9 +12,11 @@ package rv11
 
 import (
 	"fmt"
+	"strings"
 
 	cli "github.com/deadsy/go-cli"
 	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/util"
 )
 
 //-----------------------------------------------------------------------------
@@ -26,18 +28,69 @@ type target interface {
 
 //-----------------------------------------------------------------------------
 
+// cacheHelp is help for the debug ram cache command.
+var cacheHelp = []cli.Help{
+	{"<cr>", "display the debug ram cache"},
+	{"reset", "reset the debug ram and cache"},
+	{"sync", "read the debug ram into the cache"},
+}
+
 var cmdCache = cli.Leaf{
-	Descr: "display debug ram cache state",
+	Descr: "display/sync debug ram cache state",
 	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
 		dbg := c.User.(target).GetRiscvDebug().(*Debug)
+		if len(args) == 1 {
+			switch args[0] {
+			case "reset":
+				err = dbg.cache.reset()
+			case "sync":
+				err = dbg.cache.sync()
+			default:
+				err = fmt.Errorf("unknown cache operation \"%s\"", args[0])
+			}
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+		}
 		c.User.Put(fmt.Sprintf("%s\n", dbg.cache.String()))
 	},
 }
 
+// dbusHelp is help for the dbus register command.
+var dbusHelp = []cli.Help{
+	{"<cr>", "display the dbus registers"},
+	{"<reg> <val>", "write a dbus register (hex value)"},
+}
+
 var cmdDbus = cli.Leaf{
-	Descr: "display dbus registers",
+	Descr: "display/write dbus registers",
 	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 2})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
 		dbg := c.User.(target).GetRiscvDebug().(*Debug)
+		if len(args) == 2 {
+			val, err := cli.UintArg(strings.TrimPrefix(args[1], "0x"), [2]uint{0, util.Mask34}, 16)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			s, err := dbg.dbusWrite(strings.ToLower(args[0]), val)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("unable to write dbus register: %v\n", err))
+				return
+			}
+			c.User.Put(fmt.Sprintf("%s\n", s))
+			return
+		}
 		dump, err := dbg.dbusDump()
 		if err != nil {
 			c.User.Put(fmt.Sprintf("unable to get dbus registers: %v\n", err))
@@ -56,8 +109,8 @@ var cmdInfo = cli.Leaf{
 
 // Menu debug submenu items
 var Menu = cli.Menu{
-	{"cache", cmdCache},
-	{"dbus", cmdDbus},
+	{"cache", cmdCache, cacheHelp},
+	{"dbus", cmdDbus, dbusHelp},
 	{"info", cmdInfo},
 }
 
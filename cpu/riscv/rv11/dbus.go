@@ -340,7 +340,7 @@ func (drv *dbusDriver) Rd(width, addr uint) (uint, error) {
 }
 
 func (drv *dbusDriver) Wr(width, addr, val uint) error {
-	return errors.New("TODO")
+	return drv.dbg.wrDbus(addr, val)
 }
 
 func (dbg *Debug) dbusDump() (string, error) {
@@ -349,6 +349,21 @@ func (dbg *Debug) dbusDump() (string, error) {
 	return p.Display(drv, nil, true), nil
 }
 
+// dbusWrite writes a dbus register by name and returns the new register decode.
+func (dbg *Debug) dbusWrite(name string, val uint) (string, error) {
+	p, _ := dbg.dbusDevice.GetPeripheral("DBUS")
+	r, err := p.GetRegister(name)
+	if err != nil {
+		return "", err
+	}
+	drv := &dbusDriver{dbg}
+	err = r.Wr(drv, 0, val)
+	if err != nil {
+		return "", err
+	}
+	return p.Display(drv, r, true), nil
+}
+
 //-----------------------------------------------------------------------------
 
 // wrOps32 runs a series of 32-bit write operations.
@@ -14,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/deadsy/rvda"
 	"github.com/deadsy/rvdbg/cpu/riscv/rv"
@@ -22,38 +23,141 @@ import (
 )
 
 //-----------------------------------------------------------------------------
-// halt a hart
+// hart state
+
+// The debug rom sets haltnot when the hart halts, the debugger clears it when
+// the hart is resumed. The interrupt bit is set by the debugger to run the debug
+// ram program and is cleared by the debug rom when the hart takes the interrupt.
+
+const haltTimeout = 100 * time.Millisecond
+const dcsrHalt = (1 << 3)
+
+// hartState returns the haltnot and interrupt bits for the currently selected hart.
+func (dbg *Debug) hartState() (bool, bool, error) {
+	x, err := dbg.rdDbus(dmcontrol)
+	if err != nil {
+		return false, false, err
+	}
+	return x&haltNotification != 0, x&debugInterrupt != 0, nil
+}
 
 // isHalted returns true if the currently selected hart is halted.
 func (dbg *Debug) isHalted() (bool, error) {
-	return false, errors.New("TODO")
+	haltnot, interrupt, err := dbg.hartState()
+	return haltnot && !interrupt, err
+}
+
+// isRunning returns true if the currently selected hart is running.
+func (dbg *Debug) isRunning() (bool, error) {
+	haltnot, interrupt, err := dbg.hartState()
+	return !haltnot && !interrupt, err
+}
+
+// waitState waits for the current hart to reach a state.
+func (dbg *Debug) waitState(state func() (bool, error)) (bool, error) {
+	t := time.Now().Add(haltTimeout)
+	for t.After(time.Now()) {
+		ok, err := state()
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	return false, nil
+}
+
+// anyHalted returns true if any hart has haltnot set.
+func (dbg *Debug) anyHalted() (bool, error) {
+	if dbg.haltsum {
+		// each haltsum bit summarises the haltnot bits for 32 harts
+		x, err := dbg.rdDbus(haltsum)
+		if err != nil {
+			return false, err
+		}
+		return x&util.Mask32 != 0, nil
+	}
+	halted := false
+	err := rv.AllHarts(dbg, func() error {
+		haltnot, _, err := dbg.hartState()
+		halted = halted || haltnot
+		return err
+	})
+	return halted, err
 }
 
+//-----------------------------------------------------------------------------
+// halt a hart
+
 // halt the current hart, return true if it was already halted.
 func (dbg *Debug) halt() (bool, error) {
-	dbg.cache.wr32(0, rv.InsCSRSI(rv.DCSR, 1<<3 /*halt*/))
+	halted, err := dbg.isHalted()
+	if err != nil {
+		return false, err
+	}
+	if halted {
+		return true, nil
+	}
+	dbg.cache.wr32(0, rv.InsCSRSI(rv.DCSR, dcsrHalt))
 	dbg.cache.wr32(1, rv.InsCSRR(rv.RegS0, rv.MHARTID))
 	dbg.cache.wr32(2, rv.InsSW(rv.RegS0, debugSetHaltNotification, rv.RegZero))
 	dbg.cache.wrResume(3)
 	// run the code
-	err := dbg.cache.flush(true)
-	return true, err
+	err = dbg.cache.flush(true)
+	if err != nil {
+		return false, err
+	}
+	// wait for the halt notification
+	halted, err = dbg.waitState(dbg.isHalted)
+	if err != nil {
+		return false, err
+	}
+	if !halted {
+		return false, fmt.Errorf("hart%d did not halt", dbg.hartid)
+	}
+	return false, nil
 }
 
 //-----------------------------------------------------------------------------
 // resume a hart
 
-// isRunning returns true if the currently selected hart is running.
-func (dbg *Debug) isRunning() (bool, error) {
-	return false, errors.New("TODO")
-}
-
 // resume the current hart, return true if it was already running.
 func (dbg *Debug) resume() (bool, error) {
-
+	running, err := dbg.isRunning()
+	if err != nil {
+		return false, err
+	}
+	if running {
+		return true, nil
+	}
+	// Clear haltnot before resuming. If dcsr.step is set the hart will re-halt
+	// after one instruction and the debug rom will set it again.
+	err = dbg.clrDbus(dmcontrol, haltNotification)
+	if err != nil {
+		return false, err
+	}
+	// clear dcsr.halt and return from the debug rom
+	dbg.cache.wr32(0, rv.InsCSRCI(rv.DCSR, dcsrHalt))
+	dbg.cache.wrResume(1)
+	// run the code
+	err = dbg.cache.flush(true)
+	if err != nil {
+		return false, err
+	}
+	// wait for the hart to take the interrupt and leave the debug rom
+	ok, err := dbg.waitState(func() (bool, error) {
+		_, interrupt, err := dbg.hartState()
+		return !interrupt, err
+	})
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("hart%d did not resume", dbg.hartid)
+	}
 	return false, nil
-
-	//return false, errors.New("TODO")
 }
 
 //-----------------------------------------------------------------------------
@@ -197,7 +301,12 @@ func (dbg *Debug) getHXLEN(hi *hartInfo) (uint, error) {
 	if hi.info.MXLEN == 32 {
 		return 32, nil
 	}
-	return 0, errors.New("TODO")
+	// The hypervisor runs in HS-mode, so HSXLEN is the same as SXLEN.
+	if hi.info.SXLEN == 0 {
+		log.Info.Printf("hart%d: misa indicates h-mode, but there is no s-mode", hi.info.ID)
+		return hi.info.MXLEN, nil
+	}
+	return hi.info.SXLEN, nil
 }
 
 // getFLEN returns the FPR length for the current hart.
@@ -421,6 +530,8 @@ func (dbg *Debug) newHart(id int) *hartInfo {
 		dbg: dbg,
 	}
 	hi.info.ID = id
+	hi.info.CsrExt = dbg.csrExt
+	hi.info.Version = rv.Debug011
 	hi.info.Nregs = 32
 	return hi
 }
@@ -9,6 +9,7 @@ RISC-V Debugger 0.11 Register Operations
 package rv11
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/deadsy/rvdbg/cpu/riscv/rv"
@@ -96,3 +97,16 @@ func (dbg *Debug) WrFPR(reg, size uint, val uint64) error {
 }
 
 //-----------------------------------------------------------------------------
+// vector registers
+
+// RdVPR reads a vector register.
+func (dbg *Debug) RdVPR(reg uint) ([]uint, error) {
+	return nil, errors.New("vector registers are not supported by the 0.11 debugger")
+}
+
+// WrVPR writes a vector register.
+func (dbg *Debug) WrVPR(reg uint, val []uint) error {
+	return errors.New("vector registers are not supported by the 0.11 debugger")
+}
+
+//-----------------------------------------------------------------------------
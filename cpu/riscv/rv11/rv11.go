@@ -12,6 +12,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	cli "github.com/deadsy/go-cli"
 	"github.com/deadsy/rvdbg/bitstr"
@@ -34,17 +35,20 @@ const irDbus = 0x11 // debug bus access
 // Debug is a RISC-V 0.11 debugger. It implements the rv.Debug interface.
 type Debug struct {
 	dev          *jtag.Device
-	dbusDevice   *soc.Device // dbus device for decode/display
-	cache        *ramCache   // cache of debug ram words
-	hart         []*hartInfo // implemented harts
-	hartid       int         // currently selected hart
-	ir           uint        // cache of ir value
-	irlen        int         // IR length
-	drDbusLength int         // DR length for dbus
-	abits        uint        // address bits in dtmcontrol
-	idle         uint        // idle value in dtmcontrol
-	dramsize     uint        // number of debug ram words implemented
-	dbusops      uint        // running count of total dbus operations
+	csrExt       rv.CsrExtension // vendor specific CSRs
+	dbusDevice   *soc.Device     // dbus device for decode/display
+	cache        *ramCache       // cache of debug ram words
+	hart         []*hartInfo     // implemented harts
+	hartid       int             // currently selected hart
+	ir           uint            // cache of ir value
+	resets       int             // chain TAP resets at the last IR write
+	irlen        int             // IR length
+	drDbusLength int             // DR length for dbus
+	abits        uint            // address bits in dtmcontrol
+	idle         uint            // idle value in dtmcontrol
+	dramsize     uint            // number of debug ram words implemented
+	haltsum      bool            // is the haltsum register implemented?
+	dbusops      uint            // running count of total dbus operations
 }
 
 func (dbg *Debug) String() string {
@@ -52,15 +56,17 @@ func (dbg *Debug) String() string {
 	s = append(s, []string{"version", "0.11"})
 	s = append(s, []string{"idle cycles", fmt.Sprintf("%d", dbg.idle)})
 	s = append(s, []string{"dramsize", fmt.Sprintf("%d words", dbg.dramsize)})
+	s = append(s, []string{"haltsum", fmt.Sprintf("%t", dbg.haltsum)})
 	s = append(s, []string{"dbusops", fmt.Sprintf("%d", dbg.dbusops)})
 	return cli.TableString(s, []int{0, 0}, 1)
 }
 
 // New returns a RISC-V 0.11 debugger.
-func New(dev *jtag.Device) (*Debug, error) {
+func New(dev *jtag.Device, csrExt rv.CsrExtension) (*Debug, error) {
 	log.Info.Printf("0.11 debug module")
 	dbg := &Debug{
 		dev:        dev,
+		csrExt:     csrExt,
 		irlen:      dev.GetIRLength(),
 		dbusDevice: newDBUS().Setup(),
 	}
@@ -107,6 +113,8 @@ func New(dev *jtag.Device) (*Debug, error) {
 	}
 	// get number of words of debug ram
 	dbg.dramsize = util.Bits(x, 15, 10) + 1
+	// is the halt summary implemented?
+	dbg.haltsum = util.Bit(x, 9) != 0
 	// check dminfo.authtype
 	authtype := util.Bits(x, 3, 2)
 	if authtype != 0 {
@@ -163,14 +171,14 @@ func New(dev *jtag.Device) (*Debug, error) {
 
 // wrIR writes the instruction register.
 func (dbg *Debug) wrIR(ir uint) error {
-	if ir == dbg.ir {
+	if ir == dbg.ir && dbg.resets == dbg.dev.TapResets() {
 		return nil
 	}
 	err := dbg.dev.WrIR(bitstr.FromUint(ir, dbg.irlen))
 	if err != nil {
 		return err
 	}
-	dbg.ir = ir
+	dbg.ir, dbg.resets = ir, dbg.dev.TapResets()
 	return nil
 }
 
@@ -252,6 +260,144 @@ func (dbg *Debug) ResumeHart() error {
 	return err
 }
 
+// GetHartState returns the running state of the current hart.
+func (dbg *Debug) GetHartState() (rv.HartState, error) {
+	hi := dbg.hart[dbg.hartid]
+	halted, err := dbg.isHalted()
+	if err != nil {
+		return rv.Unknown, err
+	}
+	if halted {
+		hi.info.State = rv.Halted
+		return hi.info.State, nil
+	}
+	running, err := dbg.isRunning()
+	if err != nil {
+		return rv.Unknown, err
+	}
+	hi.info.State = []rv.HartState{rv.Unknown, rv.Running}[util.BoolToInt(running)]
+	return hi.info.State, nil
+}
+
+// HaltedHarts returns the halted state of all harts.
+// The 0.11 haltsum bits summarise 32 harts, so there is only a summary for a single hart.
+func (dbg *Debug) HaltedHarts() ([]bool, error) {
+	if len(dbg.hart) != 1 {
+		return nil, nil
+	}
+	halted, err := dbg.anyHalted()
+	if err != nil {
+		return nil, err
+	}
+	return []bool{halted}, nil
+}
+
+// HaltAll halts all harts.
+// 0.11 has no hart array, so the harts are halted one after the other.
+func (dbg *Debug) HaltAll() error {
+	return rv.AllHarts(dbg, dbg.HaltHart)
+}
+
+// ResumeAll resumes all harts.
+func (dbg *Debug) ResumeAll() error {
+	halted, err := dbg.anyHalted()
+	if err != nil {
+		return err
+	}
+	if !halted {
+		// nothing to do
+		for _, hi := range dbg.hart {
+			hi.info.State = rv.Running
+		}
+		return nil
+	}
+	return rv.AllHarts(dbg, dbg.ResumeHart)
+}
+
+const srstDelay = 100 * time.Millisecond
+const dcsrNdreset = (1 << 29)
+
+// waitResetHalt waits for each hart to halt out of reset.
+func (dbg *Debug) waitResetHalt() (bool, error) {
+	ok := true
+	err := rv.AllHarts(dbg, func() error {
+		halted, err := dbg.waitState(dbg.isHalted)
+		ok = ok && halted
+		return err
+	})
+	return ok, err
+}
+
+// ResetHalt resets the system and halts all harts at the reset vector.
+// The harts are re-examined after the reset.
+func (dbg *Debug) ResetHalt() error {
+	cur := dbg.hartid
+	// Halt the harts, set dcsr.halt and clear haltnot.
+	// dcsr.halt is held across the reset so each hart halts at the reset vector.
+	// A hart that was already halted (ebreak, step) may not have dcsr.halt set.
+	err := rv.AllHarts(dbg, func() error {
+		_, err := dbg.halt()
+		if err != nil {
+			return err
+		}
+		dcsr, err := dbg.RdCSR(rv.DCSR, 0)
+		if err != nil {
+			return err
+		}
+		err = dbg.WrCSR(rv.DCSR, 0, dcsr|dcsrHalt)
+		if err != nil {
+			return err
+		}
+		return dbg.clrDbus(dmcontrol, haltNotification)
+	})
+	if err != nil {
+		return err
+	}
+	// dcsr.ndreset resets everything except the debug module
+	dcsr, err := dbg.RdCSR(rv.DCSR, 0)
+	if err != nil {
+		return err
+	}
+	err = dbg.WrCSR(rv.DCSR, 0, dcsr|dcsrNdreset)
+	if err != nil {
+		// the hart may reset before the debug program completes
+		log.Debug.Printf("dcsr.ndreset: %v", err)
+	}
+	// the debug rom sets haltnot as each hart halts
+	halted, err := dbg.waitResetHalt()
+	if err != nil {
+		return err
+	}
+	if !halted {
+		// use the SRST line
+		log.Info.Printf("ndreset failed, using SRST")
+		err := dbg.dev.SystemReset(srstDelay)
+		if err != nil {
+			return err
+		}
+		_, err = dbg.waitResetHalt()
+		if err != nil {
+			return err
+		}
+	}
+	// re-examine (and halt) the harts
+	for _, hi := range dbg.hart {
+		err := hi.examine()
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dbg.SetCurrentHart(cur)
+	return err
+}
+
+// ResetHart resets the current hart and halts it at the reset vector.
+// 0.11 has no hart reset, so the whole system is reset.
+func (dbg *Debug) ResetHart() error {
+	log.Info.Printf("hart reset is not supported, resetting the system")
+	return dbg.ResetHalt()
+}
+
 //-----------------------------------------------------------------------------
 
 // GetPrompt returns a target prompt string.
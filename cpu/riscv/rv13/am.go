@@ -0,0 +1,234 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Debugger 0.13 Abstract Memory Access
+
+Memory reads and writes using the "access memory" abstract command.
+arg0 (data value) is in data0/1, arg1 (address) is in data1 or data2/3.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv13
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+)
+
+//-----------------------------------------------------------------------------
+
+// amAddress returns the dmi operations to write the address to arg1.
+func amAddress(addr, xlen uint) []dmiOp {
+	if xlen == 64 {
+		return []dmiOp{
+			dmiWr(data2, uint32(addr)),
+			dmiWr(data3, uint32(addr>>32)),
+		}
+	}
+	return []dmiOp{dmiWr(data1, uint32(addr))}
+}
+
+// amRdData returns the dmi operations to read a width-bit value from arg0.
+// data0 is read last, it triggers any autoexec.
+func amRdData(width uint) []dmiOp {
+	if width == 64 {
+		return []dmiOp{dmiRd(data1), dmiRd(data0)}
+	}
+	return []dmiOp{dmiRd(data0)}
+}
+
+// amWrData returns the dmi operations to write a width-bit value to arg0.
+// data0 is written last, it triggers any autoexec.
+func amWrData(width, val uint) []dmiOp {
+	if width == 64 {
+		return []dmiOp{dmiWr(data1, uint32(val>>32)), dmiWr(data0, uint32(val))}
+	}
+	return []dmiOp{dmiWr(data0, uint32(val))}
+}
+
+// amCheckWidth checks the width of an abstract memory access.
+func (dbg *Debug) amCheckWidth(width uint) error {
+	xlen := dbg.hart[dbg.hartid].info.MXLEN
+	if _, ok := sizeMap[width]; !ok || width > xlen {
+		return fmt.Errorf("%d-bit abstract memory access is not supported", width)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// amRdMem reads n x width-bit values from memory using abstract commands.
+func amRdMem(dbg *Debug, width, addr, n uint) ([]uint, error) {
+	err := dbg.amCheckWidth(width)
+	if err != nil {
+		return nil, err
+	}
+	hi := dbg.hart[dbg.hartid]
+	postinc := hi.aampostinc
+	cmd := cmdMemory(sizeMap[width], false, postinc, false)
+	// with post increment and autoexec each data0 read gets the next value
+	auto := postinc && dbg.autoexecdata && n > 1
+	// build the operations buffer
+	ops := amAddress(addr, hi.info.MXLEN)
+	ops = append(ops, dmiWr(command, cmd))
+	if auto {
+		ops = append(ops, dmiWr(abstractauto, 1<<0))
+	}
+	for i := uint(1); i <= n; i++ {
+		if auto && i == n {
+			// turn off autoexec before the final read
+			ops = append(ops, dmiWr(abstractauto, 0))
+		}
+		ops = append(ops, amRdData(width)...)
+		if !auto && i < n {
+			if !postinc {
+				ops = append(ops, amAddress(addr+(i*width>>3), hi.info.MXLEN)...)
+			}
+			ops = append(ops, dmiWr(command, cmd))
+		}
+	}
+	// read the command status
+	ops = append(ops, dmiRd(abstractcs))
+	// done
+	ops = append(ops, dmiEnd())
+	// run the operations
+	data, err := dbg.dmiOps(ops)
+	if err != nil {
+		return nil, err
+	}
+	// check the command status
+	err = dbg.checkError(cmdStatus(data[len(data)-1]))
+	if err != nil {
+		return nil, err
+	}
+	// return the data
+	val := make([]uint, n)
+	for i := range val {
+		switch width {
+		case 64:
+			val[i] = (uint(data[2*i]) << 32) | uint(data[2*i+1])
+		default:
+			val[i] = uint(data[i]) & ((1 << width) - 1)
+		}
+	}
+	return val, nil
+}
+
+// amWrMem writes n x width-bit values to memory using abstract commands.
+func amWrMem(dbg *Debug, width, addr uint, val []uint) error {
+	err := dbg.amCheckWidth(width)
+	if err != nil {
+		return err
+	}
+	hi := dbg.hart[dbg.hartid]
+	postinc := hi.aampostinc
+	cmd := cmdMemory(sizeMap[width], false, postinc, true)
+	// with post increment and autoexec each data0 write stores the next value
+	auto := postinc && dbg.autoexecdata && len(val) > 1
+	// build the operations buffer
+	ops := amAddress(addr, hi.info.MXLEN)
+	for i, v := range val {
+		if i > 0 && !postinc {
+			ops = append(ops, amAddress(addr+(uint(i)*width>>3), hi.info.MXLEN)...)
+		}
+		if auto && i == 1 {
+			ops = append(ops, dmiWr(abstractauto, 1<<0))
+		}
+		ops = append(ops, amWrData(width, v)...)
+		if !auto || i == 0 {
+			ops = append(ops, dmiWr(command, cmd))
+		}
+	}
+	if auto {
+		// turn off autoexec
+		ops = append(ops, dmiWr(abstractauto, 0))
+	}
+	// read the command status
+	ops = append(ops, dmiRd(abstractcs))
+	// done
+	ops = append(ops, dmiEnd())
+	// run the operations
+	data, err := dbg.dmiOps(ops)
+	if err != nil {
+		return err
+	}
+	// check the command status
+	return dbg.checkError(cmdStatus(data[len(data)-1]))
+}
+
+//-----------------------------------------------------------------------------
+
+// probeAbstractMemory works out if we can use abstract commands for memory access.
+func (hi *hartInfo) probeAbstractMemory() (bool, error) {
+	dbg := hi.dbg
+	xlen := hi.info.MXLEN
+	// we need arg0 and arg1
+	if dbg.datacount < 2*(xlen/32) {
+		return false, nil
+	}
+	// the instruction at dpc should be readable
+	dpc, err := dbg.RdCSR(rv.DPC, 0)
+	if err != nil {
+		return false, err
+	}
+	addr := uint(dpc) &^ 3
+	// try a post incremented read
+	ops := amAddress(addr, xlen)
+	ops = append(ops, dmiWr(command, cmdMemory(size32, false, true, false)))
+	ops = append(ops, dmiRd(abstractcs))
+	ops = append(ops, dmiEnd())
+	data, err := dbg.dmiOps(ops)
+	if err != nil {
+		return false, err
+	}
+	err = dbg.cmdWait(cmdStatus(data[0]), cmdTimeout)
+	if err == nil {
+		// did the address increment?
+		ops = []dmiOp{dmiRd(data1)}
+		if xlen == 64 {
+			ops = []dmiOp{dmiRd(data2), dmiRd(data3)}
+		}
+		data, err = dbg.dmiOps(append(ops, dmiEnd()))
+		if err != nil {
+			return false, err
+		}
+		next := uint(data[0])
+		if xlen == 64 {
+			next |= uint(data[1]) << 32
+		}
+		hi.aampostinc = next == addr+4
+		return true, nil
+	}
+	var ce cmdErr
+	if !errors.As(err, &ce) {
+		return false, err
+	}
+	if ce != errNotSupported {
+		// the command doesn't work for us
+		return false, nil
+	}
+	// try a plain read
+	ops = amAddress(addr, xlen)
+	ops = append(ops, dmiWr(command, cmdMemory(size32, false, false, false)))
+	ops = append(ops, dmiRd(abstractcs))
+	ops = append(ops, dmiEnd())
+	data, err = dbg.dmiOps(ops)
+	if err != nil {
+		return false, err
+	}
+	err = dbg.cmdWait(cmdStatus(data[0]), cmdTimeout)
+	if err == nil {
+		hi.aampostinc = false
+		return true, nil
+	}
+	if !errors.As(err, &ce) {
+		return false, err
+	}
+	// the command is not supported
+	return false, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -55,11 +55,79 @@ var cmdInfo = cli.Leaf{
 	},
 }
 
+// memHelp is help for the memory access mode command.
+var memHelp = []cli.Help{
+	{"<cr>", "display the current mode"},
+	{"auto", "use the system bus if the hart is running (default)"},
+	{"progbuf", "use the program buffer (hart must be halted)"},
+	{"abstract", "use abstract access memory commands (hart must be halted)"},
+	{"sysbus", "use system bus access"},
+}
+
+var cmdMem = cli.Leaf{
+	Descr: "display/set memory access mode",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug().(*Debug)
+		if len(args) == 1 {
+			err := dbg.setMemMode(args[0])
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+		}
+		hi := dbg.hart[dbg.hartid]
+		c.User.Put(fmt.Sprintf("hart%d memory access: %s\n", hi.info.ID, hi.memModeString()))
+	},
+}
+
+// groupHelp is help for the halt group command.
+var groupHelp = []cli.Help{
+	{"<cr>", "display the halt group of each hart"},
+	{"<group>", "put all harts in a halt group (0 = no group)"},
+}
+
+var cmdGroup = cli.Leaf{
+	Descr: "display/set halt groups",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug().(*Debug)
+		if len(args) == 1 {
+			group, err := cli.UintArg(args[0], [2]uint{0, maxHaltGroup}, 10)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			err = dbg.setHaltGroup(group)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+		}
+		s, err := dbg.haltGroupString()
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", s))
+	},
+}
+
 // Menu debug submenu items
 var Menu = cli.Menu{
 	{"cache", cmdCache},
 	{"dmi", cmdDmi},
+	{"group", cmdGroup, groupHelp},
 	{"info", cmdInfo},
+	{"mem", cmdMem, memHelp},
 }
 
 //-----------------------------------------------------------------------------
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/deadsy/rvdbg/bitstr"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
 	"github.com/deadsy/rvdbg/jtag"
 	"github.com/deadsy/rvdbg/soc"
 	"github.com/deadsy/rvdbg/util"
@@ -77,6 +78,7 @@ const confstrptr3 = 0x1c // Configuration String Pointer 3
 
 const nextdm = 0x1d   // Next Debug Module
 const authdata = 0x30 // Authentication Data
+const dmcs2 = 0x32    // Debug Module Control and Status 2
 
 const haltsum0 = 0x40 // Halt Summary 0
 const haltsum1 = 0x13 // Halt Summary 1
@@ -97,8 +99,27 @@ const sbdata3 = 0x3f // System Bus Data 127:96
 
 //-----------------------------------------------------------------------------
 
-func newDMI() *soc.Device {
-	return &soc.Device{
+// dmi10Fields are the register fields added by the 1.0 debug spec.
+var dmi10Fields = map[string][]soc.Field{
+	"dmcontrol": {
+		{Name: "ackunavail", Msb: 27, Lsb: 27},
+		{Name: "setkeepalive", Msb: 5, Lsb: 5},
+		{Name: "clrkeepalive", Msb: 4, Lsb: 4},
+	},
+	"dmstatus": {
+		{Name: "ndmresetpending", Msb: 24, Lsb: 24},
+		{Name: "stickyunavail", Msb: 23, Lsb: 23},
+	},
+	"abstractcs": {
+		{Name: "relaxedpriv", Msb: 11, Lsb: 11},
+	},
+	"dmcs2": {
+		{Name: "grouptype", Msb: 11, Lsb: 11},
+	},
+}
+
+func newDMI(version rv.DebugVersion) *soc.Device {
+	dev := &soc.Device{
 		Name: "DMI",
 		Peripherals: []soc.Peripheral{
 			{
@@ -204,11 +225,40 @@ func newDMI() *soc.Device {
 					{Offset: confstrptr3, Name: "confstrptr3", Descr: "configuration string pointer 3"},
 					{Offset: nextdm, Name: "nextdm", Descr: "next debug module"},
 					{Offset: authdata, Name: "authdata", Descr: "authentication data"},
+					{Offset: dmcs2,
+						Name:  "dmcs2",
+						Descr: "debug module control and status 2",
+						Fields: []soc.Field{
+							{Name: "exttrigger", Msb: 10, Lsb: 7},
+							{Name: "haltgroup", Msb: 6, Lsb: 2},
+							{Name: "hgwrite", Msb: 1, Lsb: 1},
+							{Name: "hgselect", Msb: 0, Lsb: 0},
+						},
+					},
 					{Offset: haltsum0, Name: "haltsum0", Descr: "halt summary 0"},
 					{Offset: haltsum1, Name: "haltsum1", Descr: "halt summary 1"},
 					{Offset: haltsum2, Name: "haltsum2", Descr: "halt summary 2"},
 					{Offset: haltsum3, Name: "haltsum3", Descr: "halt summary 3"},
-					{Offset: sbcs, Name: "sbcs", Descr: "system bus access control and status"},
+					{Offset: sbcs,
+						Name:  "sbcs",
+						Descr: "system bus access control and status",
+						Fields: []soc.Field{
+							{Name: "sbversion", Msb: 31, Lsb: 29},
+							{Name: "sbbusyerror", Msb: 22, Lsb: 22},
+							{Name: "sbbusy", Msb: 21, Lsb: 21},
+							{Name: "sbreadonaddr", Msb: 20, Lsb: 20},
+							{Name: "sbaccess", Msb: 19, Lsb: 17},
+							{Name: "sbautoincrement", Msb: 16, Lsb: 16},
+							{Name: "sbreadondata", Msb: 15, Lsb: 15},
+							{Name: "sberror", Msb: 14, Lsb: 12},
+							{Name: "sbasize", Msb: 11, Lsb: 5},
+							{Name: "sbaccess128", Msb: 4, Lsb: 4},
+							{Name: "sbaccess64", Msb: 3, Lsb: 3},
+							{Name: "sbaccess32", Msb: 2, Lsb: 2},
+							{Name: "sbaccess16", Msb: 1, Lsb: 1},
+							{Name: "sbaccess8", Msb: 0, Lsb: 0},
+						},
+					},
 					{Offset: sbaddress0, Name: "sbaddress0", Descr: "system bus address 31:0"},
 					{Offset: sbaddress1, Name: "sbaddress1", Descr: "system bus address 63:32"},
 					{Offset: sbaddress2, Name: "sbaddress2", Descr: "system bus address 95:64"},
@@ -221,6 +271,14 @@ func newDMI() *soc.Device {
 			},
 		},
 	}
+	if version == rv.Debug10 {
+		p := &dev.Peripherals[0]
+		for name, fields := range dmi10Fields {
+			r, _ := p.GetRegister(name)
+			r.Fields = append(r.Fields, fields...)
+		}
+	}
+	return dev
 }
 
 //-----------------------------------------------------------------------------
@@ -229,6 +287,7 @@ func newDMI() *soc.Device {
 const haltreq = (1 << 31)
 const resumereq = (1 << 30)
 const ackhavereset = (1 << 28)
+const ackunavail = (1 << 27) // 1.0
 const hartsello = ((1 << 10) - 1) << 16
 const hartselhi = ((1 << 10) - 1) << 6
 const ndmreset = (1 << 1)
@@ -283,6 +342,8 @@ func (dbg *Debug) selectHart(id int) error {
 //-----------------------------------------------------------------------------
 // DM status
 
+const ndmresetpending = (1 << 24) // 1.0
+const stickyunavail = (1 << 23)   // 1.0
 const anyhavereset = (1 << 18)
 const allresumeack = (1 << 17)
 const anyresumeack = (1 << 16)
@@ -335,8 +396,58 @@ func (x dmiOp) isRead() bool {
 	return (x & opMask) == opRd
 }
 
+// dmiBatchSize is the maximum number of dmi operations scanned in a single batch.
+// A busy response within a batch wastes the rest of it, so it's a compromise
+// between interface round trips and the cost of a retry.
+const dmiBatchSize = 64
+
+// dmiStats are running statistics for the dmi operations.
+type dmiStats struct {
+	ops     uint          // dmi operations
+	batches uint          // batches of dmi operations
+	busy    uint          // busy retries
+	bytes   uint          // data bytes read or written
+	elapsed time.Duration // time spent running dmi operations
+}
+
+func (s *dmiStats) String() string {
+	rate := 0.0
+	if s.elapsed != 0 {
+		rate = float64(s.bytes) / s.elapsed.Seconds()
+	}
+	return fmt.Sprintf("%d ops, %d batches, %d busy retries, %d bytes, %.0f bytes/s", s.ops, s.batches, s.busy, s.bytes, rate)
+}
+
+// dmiBusy handles a busy dmi response by clearing the error and increasing the idle cycles.
+func (dbg *Debug) dmiBusy() error {
+	// clear error condition
+	err := dbg.wrDtmcs(dmireset)
+	if err != nil {
+		return err
+	}
+	// re-select dmi
+	err = dbg.wrIR(irDmi)
+	if err != nil {
+		return err
+	}
+	dbg.stats.busy++
+	// auto-adjust timing
+	if dbg.idle >= jtag.MaxIdle {
+		return fmt.Errorf("dmi operation error %d", opBusy)
+	}
+	log.Info.Printf("increment idle timing %d->%d cycles", dbg.idle, dbg.idle+1)
+	dbg.idle++
+	return nil
+}
+
 // dmiOps runs a set of dmi operations and returns any read data.
+// The operations are scanned in batches. A busy response means the operation
+// (and the rest of the batch) was ignored, so the remaining operations are
+// re-run with increased idle cycles.
 func (dbg *Debug) dmiOps(ops []dmiOp) ([]uint32, error) {
+	t := time.Now()
+	defer func() { dbg.stats.elapsed += time.Since(t) }()
+
 	data := []uint32{}
 
 	// select dmi
@@ -346,41 +457,56 @@ func (dbg *Debug) dmiOps(ops []dmiOp) ([]uint32, error) {
 	}
 
 	read := false
-	for i := 0; i < len(ops); i++ {
-		op := ops[i]
-		// run the operation
-		tdo, err := dbg.dev.RdWrDR(bitstr.FromUint(uint(op), dbg.drDmiLength), dbg.idle)
+	i := 0
+	for i < len(ops) {
+		// build the batch
+		n := len(ops) - i
+		if n > dmiBatchSize {
+			n = dmiBatchSize
+		}
+		tdi := make([]*bitstr.BitString, n)
+		for j := range tdi {
+			tdi[j] = bitstr.FromUint(uint(ops[i+j]), dbg.drDmiLength)
+		}
+		// run the batch
+		tdo, err := dbg.dev.RdWrDRBatch(tdi, dbg.idle)
 		if err != nil {
 			return nil, err
 		}
-		x := tdo.Split([]int{dbg.drDmiLength})[0]
-		// check the result
-		result := x & opMask
-		if result != opOk {
-			// clear error condition
-			dbg.wrDtmcs(dmireset)
-			// re-select dmi
-			dbg.wrIR(irDmi)
+		dbg.stats.batches++
+		// check the results
+		for j := range tdo {
+			x := tdo[j].Split([]int{dbg.drDmiLength})[0]
+			result := x & opMask
 			if result == opBusy {
-				// auto-adjust timing
-				log.Info.Printf("increment idle timing %d->%d cycles", dbg.idle, dbg.idle+1)
-				dbg.idle++
-				if dbg.idle > jtag.MaxIdle {
-					return nil, fmt.Errorf("dmi operation error %d", result)
+				err := dbg.dmiBusy()
+				if err != nil {
+					return nil, err
 				}
-				// redo the operation
-				i--
-				continue
-			} else {
+				// redo the operations from here
+				break
+			}
+			if result != opOk {
+				// clear error condition
+				dbg.wrDtmcs(dmireset)
+				// re-select dmi
+				dbg.wrIR(irDmi)
 				return nil, fmt.Errorf("dmi operation error %d", result)
 			}
+			// get the read data
+			if read {
+				data = append(data, uint32((x>>2)&util.Mask32))
+				dbg.stats.bytes += 4
+			}
+			// setup the next read
+			op := ops[i]
+			read = op.isRead()
+			if op&opMask == opWr {
+				dbg.stats.bytes += 4
+			}
+			dbg.stats.ops++
+			i++
 		}
-		// get the read data
-		if read {
-			data = append(data, uint32((x>>2)&util.Mask32))
-		}
-		// setup the next read
-		read = op.isRead()
 	}
 	return data, nil
 }
@@ -418,15 +544,25 @@ func (ce cmdErr) String() string {
 	}[ce]
 }
 
+func (ce cmdErr) Error() string {
+	return ce.String()
+}
+
 // getError returns the error field of the command status.
 func (cs cmdStatus) getError() cmdErr {
 	return cmdErr(util.Bits(uint(cs), 10, 8))
 }
 
+const relaxedpriv = (1 << 11) // 1.0
+
 // cmdErrorClr resets a command error.
 func (dbg *Debug) cmdErrorClr() error {
-	// write all-ones to the cmderr field.
-	return dbg.wrDmi(abstractcs, errClear)
+	// write all-ones to the cmderr field, keep relaxedpriv.
+	x := uint32(errClear)
+	if dbg.relaxedpriv {
+		x |= relaxedpriv
+	}
+	return dbg.wrDmi(abstractcs, x)
 }
 
 // regCSR returns the abstract register number for a control and status register.
@@ -504,7 +640,7 @@ func (dbg *Debug) checkError(cs cmdStatus) error {
 	if err != nil {
 		return err
 	}
-	return fmt.Errorf("error: %s(%d)", ce, ce)
+	return fmt.Errorf("error: %w(%d)", ce, ce)
 }
 
 const cmdTimeout = 10 * time.Millisecond
@@ -524,7 +660,7 @@ func (dbg *Debug) cmdWait(cs cmdStatus, to time.Duration) error {
 				if err != nil {
 					return err
 				}
-				return fmt.Errorf("error: %s(%d)", ce, ce)
+				return fmt.Errorf("error: %w(%d)", ce, ce)
 			}
 			return nil
 		}
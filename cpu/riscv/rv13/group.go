@@ -0,0 +1,197 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Debugger 0.13 Hart Groups
+
+Halt/resume all harts using the hart array mask (hasel, hawindowsel/hawindow).
+Halt groups (dmcs2) halt all harts in a group when any one of them halts.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv13
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+// hart array mask
+
+const hasel = (1 << 26)
+
+// probeHartArray returns true if the debug module supports the hart array mask.
+func (dbg *Debug) probeHartArray() (bool, error) {
+	err := dbg.setDmi(dmcontrol, hasel)
+	if err != nil {
+		return false, err
+	}
+	x, err := dbg.rdDmi(dmcontrol)
+	if err != nil {
+		return false, err
+	}
+	return x&hasel != 0, dbg.clrDmi(dmcontrol, hasel)
+}
+
+// setHartArray selects (or deselects) all harts using the hart array mask.
+func (dbg *Debug) setHartArray(on bool) error {
+	ops := []dmiOp{}
+	n := len(dbg.hart)
+	for w := 0; w*32 < n; w++ {
+		mask := uint32(0)
+		if on {
+			k := n - w*32
+			if k > 32 {
+				k = 32
+			}
+			mask = uint32((uint64(1) << k) - 1)
+		}
+		ops = append(ops, dmiWr(hawindowsel, uint32(w)))
+		ops = append(ops, dmiWr(hawindow, mask))
+	}
+	_, err := dbg.dmiOps(append(ops, dmiEnd()))
+	if err != nil {
+		return err
+	}
+	if on {
+		return dbg.setDmi(dmcontrol, hasel)
+	}
+	return dbg.clrDmi(dmcontrol, hasel)
+}
+
+// setAllState sets the state of all harts.
+func (dbg *Debug) setAllState(state rv.HartState) {
+	for _, hi := range dbg.hart {
+		hi.info.State = state
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// HaltAll halts all harts.
+func (dbg *Debug) HaltAll() error {
+	if !dbg.hartArray {
+		// halt each hart in turn
+		return rv.AllHarts(dbg, dbg.HaltHart)
+	}
+	err := dbg.setHartArray(true)
+	if err != nil {
+		return err
+	}
+	// halt() waits for allhalted, which now covers all harts
+	_, err = dbg.halt()
+	aerr := dbg.setHartArray(false)
+	if err != nil {
+		return err
+	}
+	if aerr != nil {
+		return aerr
+	}
+	dbg.setAllState(rv.Halted)
+	return nil
+}
+
+// ResumeAll resumes all harts.
+func (dbg *Debug) ResumeAll() error {
+	if !dbg.hartArray {
+		// resume each hart in turn
+		return rv.AllHarts(dbg, dbg.ResumeHart)
+	}
+	// the debugger may have modified instruction memory
+	err := rv.AllHarts(dbg, dbg.pbFence)
+	if err != nil {
+		return err
+	}
+	err = dbg.setHartArray(true)
+	if err != nil {
+		return err
+	}
+	// resume() waits for allresumeack, which now covers all harts
+	_, err = dbg.resume()
+	aerr := dbg.setHartArray(false)
+	if err != nil {
+		return err
+	}
+	if aerr != nil {
+		return aerr
+	}
+	dbg.setAllState(rv.Running)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// halt groups
+
+const hgselect = (1 << 0)
+const hgwrite = (1 << 1)
+const maxHaltGroup = 31
+
+// probeHaltGroups returns true if the debug module supports halt groups.
+func (dbg *Debug) probeHaltGroups() (bool, error) {
+	err := dbg.wrDmi(dmcs2, hgwrite|(1<<2))
+	if err != nil {
+		return false, err
+	}
+	group, err := dbg.getHaltGroup()
+	if err != nil {
+		return false, err
+	}
+	return group == 1, dbg.wrDmi(dmcs2, hgwrite)
+}
+
+// getHaltGroup returns the halt group of the current hart.
+func (dbg *Debug) getHaltGroup() (uint, error) {
+	x, err := dbg.rdDmi(dmcs2)
+	if err != nil {
+		return 0, err
+	}
+	return util.Bits(uint(x), 6, 2), nil
+}
+
+// setHaltGroup puts all harts into a halt group (0 = no group).
+func (dbg *Debug) setHaltGroup(group uint) error {
+	if !dbg.haltGroups {
+		return errors.New("halt groups are not supported")
+	}
+	if group > maxHaltGroup {
+		return fmt.Errorf("halt group must be 0..%d", maxHaltGroup)
+	}
+	x := uint32(hgwrite | (group << 2))
+	if !dbg.hartArray {
+		return rv.AllHarts(dbg, func() error { return dbg.wrDmi(dmcs2, x) })
+	}
+	err := dbg.setHartArray(true)
+	if err != nil {
+		return err
+	}
+	err = dbg.wrDmi(dmcs2, x)
+	aerr := dbg.setHartArray(false)
+	if err != nil {
+		return err
+	}
+	return aerr
+}
+
+// haltGroupString returns a string with the halt group of each hart.
+func (dbg *Debug) haltGroupString() (string, error) {
+	if !dbg.haltGroups {
+		return "", errors.New("halt groups are not supported")
+	}
+	s := []string{}
+	err := rv.AllHarts(dbg, func() error {
+		group, err := dbg.getHaltGroup()
+		if err != nil {
+			return err
+		}
+		s = append(s, fmt.Sprintf("hart%d: halt group %d", dbg.hartid, group))
+		return nil
+	})
+	return strings.Join(s, "\n"), err
+}
+
+//-----------------------------------------------------------------------------
@@ -93,6 +93,11 @@ func (dbg *Debug) resume() (bool, error) {
 	if running {
 		return true, nil
 	}
+	// the debugger may have modified instruction memory
+	err = dbg.pbFence()
+	if err != nil {
+		log.Debug.Printf("hart%d: fence failed: %v", dbg.hartid, err)
+	}
 	// request the resume
 	err = dbg.setDmi(dmcontrol, resumereq)
 	if err != nil {
@@ -159,19 +164,26 @@ func (hi *hartInfo) probeCSR() error {
 
 // probeMemory works out how we can access memory.
 func (hi *hartInfo) probeMemory() error {
+	hi.memModes = nil
 	// We need 2 instructions + ebreak to r/w memory buffers.
-	supported := false
-	if hi.dbg.progbufsize >= 3 {
-		supported = true
+	if hi.dbg.progbufsize >= 3 || (hi.dbg.progbufsize == 2 && hi.dbg.impebreak != 0) {
+		hi.memModes = append(hi.memModes, pbMemMode)
+	}
+	// abstract access memory commands
+	ok, err := hi.probeAbstractMemory()
+	if err != nil {
+		return err
+	}
+	if ok {
+		hi.memModes = append(hi.memModes, amMemMode)
 	}
-	if hi.dbg.progbufsize == 2 && hi.dbg.impebreak != 0 {
-		supported = true
+	// system bus access
+	if hi.dbg.sbasize != 0 && hi.dbg.sbaccess != 0 {
+		hi.memModes = append(hi.memModes, sbMemMode)
 	}
-	if !supported {
+	if len(hi.memModes) == 0 {
 		return errors.New("unable to support memory access")
 	}
-	hi.rdMem = pbRdMem
-	hi.wrMem = pbWrMem
 	return nil
 }
 
@@ -192,11 +204,6 @@ func (dbg *Debug) probeAccess() error {
 	if err != nil {
 		return err
 	}
-	// Memory
-	err = hi.probeMemory()
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
@@ -254,6 +261,18 @@ type wrRegFunc func(dbg *Debug, reg, size uint, val uint64) error
 type rdMemFunc func(dbg *Debug, width, addr, n uint) ([]uint, error)
 type wrMemFunc func(dbg *Debug, width, addr uint, val []uint) error
 
+// memMode is a memory access mode.
+type memMode struct {
+	name   string    // mode name
+	halted bool      // the hart must be halted to use this mode
+	rdMem  rdMemFunc // read memory buffer
+	wrMem  wrMemFunc // write memory buffer
+}
+
+var pbMemMode = &memMode{"progbuf", true, pbRdMem, pbWrMem}
+var amMemMode = &memMode{"abstract", true, amRdMem, amWrMem}
+var sbMemMode = &memMode{"sysbus", false, sbRdMem, sbWrMem}
+
 // hartInfo stores generic/rv13 hart information.
 type hartInfo struct {
 	dbg        *Debug      // pointer back to parent debugger
@@ -268,8 +287,9 @@ type hartInfo struct {
 	wrGPR      wrRegFunc   // write GPR function
 	wrFPR      wrRegFunc   // write FPR function
 	wrCSR      wrRegFunc   // write CSR function
-	rdMem      rdMemFunc   // read memory buffer
-	wrMem      wrMemFunc   // write memory buffer
+	memModes   []*memMode  // supported memory access modes (in order of preference)
+	memMode    *memMode    // selected memory access mode (nil = auto)
+	aampostinc bool        // abstract memory access supports aampostincrement
 }
 
 func (hi *hartInfo) String() string {
@@ -279,6 +299,7 @@ func (hi *hartInfo) String() string {
 	s = append(s, fmt.Sprintf("datasize %d %s", hi.datasize, []string{"csr", "words"}[hi.dataaccess]))
 	s = append(s, fmt.Sprintf("dataaccess %s(%d)", []string{"csr", "memory"}[hi.dataaccess], hi.dataaccess))
 	s = append(s, fmt.Sprintf("dataaddr 0x%x", hi.dataaddr))
+	s = append(s, fmt.Sprintf("memory %s", hi.memModeString()))
 	return strings.Join(s, "\n")
 }
 
@@ -305,6 +326,23 @@ func (hi *hartInfo) examine() error {
 		}
 	}
 
+	if x&anyunavail != 0 {
+		if dbg.version == rv.Debug10 && x&stickyunavail != 0 {
+			// 1.0: unavail is sticky, acknowledge it and check again
+			err := dbg.setDmi(dmcontrol, ackunavail)
+			if err != nil {
+				return err
+			}
+			x, err = dbg.rdDmi(dmstatus)
+			if err != nil {
+				return err
+			}
+		}
+		if x&anyunavail != 0 {
+			return fmt.Errorf("hart%d is unavailable", hi.info.ID)
+		}
+	}
+
 	// halt the hart
 	wasHalted, err := dbg.halt()
 	if err != nil {
@@ -376,6 +414,12 @@ func (hi *hartInfo) examine() error {
 		return err
 	}
 
+	// probe the memory access modes (needs MXLEN and DXLEN)
+	err = hi.probeMemory()
+	if err != nil {
+		return err
+	}
+
 	// get the FLEN value
 	hi.info.FLEN, err = dbg.getFLEN()
 	if err != nil {
@@ -398,6 +442,16 @@ func (hi *hartInfo) examine() error {
 		log.Error.Printf("hart%d: misa has 128-bit floating point but FLEN < 128", hi.info.ID)
 	}
 
+	// get the VLEN value
+	if rv.CheckExtMISA(hi.info.MISA, 'v') {
+		hi.info.VLEN, err = dbg.getVLEN()
+		if err != nil {
+			log.Error.Printf("hart%d: misa has vector extension but VLEN is unknown: %v", hi.info.ID, err)
+			hi.info.VLEN = 0
+		}
+		log.Info.Printf("hart%d: VLEN %d", hi.info.ID, hi.info.VLEN)
+	}
+
 	// get the hart id per the CSR
 	mhartid, err := dbg.RdCSR(rv.MHARTID, 0)
 	if err != nil {
@@ -431,6 +485,14 @@ func (hi *hartInfo) examine() error {
 	}
 	log.Info.Printf("hart%d: disassembler ISA %s", hi.info.ID, hi.info.ISA)
 
+	// enumerate the trigger module
+	bp := hi.info.GetBreakpoints()
+	err = bp.Probe(dbg)
+	if err != nil {
+		return err
+	}
+	log.Info.Printf("hart%d: %d address match triggers", hi.info.ID, bp.NumTriggers())
+
 	if !wasHalted {
 		// resume the hart
 		_, err := dbg.resume()
@@ -449,7 +511,9 @@ func (dbg *Debug) newHart(id int) *hartInfo {
 		dbg: dbg,
 	}
 	hi.info.ID = id
+	hi.info.Version = dbg.version
 	hi.info.Nregs = 32
+	hi.info.CsrExt = dbg.csrExt
 	return hi
 }
 
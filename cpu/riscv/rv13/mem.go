@@ -10,7 +10,9 @@ Implements the mem.Driver interface methods.
 package rv13
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 )
 
 //-----------------------------------------------------------------------------
@@ -25,11 +27,15 @@ func (dbg *Debug) RdMem(width, addr, n uint) ([]uint, error) {
 	if n == 0 {
 		return nil, nil
 	}
-	hi := dbg.hart[dbg.hartid]
-	if width == 64 && hi.info.MXLEN < 64 {
+	mm, err := dbg.getMemMode()
+	if err != nil {
+		return nil, err
+	}
+	// the program buffer can only do 64-bit accesses on RV64
+	if mm == pbMemMode && width == 64 && dbg.hart[dbg.hartid].info.MXLEN < 64 {
 		return nil, fmt.Errorf("%d-bit memory reads are not supported", width)
 	}
-	return hi.rdMem(dbg, width, addr, n)
+	return mm.rdMem(dbg, width, addr, n)
 }
 
 // WrMem writes n x width-bit values to memory.
@@ -37,11 +43,66 @@ func (dbg *Debug) WrMem(width, addr uint, val []uint) error {
 	if len(val) == 0 {
 		return nil
 	}
-	hi := dbg.hart[dbg.hartid]
-	if width == 64 && hi.info.MXLEN < 64 {
+	mm, err := dbg.getMemMode()
+	if err != nil {
+		return err
+	}
+	// the program buffer can only do 64-bit accesses on RV64
+	if mm == pbMemMode && width == 64 && dbg.hart[dbg.hartid].info.MXLEN < 64 {
 		return fmt.Errorf("%d-bit memory writes are not supported", width)
 	}
-	return hi.wrMem(dbg, width, addr, val)
+	return mm.wrMem(dbg, width, addr, val)
+}
+
+//-----------------------------------------------------------------------------
+// memory access modes
+
+// getMemMode returns the memory access mode for the current hart.
+func (dbg *Debug) getMemMode() (*memMode, error) {
+	hi := dbg.hart[dbg.hartid]
+	if hi.memMode != nil {
+		return hi.memMode, nil
+	}
+	// auto: use the first mode that works in the current hart state
+	halted, err := dbg.isHalted()
+	if err != nil {
+		return nil, err
+	}
+	for _, mm := range hi.memModes {
+		if halted || !mm.halted {
+			return mm, nil
+		}
+	}
+	return nil, fmt.Errorf("hart%d must be halted for memory access", dbg.hartid)
+}
+
+// setMemMode sets the memory access mode for the current hart.
+func (dbg *Debug) setMemMode(name string) error {
+	hi := dbg.hart[dbg.hartid]
+	if name == "auto" {
+		hi.memMode = nil
+		return nil
+	}
+	for _, mm := range hi.memModes {
+		if mm.name == name {
+			hi.memMode = mm
+			return nil
+		}
+	}
+	return errors.New("memory access mode not supported")
+}
+
+// memModeString returns a string describing the memory access modes.
+func (hi *hartInfo) memModeString() string {
+	s := []string{}
+	for _, mm := range hi.memModes {
+		s = append(s, mm.name)
+	}
+	sel := "auto"
+	if hi.memMode != nil {
+		sel = hi.memMode.name
+	}
+	return fmt.Sprintf("%s (%s)", sel, strings.Join(s, ","))
 }
 
 //-----------------------------------------------------------------------------
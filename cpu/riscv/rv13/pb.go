@@ -35,6 +35,76 @@ func pbOps(pb []uint32, n int) []dmiOp {
 	return ops
 }
 
+//-----------------------------------------------------------------------------
+// The program buffer operations use s0/s1 as scratch registers.
+// Save and restore them so the halted program is not disturbed.
+
+var pbScratch = []uint{rv.RegS0, rv.RegS1}
+
+// pbSave saves the program buffer scratch registers.
+func (dbg *Debug) pbSave() ([]uint64, error) {
+	size := dbg.GetCurrentHart().MXLEN
+	if size == 0 {
+		// we are still probing the hart
+		return nil, nil
+	}
+	val := make([]uint64, len(pbScratch))
+	for i, reg := range pbScratch {
+		var err error
+		val[i], err = acRdGPR(dbg, reg, size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return val, nil
+}
+
+// pbRestore restores the program buffer scratch registers.
+func (dbg *Debug) pbRestore(val []uint64) error {
+	size := dbg.GetCurrentHart().MXLEN
+	for i := range val {
+		err := acWrGPR(dbg, pbScratch[i], size, val[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pbExec executes the program buffer.
+func (dbg *Debug) pbExec(pb []uint32) error {
+	// build the operations buffer
+	ops := pbOps(pb, 3)
+	// postexec
+	ops = append(ops, dmiWr(command, cmdRegister(0, 0, cmdPostExec)))
+	// read the command status
+	ops = append(ops, dmiRd(abstractcs))
+	// done
+	ops = append(ops, dmiEnd())
+	// run the operations
+	data, err := dbg.dmiOps(ops)
+	if err != nil {
+		return err
+	}
+	// wait for command completion
+	return dbg.cmdWait(cmdStatus(data[0]), cmdTimeout)
+}
+
+// pbFence makes memory changes made by the debugger visible to the hart.
+func (dbg *Debug) pbFence() error {
+	if dbg.progbufsize < 2 || (dbg.progbufsize == 2 && dbg.impebreak == 0) {
+		return nil
+	}
+	n := uint(3)
+	if dbg.progbufsize < n {
+		n = dbg.progbufsize
+	}
+	pb := dbg.newProgramBuffer(n)
+	pb[0] = rv.InsFENCE_I()
+	pb[1] = rv.InsFENCE()
+	return dbg.pbExec(pb)
+}
+
 //-----------------------------------------------------------------------------
 // program buffer read operations
 
@@ -73,9 +143,18 @@ func (dbg *Debug) pbRead(size uint, pb []uint32) (uint64, error) {
 
 // pbRdCSR reads a CSR using program buffer operations.
 func pbRdCSR(dbg *Debug, reg, size uint) (uint64, error) {
+	saved, err := dbg.pbSave()
+	if err != nil {
+		return 0, err
+	}
 	pb := dbg.newProgramBuffer(2)
 	pb[0] = rv.InsCSRR(rv.RegS0, reg)
-	return dbg.pbRead(size, pb)
+	val, err := dbg.pbRead(size, pb)
+	rerr := dbg.pbRestore(saved)
+	if err != nil {
+		return 0, err
+	}
+	return val, rerr
 }
 
 //-----------------------------------------------------------------------------
@@ -112,9 +191,18 @@ func (dbg *Debug) pbWrite(size uint, val uint64, pb []uint32) error {
 
 // pbWrCSR writes a CSR using program buffer operations.
 func pbWrCSR(dbg *Debug, reg, size uint, val uint64) error {
+	saved, err := dbg.pbSave()
+	if err != nil {
+		return err
+	}
 	pb := dbg.newProgramBuffer(2)
 	pb[0] = rv.InsCSRW(reg, rv.RegS0)
-	return dbg.pbWrite(size, val, pb)
+	err = dbg.pbWrite(size, val, pb)
+	rerr := dbg.pbRestore(saved)
+	if err != nil {
+		return err
+	}
+	return rerr
 }
 
 //-----------------------------------------------------------------------------
@@ -379,6 +467,19 @@ func (dbg *Debug) pbRdMem64(addr, n uint) ([]uint, error) {
 //-----------------------------------------------------------------------------
 
 func pbRdMem(dbg *Debug, width, addr, n uint) ([]uint, error) {
+	saved, err := dbg.pbSave()
+	if err != nil {
+		return nil, err
+	}
+	val, err := dbg.pbRdMemWidth(width, addr, n)
+	rerr := dbg.pbRestore(saved)
+	if err != nil {
+		return nil, err
+	}
+	return val, rerr
+}
+
+func (dbg *Debug) pbRdMemWidth(width, addr, n uint) ([]uint, error) {
 	switch width {
 	case 8:
 		return dbg.pbRdMem8(addr, n)
@@ -530,6 +631,19 @@ func (dbg *Debug) pbWrMem64(addr uint, val []uint) error {
 //-----------------------------------------------------------------------------
 
 func pbWrMem(dbg *Debug, width, addr uint, val []uint) error {
+	saved, err := dbg.pbSave()
+	if err != nil {
+		return err
+	}
+	err = dbg.pbWrMemWidth(width, addr, val)
+	rerr := dbg.pbRestore(saved)
+	if err != nil {
+		return err
+	}
+	return rerr
+}
+
+func (dbg *Debug) pbWrMemWidth(width, addr uint, val []uint) error {
 	switch width {
 	case 8:
 		return dbg.pbWrMem8(addr, val)
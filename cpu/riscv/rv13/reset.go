@@ -0,0 +1,260 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Debugger 0.13 Reset
+
+Reset the system with ndmreset, halting the harts at the reset vector using
+resethaltreq (or haltreq held across the reset). If the debug module can't
+reset the system the SRST line of the JTAG interface is used instead.
+
+A single hart is reset with dmcontrol.hartreset. This is optional, if the
+debug module doesn't implement it the whole system is reset.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv13
+
+import (
+	"time"
+
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/util/log"
+)
+
+//-----------------------------------------------------------------------------
+
+const setresethaltreq = (1 << 3)
+const clrresethaltreq = (1 << 2)
+const hasresethaltreq = (1 << 5)
+const hartreset = (1 << 29)
+
+const resetTimeout = 100 * time.Millisecond
+const srstDelay = 100 * time.Millisecond
+
+// dmctl returns a dmcontrol value for a hart.
+func dmctl(id int, bits uint32) uint32 {
+	return setHartSelect(dmactive|bits, id)
+}
+
+// waitHaveReset waits for the current hart to signal that it has been reset.
+func (dbg *Debug) waitHaveReset() (bool, error) {
+	t := time.Now().Add(resetTimeout)
+	for t.After(time.Now()) {
+		reset, err := dbg.checkStatus(anyhavereset)
+		if err != nil {
+			return false, err
+		}
+		if reset {
+			return true, nil
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	return false, nil
+}
+
+// waitNdmReset waits for a 1.0 debug module to complete the ndmreset.
+func (dbg *Debug) waitNdmReset() error {
+	t := time.Now().Add(resetTimeout)
+	for t.After(time.Now()) {
+		pending, err := dbg.checkStatus(ndmresetpending)
+		if err != nil {
+			return err
+		}
+		if !pending {
+			return nil
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	log.Info.Printf("ndmresetpending did not clear")
+	return nil
+}
+
+// waitHalted waits for the current hart to halt.
+func (dbg *Debug) waitHalted() (bool, error) {
+	t := time.Now().Add(resetTimeout)
+	for t.After(time.Now()) {
+		halted, err := dbg.isHalted()
+		if err != nil {
+			return false, err
+		}
+		if halted {
+			return true, nil
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	return false, nil
+}
+
+// ResetHalt resets the system and halts all harts at the reset vector.
+// The harts are re-examined after the reset.
+func (dbg *Debug) ResetHalt() error {
+	cur := dbg.hartid
+
+	// can we request a halt out of reset?
+	resethalt, err := dbg.checkStatus(hasresethaltreq)
+	if err != nil {
+		return err
+	}
+	req := uint32(haltreq)
+	if resethalt {
+		req = setresethaltreq
+	}
+
+	// request the halt for each hart
+	ops := []dmiOp{}
+	for id := range dbg.hart {
+		ops = append(ops, dmiWr(dmcontrol, dmctl(id, req)))
+	}
+	// ndmreset pulse (a haltreq for the current hart is held across the reset)
+	hold := uint32(haltreq)
+	if resethalt {
+		hold = 0
+	}
+	ops = append(ops, dmiWr(dmcontrol, dmctl(cur, hold|ndmreset)))
+	ops = append(ops, dmiWr(dmcontrol, dmctl(cur, hold)))
+	_, err = dbg.dmiOps(append(ops, dmiEnd()))
+	if err != nil {
+		return err
+	}
+	if dbg.version == rv.Debug10 {
+		err := dbg.waitNdmReset()
+		if err != nil {
+			return err
+		}
+	}
+
+	// did the debug module reset the system?
+	reset, err := dbg.waitHaveReset()
+	if err != nil {
+		return err
+	}
+	if !reset {
+		// use the SRST line
+		log.Info.Printf("ndmreset failed, using SRST")
+		err := dbg.dev.SystemReset(srstDelay)
+		if err != nil {
+			return err
+		}
+		// SRST may have reset the debug module
+		err = dbg.wrDmi(dmcontrol, dmctl(cur, hold))
+		if err != nil {
+			return err
+		}
+	}
+
+	// wait for each hart to halt, then clear the requests
+	for id := range dbg.hart {
+		// select the hart (without clearing the halt request)
+		err := dbg.wrDmi(dmcontrol, dmctl(id, hold))
+		if err != nil {
+			return err
+		}
+		dbg.hartid = id
+		halted, err := dbg.waitHalted()
+		if err != nil {
+			return err
+		}
+		if !halted {
+			log.Info.Printf("hart%d did not halt at the reset vector", id)
+			_, err := dbg.halt()
+			if err != nil {
+				return err
+			}
+		}
+		clr := uint32(ackhavereset)
+		if resethalt {
+			clr |= clrresethaltreq
+		}
+		err = dbg.wrDmi(dmcontrol, dmctl(id, clr))
+		if err != nil {
+			return err
+		}
+	}
+
+	// re-examine the harts
+	for _, hi := range dbg.hart {
+		err := hi.examine()
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dbg.SetCurrentHart(cur)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// ResetHart resets the current hart and halts it at the reset vector.
+// The hart is re-examined after the reset.
+func (dbg *Debug) ResetHart() error {
+	id := dbg.hartid
+
+	// can we request a halt out of reset?
+	resethalt, err := dbg.checkStatus(hasresethaltreq)
+	if err != nil {
+		return err
+	}
+	// otherwise hold haltreq across the reset
+	hold := uint32(haltreq)
+	clr := uint32(0)
+	if resethalt {
+		err := dbg.wrDmi(dmcontrol, dmctl(id, setresethaltreq))
+		if err != nil {
+			return err
+		}
+		hold = 0
+		clr = clrresethaltreq
+	}
+
+	// hartreset reads back as 0 if it isn't implemented
+	err = dbg.wrDmi(dmcontrol, dmctl(id, hold|hartreset))
+	if err != nil {
+		return err
+	}
+	x, err := dbg.rdDmi(dmcontrol)
+	if err != nil {
+		return err
+	}
+	err = dbg.wrDmi(dmcontrol, dmctl(id, hold))
+	if err != nil {
+		return err
+	}
+	if x&hartreset == 0 {
+		err := dbg.wrDmi(dmcontrol, dmctl(id, clr))
+		if err != nil {
+			return err
+		}
+		log.Info.Printf("hartreset is not supported, resetting the system")
+		return dbg.ResetHalt()
+	}
+
+	// wait for the hart to reset and halt, then clear the requests
+	reset, err := dbg.waitHaveReset()
+	if err != nil {
+		return err
+	}
+	if !reset {
+		log.Info.Printf("hart%d did not signal havereset", id)
+	}
+	halted, err := dbg.waitHalted()
+	if err != nil {
+		return err
+	}
+	if !halted {
+		log.Info.Printf("hart%d did not halt at the reset vector", id)
+		_, err := dbg.halt()
+		if err != nil {
+			return err
+		}
+	}
+	err = dbg.wrDmi(dmcontrol, dmctl(id, clr|ackhavereset))
+	if err != nil {
+		return err
+	}
+
+	// re-examine the hart
+	return dbg.hart[id].examine()
+}
+
+//-----------------------------------------------------------------------------
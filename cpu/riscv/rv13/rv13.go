@@ -31,45 +31,59 @@ const irDmi = 0x11 // debug module interface access
 
 //-----------------------------------------------------------------------------
 
-// Debug is a RISC-V 0.13 debugger. It implements the rv.Debug interface.
+// Debug is a RISC-V 0.13/1.0 debugger. It implements the rv.Debug interface.
 type Debug struct {
 	dev             *jtag.Device
-	dmiDevice       *soc.Device // dmi device for decode/display
-	hart            []*hartInfo // implemented harts
-	hartid          int         // currently selected hart
-	ir              uint        // cache of ir value
-	irlen           int         // IR length
-	drDmiLength     int         // DR length for dmi
-	abits           uint        // address bits in dtmcs
-	idle            uint        // idle value in dtmcs
-	progbufsize     uint        // number of progbuf words implemented
-	datacount       uint        // number of data words implemented
-	autoexecprogbuf bool        // can we autoexec on progbufX access?
-	autoexecdata    bool        // can we autoexec on dataX access?
-	sbasize         uint        // width of system bus address (0 = no access)
-	hartsellen      uint        // hart select length 0..20
-	impebreak       uint        // implicit ebreak in progbuf
+	csrExt          rv.CsrExtension // vendor specific CSRs
+	version         rv.DebugVersion // debug spec version (dmstatus.version)
+	dmiDevice       *soc.Device     // dmi device for decode/display
+	hart            []*hartInfo     // implemented harts
+	hartid          int             // currently selected hart
+	ir              uint            // cache of ir value
+	resets          int             // chain TAP resets at the last IR write
+	irlen           int             // IR length
+	drDmiLength     int             // DR length for dmi
+	abits           uint            // address bits in dtmcs
+	idle            uint            // idle value in dtmcs
+	progbufsize     uint            // number of progbuf words implemented
+	datacount       uint            // number of data words implemented
+	autoexecprogbuf bool            // can we autoexec on progbufX access?
+	autoexecdata    bool            // can we autoexec on dataX access?
+	sbasize         uint            // width of system bus address (0 = no access)
+	sbaccess        uint            // supported system bus access widths (sbaccess8..128)
+	hartsellen      uint            // hart select length 0..20
+	impebreak       uint            // implicit ebreak in progbuf
+	hartArray       bool            // hart array mask (hasel) is supported
+	haltGroups      bool            // halt groups (dmcs2) are supported
+	relaxedpriv     bool            // relaxed permission checks (1.0)
+	stats           dmiStats        // dmi operation statistics
 }
 
 func (dbg *Debug) String() string {
 	s := [][]string{}
-	s = append(s, []string{"version", "0.13"})
+	s = append(s, []string{"version", dbg.version.String()})
 	s = append(s, []string{"idle cycles", fmt.Sprintf("%d", dbg.idle)})
+	s = append(s, []string{"dmi", dbg.stats.String()})
 	s = append(s, []string{"sbasize", fmt.Sprintf("%d bits", dbg.sbasize)})
+	s = append(s, []string{"sbaccess", sbWidths(dbg.sbaccess)})
 	s = append(s, []string{"progbufsize", fmt.Sprintf("%d words", dbg.progbufsize)})
 	s = append(s, []string{"datacount", fmt.Sprintf("%d words", dbg.datacount)})
 	s = append(s, []string{"autoexecprogbuf", fmt.Sprintf("%t", dbg.autoexecprogbuf)})
 	s = append(s, []string{"autoexecdata", fmt.Sprintf("%t", dbg.autoexecdata)})
+	s = append(s, []string{"hart array", fmt.Sprintf("%t", dbg.hartArray)})
+	s = append(s, []string{"halt groups", fmt.Sprintf("%t", dbg.haltGroups)})
+	if dbg.version == rv.Debug10 {
+		s = append(s, []string{"relaxedpriv", fmt.Sprintf("%t", dbg.relaxedpriv)})
+	}
 	return cli.TableString(s, []int{0, 0}, 1)
 }
 
-// New returns a RISC-V 0.13 debugger.
-func New(dev *jtag.Device) (*Debug, error) {
-	log.Info.Printf("0.13 debug module")
+// New returns a RISC-V 0.13/1.0 debugger.
+func New(dev *jtag.Device, csrExt rv.CsrExtension) (*Debug, error) {
 	dbg := &Debug{
-		dev:       dev,
-		irlen:     dev.GetIRLength(),
-		dmiDevice: newDMI().Setup(),
+		dev:    dev,
+		csrExt: csrExt,
+		irlen:  dev.GetIRLength(),
 	}
 
 	// get dtmcs
@@ -138,9 +152,16 @@ func New(dev *jtag.Device) (*Debug, error) {
 		return nil, err
 	}
 	// check version
-	if util.Bits(uint(x), 3, 0) != 2 {
-		return nil, errors.New("unknown dmstatus version")
-	}
+	switch util.Bits(uint(x), 3, 0) {
+	case 2:
+		dbg.version = rv.Debug013
+	case 3:
+		dbg.version = rv.Debug10
+	default:
+		return nil, fmt.Errorf("unknown dmstatus version %d", util.Bits(uint(x), 3, 0))
+	}
+	log.Info.Printf("%s debug module", dbg.version)
+	dbg.dmiDevice = newDMI(dbg.version).Setup()
 	// check authentication
 	if util.Bit(uint(x), 7) != 1 {
 		return nil, errors.New("debugger is not authenticated")
@@ -154,7 +175,13 @@ func New(dev *jtag.Device) (*Debug, error) {
 		return nil, err
 	}
 	dbg.sbasize = util.Bits(uint(x), 11, 5)
-	log.Info.Printf("sbasize %d", dbg.sbasize)
+	dbg.sbaccess = util.Bits(uint(x), 4, 0)
+	if dbg.sbasize != 0 && util.Bits(uint(x), 31, 29) != 1 {
+		// we only support the 0.13 system bus interface
+		log.Info.Printf("unknown sbversion %d, system bus access disabled", util.Bits(uint(x), 31, 29))
+		dbg.sbasize = 0
+	}
+	log.Info.Printf("sbasize %d sbaccess %s", dbg.sbasize, sbWidths(dbg.sbaccess))
 
 	// work out how many program and data words we have
 	x, err = dbg.rdDmi(abstractcs)
@@ -164,6 +191,20 @@ func New(dev *jtag.Device) (*Debug, error) {
 	dbg.progbufsize = util.Bits(uint(x), 28, 24)
 	dbg.datacount = util.Bits(uint(x), 3, 0)
 
+	if dbg.version == rv.Debug10 {
+		// try to relax the permission checks for abstract commands and progbuf
+		err = dbg.wrDmi(abstractcs, relaxedpriv)
+		if err != nil {
+			return nil, err
+		}
+		x, err = dbg.rdDmi(abstractcs)
+		if err != nil {
+			return nil, err
+		}
+		dbg.relaxedpriv = x&relaxedpriv != 0
+		log.Info.Printf("relaxedpriv %t", dbg.relaxedpriv)
+	}
+
 	// check progbuf/impebreak consistency
 	if dbg.progbufsize == 1 && dbg.impebreak != 1 {
 		return nil, fmt.Errorf("progbufsize == 1 and impebreak != 1")
@@ -224,6 +265,21 @@ func New(dev *jtag.Device) (*Debug, error) {
 		return nil, errors.New("no harts found")
 	}
 
+	// hart array mask and halt groups
+	err = dbg.selectHart(0)
+	if err != nil {
+		return nil, err
+	}
+	dbg.hartArray, err = dbg.probeHartArray()
+	if err != nil {
+		return nil, err
+	}
+	dbg.haltGroups, err = dbg.probeHaltGroups()
+	if err != nil {
+		return nil, err
+	}
+	log.Info.Printf("hart array %t halt groups %t", dbg.hartArray, dbg.haltGroups)
+
 	// 2nd pass: examine each hart
 	log.Info.Printf("%d hart(s) found", len(dbg.hart))
 	for i := range dbg.hart {
@@ -240,14 +296,14 @@ func New(dev *jtag.Device) (*Debug, error) {
 
 // wrIR writes the instruction register.
 func (dbg *Debug) wrIR(ir uint) error {
-	if ir == dbg.ir {
+	if ir == dbg.ir && dbg.resets == dbg.dev.TapResets() {
 		return nil
 	}
 	err := dbg.dev.WrIR(bitstr.FromUint(ir, dbg.irlen))
 	if err != nil {
 		return err
 	}
-	dbg.ir = ir
+	dbg.ir, dbg.resets = ir, dbg.dev.TapResets()
 	return nil
 }
 
@@ -339,6 +395,42 @@ func (dbg *Debug) ResumeHart() error {
 	return err
 }
 
+// GetHartState returns the running state of the current hart.
+func (dbg *Debug) GetHartState() (rv.HartState, error) {
+	hi := dbg.hart[dbg.hartid]
+	halted, err := dbg.isHalted()
+	if err != nil {
+		return rv.Unknown, err
+	}
+	if halted {
+		hi.info.State = rv.Halted
+		return hi.info.State, nil
+	}
+	running, err := dbg.isRunning()
+	if err != nil {
+		return rv.Unknown, err
+	}
+	hi.info.State = []rv.HartState{rv.Unknown, rv.Running}[util.BoolToInt(running)]
+	return hi.info.State, nil
+}
+
+// HaltedHarts returns the halted state of all harts from the haltsum0 register.
+// It doesn't change the selected hart. It returns nil if there are more than 32 harts.
+func (dbg *Debug) HaltedHarts() ([]bool, error) {
+	if len(dbg.hart) > 32 {
+		return nil, nil
+	}
+	x, err := dbg.rdDmi(haltsum0)
+	if err != nil {
+		return nil, err
+	}
+	halted := make([]bool, len(dbg.hart))
+	for i := range halted {
+		halted[i] = x&(1<<i) != 0
+	}
+	return halted, nil
+}
+
 //-----------------------------------------------------------------------------
 
 // GetPrompt returns a target prompt string.
@@ -0,0 +1,315 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Debugger 0.13 System Bus Access
+
+Memory reads and writes using the sbcs/sbaddress/sbdata registers.
+The system bus master works without halting the hart.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv13
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+// sbcs fields
+
+const sbbusyerror = (1 << 22)
+const sbbusy = (1 << 21)
+const sbreadonaddr = (1 << 20)
+const sbautoincrement = (1 << 16)
+const sbreadondata = (1 << 15)
+const sberrorMask = (7 << 12)
+
+// sbaccess8..128 bits
+const sbaccess8 = (1 << 0)
+const sbaccess16 = (1 << 1)
+const sbaccess32 = (1 << 2)
+const sbaccess64 = (1 << 3)
+const sbaccess128 = (1 << 4)
+
+// system bus errors
+var sbErrorName = [8]string{
+	"none",
+	"timeout",
+	"bad address",
+	"alignment",
+	"unsupported size",
+	"reserved",
+	"reserved",
+	"other",
+}
+
+// sbAccessSize returns the sbaccess field value for an access width.
+func sbAccessSize(width uint) uint32 {
+	switch width {
+	case 8:
+		return 0 << 17
+	case 16:
+		return 1 << 17
+	case 32:
+		return 2 << 17
+	case 64:
+		return 3 << 17
+	}
+	return 4 << 17
+}
+
+// sbWidths returns a string with the supported system bus access widths.
+func sbWidths(sbaccess uint) string {
+	s := ""
+	for i, width := range []uint{8, 16, 32, 64, 128} {
+		if sbaccess&(1<<i) != 0 {
+			if s != "" {
+				s += ","
+			}
+			s += fmt.Sprintf("%d", width)
+		}
+	}
+	if s == "" {
+		return "none"
+	}
+	return s + " bits"
+}
+
+// sbCheckWidth checks that the system bus supports a width.
+func (dbg *Debug) sbCheckWidth(width uint) error {
+	var bit uint
+	switch width {
+	case 8:
+		bit = sbaccess8
+	case 16:
+		bit = sbaccess16
+	case 32:
+		bit = sbaccess32
+	case 64:
+		bit = sbaccess64
+	}
+	// A 128-bit value doesn't fit in the single uint per value of the
+	// memory interface, so 128-bit access is never used.
+	if dbg.sbasize == 0 || dbg.sbaccess&bit == 0 {
+		return fmt.Errorf("%d-bit system bus access is not supported", width)
+	}
+	return nil
+}
+
+// sbAddress returns the dmi operations to write a system bus address.
+// The sbaddress0 write goes last since it may trigger a read.
+func (dbg *Debug) sbAddress(addr uint) []dmiOp {
+	ops := []dmiOp{}
+	if dbg.sbasize > 96 {
+		ops = append(ops, dmiWr(sbaddress3, 0))
+	}
+	if dbg.sbasize > 64 {
+		ops = append(ops, dmiWr(sbaddress2, 0))
+	}
+	if dbg.sbasize > 32 {
+		ops = append(ops, dmiWr(sbaddress1, uint32(addr>>32)))
+	}
+	return append(ops, dmiWr(sbaddress0, uint32(addr)))
+}
+
+// sbWords returns the number of 32-bit sbdata words used for a width.
+func sbWords(width uint) uint {
+	if width <= 32 {
+		return 1
+	}
+	return width / 32
+}
+
+const sbTimeout = 100 * time.Millisecond
+
+// sbWait waits for the system bus to be idle.
+func (dbg *Debug) sbWait() error {
+	t := time.Now().Add(sbTimeout)
+	for t.After(time.Now()) {
+		x, err := dbg.rdDmi(sbcs)
+		if err != nil {
+			return err
+		}
+		if x&sbbusy == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("system bus is busy")
+}
+
+// sbCheck checks a final sbcs value for errors, clearing any that are set.
+// It returns true if the operation should be retried with busy polling.
+func (dbg *Debug) sbCheck(x uint32) (bool, error) {
+	if x&(sbbusyerror|sberrorMask) == 0 {
+		return false, nil
+	}
+	// clear the errors
+	err := dbg.wrDmi(sbcs, sbbusyerror|sberrorMask)
+	if err != nil {
+		return false, err
+	}
+	sberr := util.Bits(uint(x), 14, 12)
+	if sberr != 0 {
+		return false, fmt.Errorf("system bus error: %s", sbErrorName[sberr])
+	}
+	return true, nil
+}
+
+//-----------------------------------------------------------------------------
+// read memory
+
+// sbRdOps reads n x width-bit values from the system bus.
+// If poll is true we wait for the bus to be idle before each data access.
+func (dbg *Debug) sbRdOps(width, addr, n uint, poll bool) ([]uint32, bool, error) {
+	k := sbWords(width)
+	cs := sbAccessSize(width) | sbautoincrement | sbreadonaddr
+	// the sbcs write also clears any old errors
+	ops := []dmiOp{dmiWr(sbcs, cs|sbreadondata|sbbusyerror|sberrorMask)}
+	ops = append(ops, dbg.sbAddress(addr)...)
+	data := []uint32{}
+	for i := uint(0); i < n; i++ {
+		if i == n-1 {
+			// don't read beyond the end of the buffer
+			ops = append(ops, dmiWr(sbcs, cs))
+		}
+		if poll {
+			// wait for the previous read to complete
+			x, err := dbg.dmiOps(append(ops, dmiEnd()))
+			if err != nil {
+				return nil, false, err
+			}
+			data = append(data, x...)
+			ops = nil
+			err = dbg.sbWait()
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		// sbdata0 is read last, it triggers the next read
+		for j := k; j > 0; j-- {
+			ops = append(ops, dmiRd(sbdata0+j-1))
+		}
+	}
+	ops = append(ops, dmiRd(sbcs), dmiEnd())
+	x, err := dbg.dmiOps(ops)
+	if err != nil {
+		return nil, false, err
+	}
+	data = append(data, x...)
+	retry, err := dbg.sbCheck(data[len(data)-1])
+	return data[:len(data)-1], retry, err
+}
+
+// sbRdMem reads n x width-bit values from memory using system bus access.
+func sbRdMem(dbg *Debug, width, addr, n uint) ([]uint, error) {
+	err := dbg.sbCheckWidth(width)
+	if err != nil {
+		return nil, err
+	}
+	data, retry, err := dbg.sbRdOps(width, addr, n, false)
+	if err != nil {
+		return nil, err
+	}
+	if retry {
+		// the bus was too slow, try again and wait for each access
+		data, retry, err = dbg.sbRdOps(width, addr, n, true)
+		if err != nil {
+			return nil, err
+		}
+		if retry {
+			return nil, fmt.Errorf("system bus busy error")
+		}
+	}
+	// convert the data words to values (most significant word first)
+	k := sbWords(width)
+	val := make([]uint, 0, n)
+	for i := uint(0); i < n; i++ {
+		w := data[i*k : (i+1)*k]
+		switch width {
+		case 8, 16:
+			val = append(val, uint(w[0])&((1<<width)-1))
+		case 32:
+			val = append(val, uint(w[0]))
+		case 64:
+			val = append(val, (uint(w[0])<<32)|uint(w[1]))
+		}
+	}
+	return val, nil
+}
+
+//-----------------------------------------------------------------------------
+// write memory
+
+// sbWrOps writes n x width-bit values to the system bus.
+// If poll is true we wait for the bus to be idle before each data access.
+func (dbg *Debug) sbWrOps(width, addr uint, val []uint32, poll bool) (bool, error) {
+	k := sbWords(width)
+	// the sbcs write also clears any old errors
+	ops := []dmiOp{dmiWr(sbcs, sbAccessSize(width)|sbautoincrement|sbbusyerror|sberrorMask)}
+	ops = append(ops, dbg.sbAddress(addr)...)
+	for i := 0; i < len(val); i += int(k) {
+		if poll {
+			// wait for the previous write to complete
+			_, err := dbg.dmiOps(append(ops, dmiEnd()))
+			if err != nil {
+				return false, err
+			}
+			ops = nil
+			err = dbg.sbWait()
+			if err != nil {
+				return false, err
+			}
+		}
+		// sbdata0 is written last, it triggers the write
+		for j := k; j > 0; j-- {
+			ops = append(ops, dmiWr(sbdata0+j-1, val[i+int(j)-1]))
+		}
+	}
+	ops = append(ops, dmiRd(sbcs), dmiEnd())
+	data, err := dbg.dmiOps(ops)
+	if err != nil {
+		return false, err
+	}
+	return dbg.sbCheck(data[len(data)-1])
+}
+
+// sbWrMem writes n x width-bit values to memory using system bus access.
+func sbWrMem(dbg *Debug, width, addr uint, val []uint) error {
+	err := dbg.sbCheckWidth(width)
+	if err != nil {
+		return err
+	}
+	// convert the values to data words (least significant word first)
+	data := []uint32{}
+	switch width {
+	case 8, 16, 32:
+		for _, v := range val {
+			data = append(data, uint32(v&((1<<width)-1)))
+		}
+	case 64:
+		for _, v := range val {
+			data = append(data, uint32(v), uint32(v>>32))
+		}
+	}
+	retry, err := dbg.sbWrOps(width, addr, data, false)
+	if err != nil {
+		return err
+	}
+	if retry {
+		// the bus was too slow, try again and wait for each access
+		retry, err = dbg.sbWrOps(width, addr, data, true)
+		if err != nil {
+			return err
+		}
+		if retry {
+			return fmt.Errorf("system bus busy error")
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,236 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Debugger 0.13 Vector Register Access
+
+The vector registers are accessed with program buffer operations.
+vtype/vl are set for MXLEN-bit elements with LMUL = 1, so each register
+is VLEN/MXLEN elements. A register is read by moving element 0 to s0 and
+rotating the register with vslide1down. After VLEN/MXLEN reads the register
+is back in its original state. A register is written by sliding in new values.
+
+*/
+//-----------------------------------------------------------------------------
+
+package rv13
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+)
+
+//-----------------------------------------------------------------------------
+
+// vecState is the vector state modified while accessing the vector registers.
+type vecState struct {
+	vl     uint64
+	vtype  uint64
+	vstart uint64
+}
+
+// vecEnter saves the vector state and sets vtype/vl for MXLEN-bit elements.
+// It returns the number of elements in each vector register.
+func (dbg *Debug) vecEnter() (*vecState, uint, error) {
+	hi := dbg.hart[dbg.hartid]
+	if dbg.progbufsize < 2 || (dbg.progbufsize == 2 && dbg.impebreak == 0) {
+		return nil, 0, errors.New("vector register access needs a larger program buffer")
+	}
+	vs := &vecState{}
+	var err error
+	vs.vl, err = dbg.RdCSR(rv.VL, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	vs.vtype, err = dbg.RdCSR(rv.VTYPE, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	vs.vstart, err = dbg.RdCSR(rv.VSTART, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	// vsetvli s0, zero, e<MXLEN>, m1 (vl = VLMAX)
+	pb := dbg.newProgramBuffer(2)
+	pb[0] = rv.InsVSETVLI(rv.RegS0, rv.RegZero, rv.VtypeSEW(hi.info.MXLEN))
+	err = dbg.pbExec(pb)
+	if err != nil {
+		return nil, 0, err
+	}
+	return vs, hi.info.VLEN / hi.info.MXLEN, nil
+}
+
+// vecExit restores the vector state.
+func (dbg *Debug) vecExit(vs *vecState) error {
+	// s1 = vtype, s0 = vl, vsetvl zero, s0, s1
+	err := dbg.WrGPR(rv.RegS1, 0, vs.vtype)
+	if err != nil {
+		return err
+	}
+	pb := dbg.newProgramBuffer(2)
+	pb[0] = rv.InsVSETVL(rv.RegZero, rv.RegS0, rv.RegS1)
+	err = dbg.pbWrite(dbg.hart[dbg.hartid].info.MXLEN, vs.vl, pb)
+	if err != nil {
+		return err
+	}
+	// vector instructions clear vstart
+	return dbg.WrCSR(rv.VSTART, 0, vs.vstart)
+}
+
+// vecOp runs a vector register operation, saving and restoring the modified state.
+func (dbg *Debug) vecOp(f func(n uint) error) error {
+	return rv.VectorOp(dbg, func() error {
+		saved, err := dbg.pbSave()
+		if err != nil {
+			return err
+		}
+		vs, n, err := dbg.vecEnter()
+		if err == nil {
+			err = f(n)
+			xerr := dbg.vecExit(vs)
+			if err == nil {
+				err = xerr
+			}
+		}
+		rerr := dbg.pbRestore(saved)
+		if err != nil {
+			return err
+		}
+		return rerr
+	})
+}
+
+//-----------------------------------------------------------------------------
+
+// pbRdVPR reads the n elements of a vector register.
+func (dbg *Debug) pbRdVPR(reg, n uint) ([]uint, error) {
+	size := dbg.hart[dbg.hartid].info.MXLEN
+	pb := dbg.newProgramBuffer(3)
+	pb[0] = rv.InsVMV_X_S(rv.RegS0, reg)
+	pb[1] = rv.InsVSLIDE1DOWN_VX(reg, reg, rv.RegS0)
+	// build the operations buffer
+	ops := pbOps(pb, int(4*n)+3)
+	// postexec to get element 0 in s0
+	ops = append(ops, dmiWr(command, cmdRegister(0, 0, cmdPostExec)))
+	for i := uint(0); i < n; i++ {
+		// transfer s0 to data0/1 and postexec to get the next element
+		cmd := cmdRead
+		if i < n-1 {
+			cmd |= cmdPostExec
+		}
+		ops = append(ops, dmiWr(command, cmdRegister(regGPR(rv.RegS0), sizeMap[size], cmd)))
+		if size == 64 {
+			ops = append(ops, dmiRd(data1))
+		}
+		ops = append(ops, dmiRd(data0))
+	}
+	// read the command status
+	ops = append(ops, dmiRd(abstractcs))
+	// done
+	ops = append(ops, dmiEnd())
+	// run the operations
+	data, err := dbg.dmiOps(ops)
+	if err != nil {
+		return nil, err
+	}
+	// check the command status
+	err = dbg.checkError(cmdStatus(data[len(data)-1]))
+	if err != nil {
+		return nil, err
+	}
+	// return the elements
+	val := make([]uint, n)
+	for i := range val {
+		if size == 64 {
+			val[i] = (uint(data[2*i]) << 32) | uint(data[2*i+1])
+		} else {
+			val[i] = uint(data[i])
+		}
+	}
+	return val, nil
+}
+
+// pbWrVPR writes the n elements of a vector register.
+func (dbg *Debug) pbWrVPR(reg uint, val []uint) error {
+	size := dbg.hart[dbg.hartid].info.MXLEN
+	pb := dbg.newProgramBuffer(2)
+	pb[0] = rv.InsVSLIDE1DOWN_VX(reg, reg, rv.RegS0)
+	// build the operations buffer
+	ops := pbOps(pb, 3*len(val)+2)
+	for _, v := range val {
+		// transfer data0/1 to s0 and postexec to slide it into the register
+		ops = append(ops, dmiWr(data0, uint32(v)))
+		if size == 64 {
+			ops = append(ops, dmiWr(data1, uint32(v>>32)))
+		}
+		ops = append(ops, dmiWr(command, cmdRegister(regGPR(rv.RegS0), sizeMap[size], cmdWrite|cmdPostExec)))
+	}
+	// read the command status
+	ops = append(ops, dmiRd(abstractcs))
+	// done
+	ops = append(ops, dmiEnd())
+	// run the operations
+	data, err := dbg.dmiOps(ops)
+	if err != nil {
+		return err
+	}
+	// check the command status
+	return dbg.checkError(cmdStatus(data[0]))
+}
+
+//-----------------------------------------------------------------------------
+
+// checkVPR checks for a valid vector register access.
+func (dbg *Debug) checkVPR(reg uint) error {
+	hi := dbg.hart[dbg.hartid]
+	if hi.info.VLEN == 0 {
+		return fmt.Errorf("hart%d has no vector registers", hi.info.ID)
+	}
+	if reg >= 32 {
+		return fmt.Errorf("v%d is invalid", reg)
+	}
+	return nil
+}
+
+// RdVPR reads a vector register as VLEN/MXLEN x MXLEN-bit elements.
+func (dbg *Debug) RdVPR(reg uint) ([]uint, error) {
+	err := dbg.checkVPR(reg)
+	if err != nil {
+		return nil, err
+	}
+	var val []uint
+	err = dbg.vecOp(func(n uint) error {
+		var err error
+		val, err = dbg.pbRdVPR(reg, n)
+		return err
+	})
+	return val, err
+}
+
+// WrVPR writes a vector register with VLEN/MXLEN x MXLEN-bit elements.
+func (dbg *Debug) WrVPR(reg uint, val []uint) error {
+	err := dbg.checkVPR(reg)
+	if err != nil {
+		return err
+	}
+	return dbg.vecOp(func(n uint) error {
+		if uint(len(val)) != n {
+			return fmt.Errorf("v%d has %d elements", reg, n)
+		}
+		return dbg.pbWrVPR(reg, val)
+	})
+}
+
+// getVLEN returns the vector register length for the current hart.
+func (dbg *Debug) getVLEN() (uint, error) {
+	var vlenb uint64
+	err := rv.VectorOp(dbg, func() error {
+		var err error
+		vlenb, err = dbg.RdCSR(rv.VLENB, 0)
+		return err
+	})
+	return 8 * uint(vlenb), err
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,686 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Semihosting
+
+A semihosting request is the sequence:
+
+	slli x0, x0, 0x1f
+	ebreak
+	srai x0, x0, 7
+
+The operation is in a0 and the parameter block address is in a1. The
+operations are those of ARM semihosting with XLEN sized parameters. The
+result is returned in a0 and the hart resumes after the ebreak.
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// semihosting sequence
+const (
+	shEntry = 0x01f01013 // slli x0, x0, 0x1f
+	shExit  = 0x40705013 // srai x0, x0, 7
+)
+
+// semihosting operations
+const (
+	sysOpen         = 0x01
+	sysClose        = 0x02
+	sysWritec       = 0x03
+	sysWrite0       = 0x04
+	sysWrite        = 0x05
+	sysRead         = 0x06
+	sysReadc        = 0x07
+	sysIsError      = 0x08
+	sysIsTTY        = 0x09
+	sysSeek         = 0x0a
+	sysFlen         = 0x0c
+	sysTmpnam       = 0x0d
+	sysRemove       = 0x0e
+	sysRename       = 0x0f
+	sysClock        = 0x10
+	sysTime         = 0x11
+	sysSystem       = 0x12
+	sysErrno        = 0x13
+	sysGetCmdline   = 0x15
+	sysHeapInfo     = 0x16
+	sysExit         = 0x18
+	sysExitExtended = 0x20
+	sysElapsed      = 0x30
+	sysTickFreq     = 0x31
+)
+
+var shOpName = map[uint]string{
+	sysOpen:         "SYS_OPEN",
+	sysClose:        "SYS_CLOSE",
+	sysWritec:       "SYS_WRITEC",
+	sysWrite0:       "SYS_WRITE0",
+	sysWrite:        "SYS_WRITE",
+	sysRead:         "SYS_READ",
+	sysReadc:        "SYS_READC",
+	sysIsError:      "SYS_ISERROR",
+	sysIsTTY:        "SYS_ISTTY",
+	sysSeek:         "SYS_SEEK",
+	sysFlen:         "SYS_FLEN",
+	sysTmpnam:       "SYS_TMPNAM",
+	sysRemove:       "SYS_REMOVE",
+	sysRename:       "SYS_RENAME",
+	sysClock:        "SYS_CLOCK",
+	sysTime:         "SYS_TIME",
+	sysSystem:       "SYS_SYSTEM",
+	sysErrno:        "SYS_ERRNO",
+	sysGetCmdline:   "SYS_GET_CMDLINE",
+	sysHeapInfo:     "SYS_HEAPINFO",
+	sysExit:         "SYS_EXIT",
+	sysExitExtended: "SYS_EXIT_EXTENDED",
+	sysElapsed:      "SYS_ELAPSED",
+	sysTickFreq:     "SYS_TICKFREQ",
+}
+
+const adpApplicationExit = 0x20026 // ADP_Stopped_ApplicationExit
+
+const shMaxString = 4096    // maximum length of a string or file name
+const shMaxRequests = 64    // maximum requests serviced per poll
+const shMaxBuffer = 1 << 20 // maximum bytes per read/write
+const shTickFreq = 1000000  // SYS_ELAPSED ticks per second
+
+// errno values
+const (
+	shEBADF  = 9
+	shEIO    = 5
+	shENOSYS = 38
+)
+
+// open modes (the "b" variants are the same)
+var shOpenFlag = [6]int{
+	os.O_RDONLY,                             // r
+	os.O_RDWR,                               // r+
+	os.O_WRONLY | os.O_CREATE | os.O_TRUNC,  // w
+	os.O_RDWR | os.O_CREATE | os.O_TRUNC,    // w+
+	os.O_WRONLY | os.O_CREATE | os.O_APPEND, // a
+	os.O_RDWR | os.O_CREATE | os.O_APPEND,   // a+
+}
+
+//-----------------------------------------------------------------------------
+
+// shFile is a file opened by the target.
+type shFile struct {
+	f   *os.File // host file (nil for the console)
+	tty bool     // is this the console?
+}
+
+// Semihost is the semihosting state for a target.
+type Semihost struct {
+	enabled bool             // service semihosting requests
+	files   map[uint]*shFile // open files
+	handle  uint             // next file handle
+	errno   uint             // last error number
+	start   time.Time        // start time for SYS_CLOCK
+}
+
+// NewSemihost returns the semihosting state for a target.
+// Semihosting is enabled, so ebreak is set to enter debug mode on all harts.
+func NewSemihost(dbg rv.Debug) (*Semihost, error) {
+	err := setEbreak(dbg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to enable semihosting: %v", err)
+	}
+	return &Semihost{
+		enabled: true,
+		files:   map[uint]*shFile{},
+		handle:  1,
+		start:   time.Now(),
+	}, nil
+}
+
+// Reset sets ebreak to enter debug mode on all harts after a reset.
+func (sh *Semihost) Reset(dbg rv.Debug) error {
+	if !sh.enabled {
+		return nil
+	}
+	return setEbreak(dbg)
+}
+
+// setErrno sets the errno value for an error.
+func (sh *Semihost) setErrno(err error) {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		sh.errno = uint(errno)
+		return
+	}
+	sh.errno = shEIO
+}
+
+// file returns the file for a handle.
+func (sh *Semihost) file(handle uint) *shFile {
+	f := sh.files[handle]
+	if f == nil {
+		sh.errno = shEBADF
+	}
+	return f
+}
+
+//-----------------------------------------------------------------------------
+
+// shRequest is a semihosting request.
+type shRequest struct {
+	dbg  rv.Debug
+	hi   *rv.HartInfo
+	user cli.USER
+	op   uint // operation
+	arg  uint // a1 (parameter block address)
+}
+
+// params reads n parameters from the parameter block.
+func (r *shRequest) params(n uint) ([]uint, error) {
+	return r.dbg.RdMem(r.hi.MXLEN, r.arg, n)
+}
+
+// rdBuf reads a byte buffer from target memory.
+func (r *shRequest) rdBuf(addr, n uint) ([]byte, error) {
+	x, err := r.dbg.RdMem(8, addr, n)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, len(x))
+	for i := range x {
+		buf[i] = byte(x[i])
+	}
+	return buf, nil
+}
+
+// wrBuf writes a byte buffer to target memory.
+func (r *shRequest) wrBuf(addr uint, buf []byte) error {
+	x := make([]uint, len(buf))
+	for i := range buf {
+		x[i] = uint(buf[i])
+	}
+	return r.dbg.WrMem(8, addr, x)
+}
+
+// shLength limits the length of a read/write buffer.
+func shLength(n uint) uint {
+	if n > shMaxBuffer {
+		return shMaxBuffer
+	}
+	return n
+}
+
+// rdString reads a null terminated string from target memory.
+func (r *shRequest) rdString(addr uint) (string, error) {
+	s := []byte{}
+	for len(s) < shMaxString {
+		buf, err := r.rdBuf(addr+uint(len(s)), 32)
+		if err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			if c == 0 {
+				return string(s), nil
+			}
+			s = append(s, c)
+		}
+	}
+	return "", fmt.Errorf("string at 0x%x is too long", addr)
+}
+
+// rdName reads a file name with a target supplied length.
+// It returns false (and sets errno) if the name is too long.
+func (r *shRequest) rdName(sh *Semihost, addr, n uint) (string, bool, error) {
+	if n > shMaxString {
+		sh.errno = uint(syscall.ENAMETOOLONG)
+		return "", false, nil
+	}
+	buf, err := r.rdBuf(addr, n)
+	if err != nil {
+		return "", false, err
+	}
+	return string(buf), true, nil
+}
+
+// open opens a file.
+func (r *shRequest) open(sh *Semihost) (int, error) {
+	p, err := r.params(3)
+	if err != nil {
+		return 0, err
+	}
+	name, ok, err := r.rdName(sh, p[0], p[2])
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return -1, nil
+	}
+	mode := p[1]
+	if mode >= 12 {
+		sh.errno = uint(syscall.EINVAL)
+		return -1, nil
+	}
+	f := &shFile{tty: name == ":tt"}
+	if !f.tty {
+		f.f, err = os.OpenFile(name, shOpenFlag[mode>>1], 0644)
+		if err != nil {
+			sh.setErrno(err)
+			return -1, nil
+		}
+	}
+	h := sh.handle
+	sh.handle++
+	sh.files[h] = f
+	return int(h), nil
+}
+
+// close closes a file.
+func (r *shRequest) close(sh *Semihost) (int, error) {
+	p, err := r.params(1)
+	if err != nil {
+		return 0, err
+	}
+	f := sh.file(p[0])
+	if f == nil {
+		return -1, nil
+	}
+	delete(sh.files, p[0])
+	if f.f != nil {
+		err := f.f.Close()
+		if err != nil {
+			sh.setErrno(err)
+			return -1, nil
+		}
+	}
+	return 0, nil
+}
+
+// write writes a buffer to a file and returns the number of bytes not written.
+func (r *shRequest) write(sh *Semihost) (int, error) {
+	p, err := r.params(3)
+	if err != nil {
+		return 0, err
+	}
+	f := sh.file(p[0])
+	if f == nil {
+		return int(p[2]), nil
+	}
+	buf, err := r.rdBuf(p[1], shLength(p[2]))
+	if err != nil {
+		return 0, err
+	}
+	if f.tty {
+		r.user.Put(string(buf))
+		return int(p[2]) - len(buf), nil
+	}
+	n, err := f.f.Write(buf)
+	if err != nil {
+		sh.setErrno(err)
+	}
+	return int(p[2]) - n, nil
+}
+
+// read reads a file into a buffer and returns the number of bytes not read.
+func (r *shRequest) read(sh *Semihost) (int, error) {
+	p, err := r.params(3)
+	if err != nil {
+		return 0, err
+	}
+	f := sh.file(p[0])
+	if f == nil || f.tty {
+		// console input is not supported, so it's always at EOF
+		return int(p[2]), nil
+	}
+	buf := make([]byte, shLength(p[2]))
+	n, err := io.ReadFull(f.f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		sh.setErrno(err)
+		return -1, nil
+	}
+	err = r.wrBuf(p[1], buf[:n])
+	if err != nil {
+		return 0, err
+	}
+	return int(p[2]) - n, nil
+}
+
+// seek seeks to an absolute file position.
+func (r *shRequest) seek(sh *Semihost) (int, error) {
+	p, err := r.params(2)
+	if err != nil {
+		return 0, err
+	}
+	f := sh.file(p[0])
+	if f == nil || f.tty {
+		return -1, nil
+	}
+	_, err = f.f.Seek(int64(p[1]), io.SeekStart)
+	if err != nil {
+		sh.setErrno(err)
+		return -1, nil
+	}
+	return 0, nil
+}
+
+// flen returns the length of a file.
+func (r *shRequest) flen(sh *Semihost) (int, error) {
+	p, err := r.params(1)
+	if err != nil {
+		return 0, err
+	}
+	f := sh.file(p[0])
+	if f == nil || f.tty {
+		return -1, nil
+	}
+	fi, err := f.f.Stat()
+	if err != nil {
+		sh.setErrno(err)
+		return -1, nil
+	}
+	return int(fi.Size()), nil
+}
+
+// remove deletes a file.
+func (r *shRequest) remove(sh *Semihost) (int, error) {
+	p, err := r.params(2)
+	if err != nil {
+		return 0, err
+	}
+	name, ok, err := r.rdName(sh, p[0], p[1])
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return -1, nil
+	}
+	err = os.Remove(name)
+	if err != nil {
+		sh.setErrno(err)
+		return -1, nil
+	}
+	return 0, nil
+}
+
+// rename renames a file.
+func (r *shRequest) rename(sh *Semihost) (int, error) {
+	p, err := r.params(4)
+	if err != nil {
+		return 0, err
+	}
+	oldName, ok, err := r.rdName(sh, p[0], p[1])
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return -1, nil
+	}
+	newName, ok, err := r.rdName(sh, p[2], p[3])
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return -1, nil
+	}
+	err = os.Rename(oldName, newName)
+	if err != nil {
+		sh.setErrno(err)
+		return -1, nil
+	}
+	return 0, nil
+}
+
+// service services a semihosting request and returns the result.
+func (r *shRequest) service(sh *Semihost) (int, error) {
+	switch r.op {
+	case sysOpen:
+		return r.open(sh)
+	case sysClose:
+		return r.close(sh)
+	case sysWritec:
+		buf, err := r.rdBuf(r.arg, 1)
+		if err != nil {
+			return 0, err
+		}
+		r.user.Put(string(buf))
+		return 0, nil
+	case sysWrite0:
+		s, err := r.rdString(r.arg)
+		if err != nil {
+			return 0, err
+		}
+		r.user.Put(s)
+		return 0, nil
+	case sysWrite:
+		return r.write(sh)
+	case sysRead:
+		return r.read(sh)
+	case sysReadc:
+		// console input is not supported
+		return -1, nil
+	case sysIsError:
+		p, err := r.params(1)
+		if err != nil {
+			return 0, err
+		}
+		// negative status values are errors
+		return int(util.Bits(p[0], r.hi.MXLEN-1, r.hi.MXLEN-1)), nil
+	case sysIsTTY:
+		p, err := r.params(1)
+		if err != nil {
+			return 0, err
+		}
+		f := sh.file(p[0])
+		if f == nil {
+			return -1, nil
+		}
+		return util.BoolToInt(f.tty), nil
+	case sysSeek:
+		return r.seek(sh)
+	case sysFlen:
+		return r.flen(sh)
+	case sysRemove:
+		return r.remove(sh)
+	case sysRename:
+		return r.rename(sh)
+	case sysClock:
+		return int(time.Since(sh.start) / (10 * time.Millisecond)), nil
+	case sysTime:
+		return int(time.Now().Unix()), nil
+	case sysErrno:
+		return int(sh.errno), nil
+	case sysGetCmdline:
+		// an empty command line
+		p, err := r.params(2)
+		if err != nil {
+			return 0, err
+		}
+		if p[1] == 0 {
+			return -1, nil
+		}
+		err = r.wrBuf(p[0], []byte{0})
+		if err != nil {
+			return 0, err
+		}
+		return 0, r.dbg.WrMem(r.hi.MXLEN, r.arg+(r.hi.MXLEN/8), []uint{0})
+	case sysHeapInfo:
+		// the heap and stack are unknown
+		p, err := r.params(1)
+		if err != nil {
+			return 0, err
+		}
+		return 0, r.dbg.WrMem(r.hi.MXLEN, p[0], []uint{0, 0, 0, 0})
+	case sysElapsed:
+		t := uint64(time.Since(sh.start) / (time.Second / shTickFreq))
+		return 0, r.dbg.WrMem(32, r.arg, []uint{uint(t & 0xffffffff), uint(t >> 32)})
+	case sysTickFreq:
+		return shTickFreq, nil
+	}
+	sh.errno = shENOSYS
+	return -1, nil
+}
+
+// exit returns the reason and exit code for an exit request.
+func (r *shRequest) exit() (uint, uint, error) {
+	if r.op == sysExit && r.hi.MXLEN == 32 {
+		return r.arg, 0, nil
+	}
+	p, err := r.params(2)
+	if err != nil {
+		return 0, 0, err
+	}
+	return p[0], p[1], nil
+}
+
+//-----------------------------------------------------------------------------
+
+// setEbreak sets ebreak to enter debug mode on all harts.
+func setEbreak(dbg rv.Debug) error {
+	return rv.AllHarts(dbg, func() error {
+		if dbg.GetCurrentHart().State == rv.Unknown {
+			return nil
+		}
+		return haltedOp(dbg, func(hi *rv.HartInfo) error {
+			return rv.SetEbreak(dbg, hi)
+		})
+	})
+}
+
+// isSemihost returns true if the instruction at the pc is a semihosting ebreak.
+func isSemihost(dbg rv.Debug, pc uint) bool {
+	// read as halfwords, the code may only be 2 byte aligned
+	x, err := dbg.RdMem(16, pc-4, 6)
+	if err != nil {
+		return false
+	}
+	ins := []uint32{}
+	for i := 0; i < len(x); i += 2 {
+		ins = append(ins, uint32(x[i]|x[i+1]<<16))
+	}
+	return ins[0] == shEntry && ins[1] == rv.InsEBREAK() && ins[2] == shExit
+}
+
+// semihostHalt services a semihosting request if the current hart halted on one.
+// It returns false if the halt was not a semihosting request. A non-empty
+// string is a message for the user and the hart is left halted.
+func semihostHalt(dbg rv.Debug, user cli.USER) (bool, string) {
+	sh := user.(target).GetSemihost()
+	if !sh.enabled {
+		return false, ""
+	}
+	hi := dbg.GetCurrentHart()
+	cause, pc, err := rv.GetHaltInfo(dbg)
+	if err != nil || cause != rv.CauseEbreak {
+		return false, ""
+	}
+	if hi.GetBreakpoints().AtAddr(pc) != nil || !isSemihost(dbg, pc) {
+		return false, ""
+	}
+	r := &shRequest{
+		dbg:  dbg,
+		hi:   hi,
+		user: user,
+	}
+	op, err := dbg.RdGPR(rv.RegA0, 0)
+	if err == nil {
+		var arg uint64
+		arg, err = dbg.RdGPR(rv.RegA1, 0)
+		r.op, r.arg = uint(op), uint(arg)
+	}
+	if err != nil {
+		return true, fmt.Sprintf("hart%d semihosting: %v", hi.ID, err)
+	}
+	// exit leaves the hart halted
+	if r.op == sysExit || r.op == sysExitExtended {
+		reason, code, err := r.exit()
+		if err != nil {
+			return true, fmt.Sprintf("hart%d semihosting %s: %v", hi.ID, shOpName[r.op], err)
+		}
+		if reason == adpApplicationExit {
+			return true, fmt.Sprintf("hart%d semihosting exit: %d", hi.ID, code)
+		}
+		return true, fmt.Sprintf("hart%d semihosting exit: reason 0x%x", hi.ID, reason)
+	}
+	ret, err := r.service(sh)
+	if err == nil {
+		err = dbg.WrGPR(rv.RegA0, 0, uint64(uint(ret)&util.Mask(hi.MXLEN-1, 0)))
+	}
+	if err == nil {
+		err = dbg.WrCSR(rv.DPC, 0, uint64(pc+4))
+	}
+	if err == nil {
+		err = hi.GetBreakpoints().Resume(dbg)
+	}
+	if err != nil {
+		name := shOpName[r.op]
+		if name == "" {
+			name = fmt.Sprintf("0x%x", r.op)
+		}
+		return true, fmt.Sprintf("hart%d semihosting %s: %v", hi.ID, name, err)
+	}
+	return true, ""
+}
+
+// semihostResume services a semihosting request while waiting for the current hart to halt.
+// It returns true if the hart has resumed. Messages for the user are output.
+func semihostResume(dbg rv.Debug, user cli.USER) bool {
+	ok, msg := semihostHalt(dbg, user)
+	if msg != "" {
+		user.Put(fmt.Sprintf("%s\n", msg))
+	}
+	return ok && msg == ""
+}
+
+//-----------------------------------------------------------------------------
+
+// SemihostHelp is help for the semihost command.
+var SemihostHelp = []cli.Help{
+	{"<cr>", "display the current setting"},
+	{"on", "service semihosting requests (default)"},
+	{"off", "leave harts halted on semihosting requests"},
+}
+
+// CmdSemihost enables or disables semihosting.
+var CmdSemihost = cli.Leaf{
+	Descr: "semihosting control",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		sh := c.User.(target).GetSemihost()
+		if len(args) == 1 {
+			switch args[0] {
+			case "on":
+				// ebreak needs to enter debug mode
+				err := setEbreak(c.User.(target).GetRiscvDebug())
+				if err != nil {
+					c.User.Put(fmt.Sprintf("%s\n", err))
+					return
+				}
+				sh.enabled = true
+			case "off":
+				sh.enabled = false
+			default:
+				c.User.Put(fmt.Sprintf("unknown argument \"%s\"\n", args[0]))
+				return
+			}
+		}
+		c.User.Put(fmt.Sprintf("semihosting is %s, %d open files\n", []string{"off", "on"}[util.BoolToInt(sh.enabled)], len(sh.files)))
+	},
+}
+
+//-----------------------------------------------------------------------------
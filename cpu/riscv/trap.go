@@ -0,0 +1,128 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Trap Menu Items
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"fmt"
+	"strings"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/sym"
+)
+
+//-----------------------------------------------------------------------------
+
+// tvalWords is the number of 32-bit words displayed at a tval address.
+const tvalWords = 4
+
+// addrString returns an address string with any symbol+offset.
+func addrString(symbols *sym.Table, addr uint) string {
+	if s := symbols.AddrString(addr); s != "" {
+		return fmt.Sprintf("0x%x (%s)", addr, s)
+	}
+	return fmt.Sprintf("0x%x", addr)
+}
+
+// trapString returns the decoded trap state for a privilege mode.
+func trapString(dbg rv.Debug, symbols *sym.Table, t *rv.Trap) string {
+	hi := dbg.GetCurrentHart()
+	s := [][]string{}
+	kind := "exception"
+	if t.Interrupt {
+		kind = "interrupt"
+	}
+	s = append(s, []string{t.Mode + "cause", fmt.Sprintf("0x%x %s %d: %s", t.Cause, kind, t.Code, t.Name())})
+	s = append(s, []string{t.Mode + "epc", addrString(symbols, t.EPC)})
+	s = append(s, []string{t.Mode + "tval", fmt.Sprintf("0x%x", t.TVAL)})
+	s = append(s, []string{t.Mode + "pp", t.PrevPriv})
+	s = append(s, []string{t.Mode + "pie", fmt.Sprintf("%t", t.PrevIE)})
+	x := []string{cli.TableString(s, []int{0, 0}, 1)}
+
+	// disassemble the instruction at xepc
+	if !t.Interrupt {
+		ins, err := hi.GetBreakpoints().RdIns(dbg, t.EPC)
+		if err != nil {
+			x = append(x, fmt.Sprintf("unable to read instruction at 0x%x: %v", t.EPC, err))
+		} else {
+			x = append(x, hi.ISA.Disassemble(t.EPC, ins).String())
+		}
+	}
+
+	// display the memory at xtval
+	if t.TvalAddress() {
+		addr := t.TVAL &^ 3
+		val, err := dbg.RdMem(32, addr, tvalWords)
+		if err != nil {
+			x = append(x, fmt.Sprintf("unable to read memory at 0x%x: %v", addr, err))
+		} else {
+			w := []string{}
+			for _, v := range val {
+				w = append(w, fmt.Sprintf("%08x", v))
+			}
+			x = append(x, fmt.Sprintf("%s: %s", addrString(symbols, addr), strings.Join(w, " ")))
+		}
+	}
+	return strings.Join(x, "\n")
+}
+
+// ExceptionHelp is help for the exception command.
+var ExceptionHelp = []cli.Help{
+	{"<cr>", "display the machine and supervisor trap state"},
+	{"m", "display the machine trap state"},
+	{"s", "display the supervisor trap state"},
+}
+
+// CmdException displays the decoded trap state of the current hart.
+var CmdException = cli.Leaf{
+	Descr: "display trap/exception state",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		symbols := c.User.(target).GetSymbols()
+		hi := dbg.GetCurrentHart()
+		modes := []bool{false}
+		if hi.SXLEN != 0 {
+			modes = append(modes, true)
+		}
+		if len(args) == 1 {
+			switch args[0] {
+			case "m":
+				modes = []bool{false}
+			case "s":
+				modes = []bool{true}
+			default:
+				c.User.Put(fmt.Sprintf("unknown argument \"%s\"\n", args[0]))
+				return
+			}
+		}
+		s := []string{}
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			for _, supervisor := range modes {
+				t, err := rv.GetTrap(dbg, supervisor)
+				if err != nil {
+					return err
+				}
+				s = append(s, trapString(dbg, symbols, t))
+			}
+			return nil
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", strings.Join(s, "\n\n")))
+	},
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,317 @@
+//-----------------------------------------------------------------------------
+/*
+
+RISC-V Vector Register Menu Items
+
+*/
+//-----------------------------------------------------------------------------
+
+package riscv
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/cpu/riscv/rv"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// vprIndex returns the register number for a vector register name.
+func vprIndex(name string) (uint, error) {
+	for i := 0; i < 32; i++ {
+		if name == fmt.Sprintf("v%d", i) {
+			return uint(i), nil
+		}
+	}
+	return 0, fmt.Errorf("no register \"%s\"", name)
+}
+
+// sewArg converts an element width argument (e8, e16, e32, e64) to a number of bits.
+func sewArg(arg string) (uint, error) {
+	switch strings.ToLower(arg) {
+	case "e8":
+		return 8, nil
+	case "e16":
+		return 16, nil
+	case "e32":
+		return 32, nil
+	case "e64":
+		return 64, nil
+	}
+	return 0, fmt.Errorf("bad element width \"%s\" (e8, e16, e32 or e64)", arg)
+}
+
+// vprBytes converts xlen-bit vector elements to little endian bytes.
+func vprBytes(val []uint, xlen uint) []byte {
+	b := make([]byte, 0, uint(len(val))*xlen/8)
+	for _, v := range val {
+		for i := uint(0); i < xlen; i += 8 {
+			b = append(b, byte(v>>i))
+		}
+	}
+	return b
+}
+
+// vprElements converts little endian bytes to sew-bit vector elements.
+func vprElements(b []byte, sew uint) []uint {
+	n := int(sew / 8)
+	val := make([]uint, 0, len(b)/n)
+	for i := 0; i < len(b); i += n {
+		var v uint
+		for j := n - 1; j >= 0; j-- {
+			v = (v << 8) | uint(b[i+j])
+		}
+		val = append(val, v)
+	}
+	return val
+}
+
+// vprHex returns the hex string for a vector register, most significant byte first.
+func vprHex(b []byte) string {
+	s := make([]byte, len(b))
+	for i := range b {
+		s[len(b)-1-i] = b[i]
+	}
+	return hex.EncodeToString(s)
+}
+
+// vprHexArg converts a hex argument to the little endian bytes of a vector register.
+func vprHexArg(arg string, vlen uint) ([]byte, error) {
+	arg = strings.TrimPrefix(strings.ToLower(arg), "0x")
+	n := int(vlen / 4)
+	if len(arg) > n {
+		return nil, fmt.Errorf("value is larger than %d bits", vlen)
+	}
+	x, err := hex.DecodeString(strings.Repeat("0", n-len(arg)) + arg)
+	if err != nil {
+		return nil, fmt.Errorf("bad hex value \"%s\"", arg)
+	}
+	b := make([]byte, len(x))
+	for i := range x {
+		b[len(x)-1-i] = x[i]
+	}
+	return b, nil
+}
+
+// vprString returns the display string for a vector register at each element width.
+func vprString(name string, b []byte) string {
+	s := []string{fmt.Sprintf("%s: %s", name, vprHex(b))}
+	for _, sew := range []uint{8, 16, 32, 64} {
+		e := []string{}
+		for _, v := range vprElements(b, sew) {
+			e = append(e, fmt.Sprintf("%0*x", sew/4, v))
+		}
+		s = append(s, fmt.Sprintf("e%-2d %s", sew, strings.Join(e, " ")))
+	}
+	return strings.Join(s, "\n")
+}
+
+//-----------------------------------------------------------------------------
+
+// VprHelp is help for the vpr command.
+var VprHelp = []cli.Help{
+	{"<cr>", "display all registers"},
+	{"<reg>", "display a register as raw hex and e8..e64 elements (element 0 first)"},
+	{"<reg> <value>", "write a register"},
+	{"<reg> <sew> <idx> <value>", "write a register element"},
+	{"  reg", "register name (v0..v31)"},
+	{"  sew", "element width (e8, e16, e32, e64)"},
+	{"  idx", "element index (decimal)"},
+	{"  value", "register/element value (hex)"},
+}
+
+// CmdVpr displays and writes the vector registers.
+var CmdVpr = cli.Leaf{
+	Descr: "display/write vector registers",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1, 2, 4})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		hi := dbg.GetCurrentHart()
+		if hi.VLEN == 0 {
+			c.User.Put(fmt.Sprintf("hart%d has no vector registers\n", hi.ID))
+			return
+		}
+
+		if len(args) == 0 {
+			s := []string{}
+			err := haltedOp(dbg, func(hi *rv.HartInfo) error {
+				for i := uint(0); i < 32; i++ {
+					val, err := dbg.RdVPR(i)
+					if err != nil {
+						return fmt.Errorf("unable to read v%d: %v", i, err)
+					}
+					s = append(s, fmt.Sprintf("%-3s %s", fmt.Sprintf("v%d", i), vprHex(vprBytes(val, hi.MXLEN))))
+				}
+				return nil
+			})
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			c.User.Put(fmt.Sprintf("%s\n", strings.Join(s, "\n")))
+			return
+		}
+
+		name := strings.ToLower(args[0])
+		reg, err := vprIndex(name)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+
+		// get the new register value
+		var wr func(b []byte) ([]byte, error)
+		switch len(args) {
+		case 2:
+			x, err := vprHexArg(args[1], hi.VLEN)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			wr = func(b []byte) ([]byte, error) { return x, nil }
+		case 4:
+			sew, err := sewArg(args[1])
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			idx, err := cli.UintArg(args[2], [2]uint{0, (hi.VLEN / sew) - 1}, 10)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			val, err := hexArg(args[3], util.Mask(sew-1, 0))
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			wr = func(b []byte) ([]byte, error) {
+				k := idx * sew / 8
+				for i := uint(0); i < sew/8; i++ {
+					b[k+i] = byte(val >> (8 * i))
+				}
+				return b, nil
+			}
+		}
+
+		var s string
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			val, err := dbg.RdVPR(reg)
+			if err != nil {
+				return err
+			}
+			b := vprBytes(val, hi.MXLEN)
+			if wr != nil {
+				b, _ = wr(b)
+				err = dbg.WrVPR(reg, vprElements(b, hi.MXLEN))
+				if err != nil {
+					return err
+				}
+				// read back
+				val, err = dbg.RdVPR(reg)
+				if err != nil {
+					return err
+				}
+				b = vprBytes(val, hi.MXLEN)
+			}
+			s = vprString(name, b)
+			return nil
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("unable to access %s: %v\n", name, err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", s))
+	},
+}
+
+//-----------------------------------------------------------------------------
+
+// VcsrHelp is help for the vcsr command.
+var VcsrHelp = []cli.Help{
+	{"<cr>", "display the vector control and status registers"},
+	{"<register> <value>", "write a register, value (hex)"},
+	{"<register>.<field>=<value>", "write a register field, value (hex)"},
+	{"  register", "vstart, vxsat, vxrm or vcsr (the others are read-only)"},
+}
+
+// CmdVcsr displays and writes the vector control and status registers.
+var CmdVcsr = cli.Leaf{
+	Descr: "display/write vector control and status registers",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1, 2})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		dbg := c.User.(target).GetRiscvDebug()
+		hi := dbg.GetCurrentHart()
+		if hi.VLEN == 0 {
+			c.User.Put(fmt.Sprintf("hart%d has no vector unit\n", hi.ID))
+			return
+		}
+		csr, drv := c.User.(target).GetCSR()
+		p, _ := csr.GetPeripheral("CSR")
+
+		if len(args) != 0 {
+			name := strings.ToLower(strings.SplitN(strings.SplitN(args[0], "=", 2)[0], ".", 2)[0])
+			ok := false
+			for _, n := range rv.VectorNames {
+				ok = ok || n == name
+			}
+			if !ok {
+				c.User.Put(fmt.Sprintf("\"%s\" is not a vector csr\n", name))
+				return
+			}
+			// vl, vtype and vlenb are read-only (csr[11:10] == 3), they are set by vset{i}vl{i}
+			r, err := p.GetRegister(name)
+			if err != nil {
+				c.User.Put(fmt.Sprintf("%s\n", err))
+				return
+			}
+			if r.Offset>>10 == 3 {
+				c.User.Put(fmt.Sprintf("%s is read-only\n", name))
+				return
+			}
+			if len(args) == 1 && !strings.Contains(args[0], "=") {
+				c.User.Put("no value to write\n")
+				return
+			}
+		}
+
+		s := []string{}
+		err = haltedOp(dbg, func(hi *rv.HartInfo) error {
+			return rv.VectorOp(dbg, func() error {
+				if len(args) != 0 {
+					csrWrite(c, p, drv, args)
+					return nil
+				}
+				for _, name := range rv.VectorNames {
+					r, err := p.GetRegister(name)
+					if err != nil {
+						return err
+					}
+					s = append(s, p.Display(drv, r, true))
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		if len(s) != 0 {
+			c.User.Put(fmt.Sprintf("%s\n", strings.Join(s, "\n")))
+		}
+	},
+}
+
+//-----------------------------------------------------------------------------
@@ -245,4 +245,75 @@ func (drv *Jtag) ScanDR(tdi *bitstr.BitString, idle uint, needTdo bool) (*bitstr
 	return drv.scanXR(tdi, idle, needTdo)
 }
 
+// scanDRSeq returns the JTAG sequence for a complete DR scan, run-test/idle -> run-test/idle.
+func scanDRSeq(tdi *bitstr.BitString, idle uint, needTdo bool) []jtagSeq {
+	seq := []jtagSeq{
+		{infoTms | 1, []byte{0}}, // run-test/idle -> select-dr-scan
+		{2, []byte{0}},           // select-dr-scan -> capture-dr -> shift-dr
+	}
+	seq = append(seq, bitStringToJtagSeq(tdi.Copy(), needTdo)...)
+	// exit1-dr -> update-dr -> run-test/idle (+ idle cycles)
+	seq = append(seq, jtagSeq{infoTms | 1, []byte{0}})
+	seq = append(seq, jtagSeq{byte(idle + 1), make([]byte, (idle+8)>>3)})
+	return seq
+}
+
+// seqTdo returns the TDO bit string for a JTAG sequence from the response bytes.
+// The TDO bytes for each sequence element are byte aligned.
+func seqTdo(seq []jtagSeq, rx []byte) (*bitstr.BitString, []byte) {
+	tdo := bitstr.Null()
+	for i := range seq {
+		n := seq[i].nTdoBytes()
+		if n != 0 {
+			tdo.Tail(bitstr.FromBytes(rx[:n], seq[i].nBits()))
+			rx = rx[n:]
+		}
+	}
+	return tdo, rx
+}
+
+// ScanDRBatch scans a batch of bit strings through the JTAG DR chain.
+// The scans are combined into as few JTAG sequence commands as the packet size allows.
+func (drv *Jtag) ScanDRBatch(tdi []*bitstr.BitString, idle uint, needTdo bool) ([]*bitstr.BitString, error) {
+	rd := []*bitstr.BitString{}
+	for len(tdi) > 0 {
+		// build the sequence for as many scans as will fit in a packet
+		scans := [][]jtagSeq{}
+		seq := []jtagSeq{}
+		nTx := 3 // report, command, count
+		nRx := 2 // command, status
+		for _, x := range tdi {
+			s := scanDRSeq(x, idle, needTdo)
+			tx, rx := 0, 0
+			for i := range s {
+				tx += 1 + s[i].nTdiBytes()
+				rx += s[i].nTdoBytes()
+			}
+			if len(scans) != 0 && (nTx+tx > drv.dev.pktSize || nRx+rx > drv.dev.pktSize || len(seq)+len(s) > 255) {
+				break
+			}
+			scans = append(scans, s)
+			seq = append(seq, s...)
+			nTx += tx
+			nRx += rx
+		}
+		rx, err := drv.dev.cmdJtagSequence(seq)
+		if err != nil {
+			return nil, err
+		}
+		if needTdo {
+			for _, s := range scans {
+				var tdo *bitstr.BitString
+				tdo, rx = seqTdo(s, rx)
+				rd = append(rd, tdo)
+			}
+		}
+		tdi = tdi[len(scans):]
+	}
+	if !needTdo {
+		return nil, nil
+	}
+	return rd, nil
+}
+
 //-----------------------------------------------------------------------------
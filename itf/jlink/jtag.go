@@ -215,4 +215,50 @@ func (drv *Jtag) ScanDR(tdi *bitstr.BitString, idle uint, needTdo bool) (*bitstr
 	return nil, nil
 }
 
+// maxBatchBits is the maximum number of TCK cycles in a batched jtagIO operation.
+const maxBatchBits = 4096
+
+// ScanDRBatch scans a batch of bit strings through the JTAG DR chain.
+// The scans are combined into as few jtagIO operations as possible.
+func (drv *Jtag) ScanDRBatch(tdi []*bitstr.BitString, idle uint, needTdo bool) ([]*bitstr.BitString, error) {
+	shiftToIdle := jtag.ShiftToIdle[idle]
+	head := jtag.IdleToDRshift.Len()
+	tail := shiftToIdle.Len() - 1
+	rd := []*bitstr.BitString{}
+	for len(tdi) > 0 {
+		// build the tms/tdi bit strings for as many scans as will fit
+		tms := bitstr.Null()
+		wr := bitstr.Null()
+		n := 0
+		for n < len(tdi) {
+			k := head + tdi[n].Len() + tail
+			if n != 0 && wr.Len()+k > maxBatchBits {
+				break
+			}
+			tms.Tail(jtag.IdleToDRshift).Tail0(tdi[n].Len() - 1).Tail(shiftToIdle)
+			wr.Tail0(head).Tail(tdi[n]).Tail0(tail)
+			n++
+		}
+		tdo, err := drv.jtagIO(tms, wr, needTdo)
+		if err != nil {
+			return nil, err
+		}
+		if needTdo {
+			// split the tdo bits into the scan results
+			ofs := 0
+			for i := 0; i < n; i++ {
+				k := head + tdi[i].Len() + tail
+				x := tdo.Copy().DropHead(ofs + head).DropTail(tdo.Len() - ofs - k + tail)
+				rd = append(rd, x)
+				ofs += k
+			}
+		}
+		tdi = tdi[n:]
+	}
+	if !needTdo {
+		return nil, nil
+	}
+	return rd, nil
+}
+
 //-----------------------------------------------------------------------------
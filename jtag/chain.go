@@ -44,6 +44,7 @@ type Driver interface {
 	TapReset() error
 	ScanIR(tdi *bitstr.BitString, needTdo bool) (*bitstr.BitString, error)
 	ScanDR(tdi *bitstr.BitString, idle uint, needTdo bool) (*bitstr.BitString, error)
+	ScanDRBatch(tdi []*bitstr.BitString, idle uint, needTdo bool) ([]*bitstr.BitString, error)
 	GetState() (*State, error)
 	Close() error
 }
@@ -91,11 +92,12 @@ func (ci ChainInfo) irLengthTotal() int {
 
 // Chain stores the state for JTAG chain.
 type Chain struct {
-	drv   Driver    // jtag driver
-	info  ChainInfo // device chain information
-	dev   []*Device // devices on the chain
-	n     int       // number of devices on the chain
-	irlen int       // total IR length
+	drv    Driver    // jtag driver
+	info   ChainInfo // device chain information
+	dev    []*Device // devices on the chain
+	n      int       // number of devices on the chain
+	irlen  int       // total IR length
+	resets int       // number of TAP resets from chain scans
 }
 
 // NewChain returns the interface object for a JTAG chain.
@@ -9,6 +9,7 @@ JTAG Menu Items
 package jtag
 
 import (
+	"errors"
 	"fmt"
 
 	cli "github.com/deadsy/go-cli"
@@ -17,25 +18,59 @@ import (
 //-----------------------------------------------------------------------------
 
 // target provides a method for getting the JTAG device.
+// The device is nil if the chain could not be setup.
 type target interface {
 	GetJtagDevice() *Device
 }
 
+// scanTarget is implemented by targets that scan the chain themselves.
+type scanTarget interface {
+	JtagScan() (ChainInfo, error)
+}
+
 //-----------------------------------------------------------------------------
 
 var cmdJtagChain = cli.Leaf{
 	Descr: "display jtag chain state",
 	F: func(c *cli.CLI, args []string) {
-		chain := c.User.(target).GetJtagDevice().chain
-		c.User.Put(fmt.Sprintf("%s\n", chain))
+		dev := c.User.(target).GetJtagDevice()
+		if dev == nil {
+			c.User.Put("no jtag chain\n")
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", dev.chain))
 	},
 }
 
 var cmdJtagDriver = cli.Leaf{
 	Descr: "display jtag driver state",
 	F: func(c *cli.CLI, args []string) {
-		drv := c.User.(target).GetJtagDevice().drv
-		c.User.Put(fmt.Sprintf("%s\n", drv))
+		dev := c.User.(target).GetJtagDevice()
+		if dev == nil {
+			c.User.Put("no jtag device\n")
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", dev.drv))
+	},
+}
+
+var cmdJtagScan = cli.Leaf{
+	Descr: "scan the jtag chain",
+	F: func(c *cli.CLI, args []string) {
+		var info ChainInfo
+		var err error
+		if t, ok := c.User.(scanTarget); ok {
+			info, err = t.JtagScan()
+		} else if dev := c.User.(target).GetJtagDevice(); dev != nil {
+			info, err = dev.chain.Scan()
+		} else {
+			err = errors.New("no jtag chain")
+		}
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n\n%s\n", info, info.Source("Chain")))
 	},
 }
 
@@ -51,6 +86,7 @@ var cmdJtagSurvey = cli.Leaf{
 var Menu = cli.Menu{
 	{"chain", cmdJtagChain},
 	{"driver", cmdJtagDriver},
+	{"scan", cmdJtagScan},
 	//{"survey", cmdJtagSurvey},
 }
 
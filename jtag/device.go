@@ -11,6 +11,7 @@ package jtag
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/deadsy/rvdbg/bitstr"
 )
@@ -91,6 +92,24 @@ func (dev *Device) RdWrDR(wr *bitstr.BitString, idle uint) (*bitstr.BitString, e
 	return tdo, nil
 }
 
+// RdWrDRBatch reads and writes DR for a device with a batch of scans.
+// The scans are sent to the driver together to minimise the interface round trips.
+func (dev *Device) RdWrDRBatch(wr []*bitstr.BitString, idle uint) ([]*bitstr.BitString, error) {
+	tdi := make([]*bitstr.BitString, len(wr))
+	for i := range wr {
+		tdi[i] = bitstr.Ones(dev.devsBefore).Tail(wr[i]).Tail1(dev.devsAfter)
+	}
+	tdo, err := dev.drv.ScanDRBatch(tdi, idle, true)
+	if err != nil {
+		return nil, err
+	}
+	// strip the DR bits from the bypassed devices
+	for i := range tdo {
+		tdo[i].DropHead(dev.devsBefore).DropTail(dev.devsAfter)
+	}
+	return tdo, nil
+}
+
 // testIRCapture tests the IR capture result.
 func (dev *Device) testIRCapture() (bool, error) {
 	// write all-1s to the IR
@@ -103,6 +122,11 @@ func (dev *Device) testIRCapture() (bool, error) {
 	return val&3 == 1, nil
 }
 
+// SystemReset pulses the system reset line of the JTAG interface.
+func (dev *Device) SystemReset(delay time.Duration) error {
+	return dev.drv.SystemReset(delay)
+}
+
 // GetIRLength returns the IR length for the device.
 func (dev *Device) GetIRLength() int {
 	return dev.irlen
@@ -141,6 +165,12 @@ func (dev *Device) CheckDR(ir uint, drlen int) (uint, error) {
 	return uint(tdo.Split([]int{drlen})[0]), nil
 }
 
+// TapResets returns the number of TAP resets from chain scans.
+// A TAP reset changes the IR of the device, so a cached IR value is invalid.
+func (dev *Device) TapResets() int {
+	return dev.chain.resets
+}
+
 // GetIDCode returns the JTAG ID code for the device.
 func (dev *Device) GetIDCode() IDCode {
 	return dev.idcode
@@ -0,0 +1,322 @@
+//-----------------------------------------------------------------------------
+/*
+
+JTAG Chain Discovery
+
+Work out the devices on a JTAG chain without prior knowledge of the board.
+
+1) Count the devices by putting them all into bypass mode.
+2) Read the IDCODEs left in the DR chain by a TAP reset. A device without
+an IDCODE register selects the 1-bit bypass register.
+3) Split the IR capture value into per-device IR lengths. Each device
+captures xx..xx01 so the split may be ambiguous, the IR lengths of IDCODEs
+in known chains are used to resolve it.
+
+*/
+//-----------------------------------------------------------------------------
+
+package jtag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/bitstr"
+	"github.com/deadsy/rvdbg/util"
+)
+
+//-----------------------------------------------------------------------------
+
+// irHints returns the IR lengths for the IDCODEs in known chains (the version bits are ignored).
+func irHints(known []ChainInfo) map[uint]int {
+	hint := map[uint]int{}
+	for _, ci := range known {
+		for _, d := range ci {
+			if d.ID == 0 || d.IRLength == 0 {
+				continue
+			}
+			code := uint(d.ID) & 0x0fffffff
+			if n, ok := hint[code]; ok {
+				if n != d.IRLength {
+					// conflicting IR lengths are no help
+					hint[code] = 0
+				}
+				continue
+			}
+			hint[code] = d.IRLength
+		}
+	}
+	return hint
+}
+
+// mfgARM is the JEP106 manufacturer code for ARM Ltd.
+const mfgARM = 0x23b
+
+// irLengthHint returns the known IR length for an IDCODE (0 is unknown).
+func irLengthHint(hint map[uint]int, id IDCode) int {
+	code := uint(id)
+	if n := hint[code&0x0fffffff]; n != 0 {
+		return n
+	}
+	// ARM JTAG-DPs have a 4-bit IR
+	if util.Bits(code, 11, 1) == mfgARM {
+		return 4
+	}
+	return 0
+}
+
+// validIDCode returns true if an IDCODE has a valid manufacturer code.
+func validIDCode(code uint) bool {
+	// 0x7f is reserved for detecting the end of the chain
+	return code&1 == 1 && util.Bits(code, 7, 1) != 0x7f
+}
+
+//-----------------------------------------------------------------------------
+
+// bitValues returns a bit string as a slice of bit values (first bit out first).
+func bitValues(b *bitstr.BitString) []uint {
+	n := make([]int, b.Len())
+	for i := range n {
+		n[i] = 1
+	}
+	return b.Split(n)
+}
+
+// onesOnly returns true if all the bit values are 1.
+func onesOnly(x []uint) bool {
+	for _, v := range x {
+		if v != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseIDCodes returns the IDCODEs for n devices from the DR chain after a TAP reset.
+// Devices without an IDCODE register have a 0 IDCODE. The DR chain was
+// scanned with ones, so any bits after the last device are ones.
+func parseIDCodes(dr []uint, n int) []IDCode {
+	code := make([]IDCode, 0, n)
+	i := 0
+	for len(code) < n && i < len(dr) {
+		if dr[i] == 0 {
+			// bypass register
+			code = append(code, 0)
+			i++
+			continue
+		}
+		if i+idcodeLength > len(dr) {
+			break
+		}
+		x := uint(0)
+		for j := 0; j < idcodeLength; j++ {
+			x |= dr[i+j] << j
+		}
+		if !validIDCode(x) {
+			break
+		}
+		code = append(code, IDCode(x))
+		i += idcodeLength
+	}
+	if len(code) == n && onesOnly(dr[i:]) {
+		return code
+	}
+	// Not per the standard, but some devices have IDCODEs with a 0 leading bit.
+	// Assume every device has a 32-bit IDCODE.
+	code = code[:0]
+	for i := 0; i < n; i++ {
+		x := uint(0)
+		for j := 0; j < idcodeLength; j++ {
+			x |= dr[(i*idcodeLength)+j] << j
+		}
+		code = append(code, IDCode(x))
+	}
+	return code
+}
+
+const maxSplits = 16 // maximum number of IR length solutions
+
+// irSplitter splits the IR capture value into per-device IR lengths.
+type irSplitter struct {
+	capture []uint  // IR capture bits
+	hint    []int   // known IR lengths (0 is unknown)
+	irlen   []int   // current solution
+	split   [][]int // IR length solutions
+}
+
+func (s *irSplitter) search(pos, idx int) {
+	if len(s.split) >= maxSplits {
+		return
+	}
+	n := len(s.hint)
+	if idx == n {
+		if pos == len(s.capture) {
+			s.split = append(s.split, append([]int{}, s.irlen...))
+		}
+		return
+	}
+	// the device capture value is xx..xx01
+	if pos+2 > len(s.capture) || s.capture[pos] != 1 || s.capture[pos+1] != 0 {
+		return
+	}
+	// leave at least 2 bits for the remaining devices
+	maxLen := len(s.capture) - pos - (2 * (n - idx - 1))
+	for l := 2; l <= maxLen; l++ {
+		if s.hint[idx] != 0 && l != s.hint[idx] {
+			continue
+		}
+		s.irlen[idx] = l
+		s.search(pos+l, idx+1)
+	}
+}
+
+// irLengths returns the IR length for each device (0 if it is ambiguous).
+func irLengths(capture []uint, hint []int) ([]int, error) {
+	s := &irSplitter{
+		capture: capture,
+		hint:    hint,
+		irlen:   make([]int, len(hint)),
+	}
+	s.search(0, 0)
+	if len(s.split) == 0 {
+		return nil, errors.New("jtag scan: the ir capture value does not match the devices")
+	}
+	if len(s.split) >= maxSplits {
+		// there may be other solutions, only the hinted lengths are known
+		return append([]int{}, hint...), nil
+	}
+	irlen := s.split[0]
+	for _, x := range s.split[1:] {
+		for i := range irlen {
+			if x[i] != irlen[i] {
+				irlen[i] = 0
+			}
+		}
+	}
+	return irlen, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Scan discovers the devices on a JTAG chain.
+// The IR lengths of devices in the known chains resolve ambiguous IR splits.
+// Devices with an ambiguous IR length have a 0 IRLength.
+// The TAP state machines of all devices are reset.
+func Scan(drv Driver, known ...ChainInfo) (ChainInfo, error) {
+	ch := &Chain{drv: drv}
+	err := drv.TapReset()
+	if err != nil {
+		return nil, err
+	}
+	// how many devices are on the chain?
+	n, err := ch.numDevices()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.New("jtag scan: no devices found")
+	}
+	if n > maxDevices {
+		return nil, fmt.Errorf("jtag scan: too many devices (%d)", n)
+	}
+	// get the total IR length
+	irlen, err := ch.irLength()
+	if err != nil {
+		return nil, err
+	}
+	// a TAP reset leaves the idcodes in the DR chain
+	err = drv.TapReset()
+	if err != nil {
+		return nil, err
+	}
+	tdo, err := drv.ScanDR(bitstr.Ones(n*idcodeLength), 0, true)
+	if err != nil {
+		return nil, err
+	}
+	code := parseIDCodes(bitValues(tdo), n)
+	// a TAP reset leaves the capture values in the IR chain
+	err = drv.TapReset()
+	if err != nil {
+		return nil, err
+	}
+	tdo, err = drv.ScanIR(bitstr.Ones(irlen), true)
+	if err != nil {
+		return nil, err
+	}
+	// leave the devices with the IDCODE (or BYPASS) instruction
+	err = drv.TapReset()
+	if err != nil {
+		return nil, err
+	}
+	// work out the IR lengths
+	irHint := irHints(known)
+	hint := make([]int, n)
+	for i := range hint {
+		hint[i] = irLengthHint(irHint, code[i])
+	}
+	ir, err := irLengths(bitValues(tdo), hint)
+	if err != nil {
+		return nil, err
+	}
+	info := make(ChainInfo, n)
+	for i := range info {
+		info[i] = DeviceInfo{
+			IRLength: ir[i],
+			ID:       code[i],
+			Name:     fmt.Sprintf("dev%d", i),
+		}
+	}
+	return info, nil
+}
+
+// Scan re-discovers the devices on the JTAG chain.
+// The chain information and the known chains resolve ambiguous IR splits.
+// The TAP reset is recorded so devices can re-write their IR.
+func (ch *Chain) Scan(known ...ChainInfo) (ChainInfo, error) {
+	ch.resets++
+	return Scan(ch.drv, append([]ChainInfo{ch.info}, known...)...)
+}
+
+//-----------------------------------------------------------------------------
+
+// Complete returns true if the IR length of every device is known.
+func (ci ChainInfo) Complete() bool {
+	for _, d := range ci {
+		if d.IRLength == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (ci ChainInfo) String() string {
+	s := [][]string{}
+	for i, d := range ci {
+		irlen := "?"
+		if d.IRLength != 0 {
+			irlen = fmt.Sprintf("%d", d.IRLength)
+		}
+		id := "no idcode"
+		if d.ID != 0 {
+			id = d.ID.String()
+		}
+		s = append(s, []string{fmt.Sprintf("idx %d", i), d.Name, fmt.Sprintf("irlen %s", irlen), id})
+	}
+	return cli.TableString(s, []int{0, 0, 0, 0}, 1)
+}
+
+// Source returns the chain information as Go source.
+func (ci ChainInfo) Source(name string) string {
+	s := []string{}
+	s = append(s, fmt.Sprintf("var %s = []jtag.DeviceInfo{", name))
+	s = append(s, "\t// irlen, idcode, name")
+	for _, d := range ci {
+		s = append(s, fmt.Sprintf("\t{%d, jtag.IDCode(0x%08x), \"%s\"},", d.IRLength, uint(d.ID), d.Name))
+	}
+	s = append(s, "}")
+	return strings.Join(s, "\n")
+}
+
+//-----------------------------------------------------------------------------
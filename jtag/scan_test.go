@@ -0,0 +1,143 @@
+//-----------------------------------------------------------------------------
+/*
+
+JTAG chain discovery test functions.
+
+*/
+//-----------------------------------------------------------------------------
+
+package jtag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+// bits converts a string of 0/1 characters to bit values.
+func bits(s string) []uint {
+	s = strings.ReplaceAll(s, " ", "")
+	x := make([]uint, len(s))
+	for i := range s {
+		x[i] = uint(s[i] - '0')
+	}
+	return x
+}
+
+func Test_IRLengths(t *testing.T) {
+	tests := []struct {
+		capture string
+		hint    []int
+		irlen   []int
+	}{
+		{"10000", []int{0}, []int{5}},
+		{"10000 10000", []int{0, 0}, []int{5, 5}},
+		{"1000 10000 10", []int{0, 0, 0}, []int{4, 5, 2}},
+		{"10 10 10", []int{0, 0}, []int{0, 0}},
+		{"10 10 10", []int{2, 0}, []int{2, 4}},
+		{"10 10 10", []int{0, 2}, []int{4, 2}},
+		// too many solutions, only the hints are known
+		{"10 10 10 10 10 10 10 10 10 10 10 10", []int{0, 0, 0, 0}, []int{0, 0, 0, 0}},
+		{"10 10 10 10 10 10 10 10 10 10 10 10", []int{0, 2, 0, 0}, []int{0, 2, 0, 0}},
+	}
+	for _, v := range tests {
+		irlen, err := irLengths(bits(v.capture), v.hint)
+		if err != nil {
+			t.Errorf("%s %v: %s", v.capture, v.hint, err)
+			continue
+		}
+		if !reflect.DeepEqual(irlen, v.irlen) {
+			t.Errorf("%s %v: expected %v, got %v", v.capture, v.hint, v.irlen, irlen)
+		}
+	}
+	// captures that don't match the devices
+	bad := []struct {
+		capture string
+		hint    []int
+	}{
+		{"01000", []int{0}},
+		{"10000", []int{4}},
+		{"10000", []int{0, 0}},
+	}
+	for _, v := range bad {
+		_, err := irLengths(bits(v.capture), v.hint)
+		if err == nil {
+			t.Errorf("%s %v: expected an error", v.capture, v.hint)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// drChain returns the DR chain after a TAP reset for a set of IDCODEs (0 is a
+// bypass register). The chain is scanned with 32 ones per device.
+func drChain(code []uint) []uint {
+	dr := []uint{}
+	for _, x := range code {
+		if x == 0 {
+			dr = append(dr, 0)
+			continue
+		}
+		for j := 0; j < idcodeLength; j++ {
+			dr = append(dr, (x>>j)&1)
+		}
+	}
+	for len(dr) < len(code)*idcodeLength {
+		dr = append(dr, 1)
+	}
+	return dr[:len(code)*idcodeLength]
+}
+
+func Test_ParseIDCodes(t *testing.T) {
+	tests := [][]uint{
+		{0x20000913},
+		{0x1000563d, 0x790007a3},
+		{0x5ba00477, 0x4ba00477, 0x0490817f, 0x0490817f},
+		{0x20000913, 0, 0x04e4796b},
+		{0, 0},
+		// the leading bit of the first IDCODE is 0
+		{0x476220a0, 0x006dc17f, 0x006dc17f, 0x5ba00477, 0x0d31017f},
+	}
+	for _, v := range tests {
+		code := parseIDCodes(drChain(v), len(v))
+		expect := make([]IDCode, len(v))
+		for i := range v {
+			expect[i] = IDCode(v[i])
+		}
+		if !reflect.DeepEqual(code, expect) {
+			t.Errorf("expected %v, got %v", expect, code)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_IRHints(t *testing.T) {
+	known := []ChainInfo{
+		{{5, IDCode(0x1000563d), "a"}, {5, IDCode(0x790007a3), "b"}},
+		{{4, IDCode(0x5ba00477), "c"}, {0, IDCode(0x12345677), "d"}},
+		{{5, IDCode(0x2000563d), "e"}, {8, IDCode(0x390007a3), "f"}},
+	}
+	hint := irHints(known)
+	tests := []struct {
+		id    uint
+		irlen int
+	}{
+		{0x0000563d, 5}, // version bits are ignored
+		{0x090007a3, 0}, // conflicting lengths
+		{0x0ba00477, 4},
+		{0x0ba01477, 4}, // ARM JTAG-DP
+		{0x02345677, 0}, // unknown length
+		{0x00000913, 0}, // not in the known chains
+	}
+	for _, v := range tests {
+		irlen := irLengthHint(hint, IDCode(v.id))
+		if irlen != v.irlen {
+			t.Errorf("0x%08x: expected %d, got %d", v.id, v.irlen, irlen)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -19,6 +19,52 @@ import (
 
 //-----------------------------------------------------------------------------
 
+// getDriver returns the memory driver for the memory commands.
+func getDriver(c *cli.CLI) Driver {
+	drv := c.User.(target).GetMemoryDriver()
+	if t, ok := c.User.(translator); ok && t.GetVirtualMode() {
+		return NewVirtualDriver(drv, t.GetTranslator())
+	}
+	return drv
+}
+
+var helpVirtual = []cli.Help{
+	{"<cr>", "display the current setting"},
+	{"on", "memory addresses are virtual"},
+	{"off", "memory addresses are physical (default)"},
+}
+
+var cmdVirtual = cli.Leaf{
+	Descr: "virtual address mode",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{0, 1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		t, ok := c.User.(translator)
+		if !ok {
+			c.User.Put("virtual addresses are not supported for this target\n")
+			return
+		}
+		if len(args) == 1 {
+			switch args[0] {
+			case "on":
+				t.SetVirtualMode(true)
+			case "off":
+				t.SetVirtualMode(false)
+			default:
+				c.User.Put(fmt.Sprintf("unknown argument \"%s\"\n", args[0]))
+				return
+			}
+		}
+		mode := []string{"physical", "virtual"}[util.BoolToInt(t.GetVirtualMode())]
+		c.User.Put(fmt.Sprintf("memory addresses are %s\n", mode))
+	},
+}
+
+//-----------------------------------------------------------------------------
+
 var helpMemRegion = []cli.Help{
 	{"<addr/name> [len]", "memory region"},
 	{"  addr", "address (hex), default is 0"},
@@ -30,7 +76,7 @@ var helpMemRegion = []cli.Help{
 // memory display
 
 func display(c *cli.CLI, args []string, width uint) {
-	drv := c.User.(target).GetMemoryDriver()
+	drv := getDriver(c)
 	r, err := RegionArg(drv, args)
 	if err != nil {
 		c.User.Put(fmt.Sprintf("%s\n", err))
@@ -85,7 +131,7 @@ var helpMemRead = []cli.Help{
 }
 
 func cmdRead(c *cli.CLI, args []string, width uint) {
-	drv := c.User.(target).GetMemoryDriver()
+	drv := getDriver(c)
 	_ = drv
 }
 
@@ -127,7 +173,7 @@ var helpMemWrite = []cli.Help{
 }
 
 func cmdWrite(c *cli.CLI, args []string, width uint) {
-	drv := c.User.(target).GetMemoryDriver()
+	drv := getDriver(c)
 	_ = drv
 }
 
@@ -173,7 +219,7 @@ var helpMemToFile = []cli.Help{
 var cmdToFile = cli.Leaf{
 	Descr: "read from memory, write to file",
 	F: func(c *cli.CLI, args []string) {
-		drv := c.User.(target).GetMemoryDriver()
+		drv := getDriver(c)
 
 		// process the arguments
 		err := cli.CheckArgc(args, []int{2, 3})
@@ -230,7 +276,7 @@ var cmdToFile = cli.Leaf{
 var cmdPic = cli.Leaf{
 	Descr: "display a pictorial summary of memory",
 	F: func(c *cli.CLI, args []string) {
-		drv := c.User.(target).GetMemoryDriver()
+		drv := getDriver(c)
 
 		// get the arguments
 		region, err := RegionArg(drv, args)
@@ -271,7 +317,7 @@ var cmdPic = cli.Leaf{
 var cmdCheckSum = cli.Leaf{
 	Descr: "calcuate md5 checksum of memory region",
 	F: func(c *cli.CLI, args []string) {
-		drv := c.User.(target).GetMemoryDriver()
+		drv := getDriver(c)
 
 		// get the arguments
 		region, err := RegionArg(drv, args)
@@ -333,7 +379,7 @@ func cmpBuf(a, b []uint) bool {
 }
 
 func cmdTest(c *cli.CLI, args []string, width uint) {
-	drv := c.User.(target).GetMemoryDriver()
+	drv := getDriver(c)
 	// get the arguments
 	region, err := RegionArg(drv, args)
 	if err != nil {
@@ -421,6 +467,7 @@ var Menu = cli.Menu{
 	{">file", cmdToFile, helpMemToFile},
 	{"md5", cmdCheckSum, helpMemRegion},
 	{"pic", cmdPic, helpMemRegion},
+	{"virtual", cmdVirtual, helpVirtual},
 }
 
 //-----------------------------------------------------------------------------
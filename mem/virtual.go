@@ -0,0 +1,126 @@
+//-----------------------------------------------------------------------------
+/*
+
+Virtual Memory Driver
+
+Wrap a memory driver with virtual to physical address translation.
+Accesses are split at page boundaries and each page is translated.
+
+*/
+//-----------------------------------------------------------------------------
+
+package mem
+
+import "fmt"
+
+//-----------------------------------------------------------------------------
+
+// Translator translates virtual addresses to physical addresses.
+type Translator interface {
+	Translate(vaddr uint) (uint, error)
+}
+
+// translator provides the virtual address translation for a target.
+type translator interface {
+	GetTranslator() Translator
+	GetVirtualMode() bool   // do the memory commands use virtual addresses?
+	SetVirtualMode(on bool) // set the virtual address mode
+}
+
+const vPageSize = 4096
+
+// virtualDriver is a memory driver using virtual addresses.
+type virtualDriver struct {
+	drv Driver     // physical memory driver
+	t   Translator // address translation
+}
+
+// NewVirtualDriver returns a memory driver that accesses memory using virtual addresses.
+func NewVirtualDriver(drv Driver, t Translator) Driver {
+	return &virtualDriver{
+		drv: drv,
+		t:   t,
+	}
+}
+
+// GetAddressSize returns the address size in bits.
+func (v *virtualDriver) GetAddressSize() uint {
+	return v.drv.GetAddressSize()
+}
+
+// GetDefaultRegion returns a default memory region.
+func (v *virtualDriver) GetDefaultRegion() *Region {
+	return v.drv.GetDefaultRegion()
+}
+
+// LookupSymbol returns an address and size for a symbol.
+func (v *virtualDriver) LookupSymbol(name string) *Region {
+	return v.drv.LookupSymbol(name)
+}
+
+// checkAlign checks that the address is aligned to the width.
+// An aligned value never straddles a page boundary.
+func checkAlign(width, addr uint) error {
+	if addr&((width/8)-1) != 0 {
+		return fmt.Errorf("virtual address 0x%x is not %d-bit aligned", addr, width)
+	}
+	return nil
+}
+
+// pageChunk returns the number of width-bit values from addr to the end of the page.
+// The address must be aligned to the width.
+func pageChunk(width, addr, n uint) uint {
+	k := (vPageSize - (addr & (vPageSize - 1))) / (width / 8)
+	if k > n {
+		return n
+	}
+	return k
+}
+
+// RdMem reads n x width-bit values from virtual memory.
+func (v *virtualDriver) RdMem(width, addr, n uint) ([]uint, error) {
+	err := checkAlign(width, addr)
+	if err != nil {
+		return nil, err
+	}
+	val := []uint{}
+	for n > 0 {
+		pa, err := v.t.Translate(addr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to translate 0x%x: %v", addr, err)
+		}
+		k := pageChunk(width, addr, n)
+		x, err := v.drv.RdMem(width, pa, k)
+		if err != nil {
+			return nil, err
+		}
+		val = append(val, x...)
+		addr += k * (width / 8)
+		n -= k
+	}
+	return val, nil
+}
+
+// WrMem writes n x width-bit values to virtual memory.
+func (v *virtualDriver) WrMem(width, addr uint, val []uint) error {
+	err := checkAlign(width, addr)
+	if err != nil {
+		return err
+	}
+	for len(val) > 0 {
+		pa, err := v.t.Translate(addr)
+		if err != nil {
+			return fmt.Errorf("unable to translate 0x%x: %v", addr, err)
+		}
+		k := pageChunk(width, addr, uint(len(val)))
+		err = v.drv.WrMem(width, pa, val[:k])
+		if err != nil {
+			return err
+		}
+		addr += k * (width / 8)
+		val = val[k:]
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,88 @@
+//-----------------------------------------------------------------------------
+/*
+
+Virtual memory driver test functions.
+
+*/
+//-----------------------------------------------------------------------------
+
+package mem
+
+import (
+	"reflect"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+// testMemory is a byte addressed physical memory.
+type testMemory struct {
+	m map[uint]byte
+}
+
+func (t *testMemory) GetAddressSize() uint             { return 32 }
+func (t *testMemory) GetDefaultRegion() *Region        { return nil }
+func (t *testMemory) LookupSymbol(name string) *Region { return nil }
+
+func (t *testMemory) RdMem(width, addr, n uint) ([]uint, error) {
+	val := make([]uint, n)
+	for i := range val {
+		for j := uint(0); j < width/8; j++ {
+			val[i] |= uint(t.m[addr+(uint(i)*(width/8))+j]) << (8 * j)
+		}
+	}
+	return val, nil
+}
+
+func (t *testMemory) WrMem(width, addr uint, val []uint) error {
+	for i, x := range val {
+		for j := uint(0); j < width/8; j++ {
+			t.m[addr+(uint(i)*(width/8))+j] = byte(x >> (8 * j))
+		}
+	}
+	return nil
+}
+
+// testTranslator swaps virtual pages 0 and 1.
+type testTranslator struct{}
+
+func (t testTranslator) Translate(vaddr uint) (uint, error) {
+	return vaddr ^ vPageSize, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_VirtualDriver(t *testing.T) {
+	m := &testMemory{m: map[uint]byte{}}
+	drv := NewVirtualDriver(m, testTranslator{})
+
+	// a write across the page boundary is split between the physical pages
+	err := drv.WrMem(32, vPageSize-4, []uint{0x11223344, 0x55667788})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	x, _ := m.RdMem(32, (2*vPageSize)-4, 1)
+	y, _ := m.RdMem(32, 0, 1)
+	if x[0] != 0x11223344 || y[0] != 0x55667788 {
+		t.Errorf("bad physical write: 0x%x 0x%x", x[0], y[0])
+	}
+	val, err := drv.RdMem(32, vPageSize-4, 2)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !reflect.DeepEqual(val, []uint{0x11223344, 0x55667788}) {
+		t.Errorf("bad virtual read: %x", val)
+	}
+
+	// an unaligned value would straddle the page boundary
+	_, err = drv.RdMem(32, vPageSize-2, 1)
+	if err == nil {
+		t.Errorf("expected an error for an unaligned read")
+	}
+	err = drv.WrMem(32, vPageSize-2, []uint{0})
+	if err == nil {
+		t.Errorf("expected an error for an unaligned write")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -57,7 +57,7 @@ func (r *Register) GetField(name string) *Field {
 	}
 	for i := range r.Fields {
 		f := &r.Fields[i]
-		if r.Name == name {
+		if f.Name == name {
 			return f
 		}
 	}
@@ -0,0 +1,557 @@
+//-----------------------------------------------------------------------------
+/*
+
+DWARF Call Frame Information
+
+Parse the .debug_frame and .eh_frame sections of an ELF file and compute the
+unwind rules (the CFA and the saved registers) at a pc. DWARF expressions
+are not evaluated, registers using them are treated as undefined.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sym
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// RuleKind is the kind of a register unwind rule.
+type RuleKind int
+
+// RuleKind values.
+const (
+	RuleUndefined RuleKind = iota // the register value can't be recovered
+	RuleSameValue                 // the register is unchanged
+	RuleOffset                    // the register is saved at CFA+offset
+	RuleValOffset                 // the register value is CFA+offset
+	RuleRegister                  // the register is saved in another register
+)
+
+// Rule is a register unwind rule.
+type Rule struct {
+	Kind   RuleKind
+	Offset int64 // offset from the CFA
+	Reg    uint  // register number
+}
+
+// UnwindRow is the unwind information for a pc.
+type UnwindRow struct {
+	CFAReg    uint          // CFA = register + offset
+	CFAOffset int64         // CFA = register + offset
+	RA        uint          // return address register
+	Rules     map[uint]Rule // registers without a rule keep their value
+}
+
+//-----------------------------------------------------------------------------
+
+// cie is a common information entry.
+type cie struct {
+	codeAlign uint64 // code alignment factor
+	dataAlign int64  // data alignment factor
+	ra        uint   // return address register
+	ptrEnc    byte   // pointer encoding (absptr for debug_frame)
+	aug       bool   // augmentation data is present
+	ins       []byte // initial instructions
+	insAddr   uint64 // address of the initial instructions
+}
+
+// fde is a frame description entry.
+type fde struct {
+	start   uint   // start address
+	end     uint   // end address (exclusive)
+	cie     *cie   // common information entry
+	ins     []byte // call frame instructions
+	insAddr uint64 // address of the call frame instructions
+}
+
+//-----------------------------------------------------------------------------
+
+// cfiReader reads values from a CFI section.
+type cfiReader struct {
+	b        []byte
+	pos      int
+	order    binary.ByteOrder
+	addrSize int
+	base     uint64 // section address (for pc relative pointers)
+	err      error
+}
+
+var errCfiShort = errors.New("cfi section is truncated")
+
+func (r *cfiReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.b) {
+		r.err = errCfiShort
+		return make([]byte, n)
+	}
+	x := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return x
+}
+
+func (r *cfiReader) u8() uint8 {
+	return r.bytes(1)[0]
+}
+
+func (r *cfiReader) u16() uint16 {
+	return r.order.Uint16(r.bytes(2))
+}
+
+func (r *cfiReader) u32() uint32 {
+	return r.order.Uint32(r.bytes(4))
+}
+
+func (r *cfiReader) u64() uint64 {
+	return r.order.Uint64(r.bytes(8))
+}
+
+func (r *cfiReader) uleb() uint64 {
+	var x uint64
+	var shift uint
+	for {
+		b := r.u8()
+		if shift < 64 {
+			x |= uint64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 || r.err != nil {
+			return x
+		}
+	}
+}
+
+func (r *cfiReader) sleb() int64 {
+	var x int64
+	var shift uint
+	for {
+		b := r.u8()
+		if shift < 64 {
+			x |= int64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 || r.err != nil {
+			if shift < 64 && b&0x40 != 0 {
+				x |= -1 << shift
+			}
+			return x
+		}
+	}
+}
+
+func (r *cfiReader) cstr() string {
+	start := r.pos
+	for r.err == nil && r.u8() != 0 {
+	}
+	if r.err != nil {
+		return ""
+	}
+	return string(r.b[start : r.pos-1])
+}
+
+func (r *cfiReader) addr() uint64 {
+	if r.addrSize == 8 {
+		return r.u64()
+	}
+	return uint64(r.u32())
+}
+
+// pointer encodings
+const (
+	peAbsptr  = 0x00
+	peUleb128 = 0x01
+	peUdata2  = 0x02
+	peUdata4  = 0x03
+	peUdata8  = 0x04
+	peSleb128 = 0x09
+	peSdata2  = 0x0a
+	peSdata4  = 0x0b
+	peSdata8  = 0x0c
+	pePcrel   = 0x10
+	peOmit    = 0xff
+)
+
+// ptr reads an encoded pointer.
+func (r *cfiReader) ptr(enc byte) uint64 {
+	if enc == peOmit {
+		return 0
+	}
+	pc := r.base + uint64(r.pos)
+	var x uint64
+	switch enc & 0x0f {
+	case peAbsptr:
+		x = r.addr()
+	case peUleb128:
+		x = r.uleb()
+	case peUdata2:
+		x = uint64(r.u16())
+	case peUdata4:
+		x = uint64(r.u32())
+	case peUdata8:
+		x = r.u64()
+	case peSleb128:
+		x = uint64(r.sleb())
+	case peSdata2:
+		x = uint64(int16(r.u16()))
+	case peSdata4:
+		x = uint64(int32(r.u32()))
+	case peSdata8:
+		x = r.u64()
+	default:
+		r.err = fmt.Errorf("unsupported pointer encoding 0x%02x", enc)
+	}
+	if enc&0x70 == pePcrel {
+		x += pc
+	}
+	if r.addrSize == 4 {
+		x &= 0xffffffff
+	}
+	return x
+}
+
+//-----------------------------------------------------------------------------
+
+// cfiSection parses a .debug_frame or .eh_frame section.
+type cfiSection struct {
+	r    *cfiReader
+	eh   bool
+	cies map[int]*cie
+}
+
+// parseCIE parses the CIE at an offset in the section.
+func (cs *cfiSection) parseCIE(ofs int) (*cie, error) {
+	if c, ok := cs.cies[ofs]; ok {
+		return c, nil
+	}
+	r := *cs.r
+	r.pos = ofs
+	end, _, err := cs.header(&r)
+	if err != nil {
+		return nil, err
+	}
+	c := &cie{}
+	version := r.u8()
+	aug := r.cstr()
+	if version >= 4 {
+		r.u8() // address size
+		r.u8() // segment size
+	}
+	c.codeAlign = r.uleb()
+	c.dataAlign = r.sleb()
+	if version == 1 {
+		c.ra = uint(r.u8())
+	} else {
+		c.ra = uint(r.uleb())
+	}
+	if len(aug) != 0 {
+		if aug[0] != 'z' {
+			return nil, fmt.Errorf("unsupported cie augmentation \"%s\"", aug)
+		}
+		c.aug = true
+		n := int(r.uleb())
+		augEnd := r.pos + n
+		for _, ch := range aug[1:] {
+			switch ch {
+			case 'R':
+				c.ptrEnc = r.u8()
+			case 'P':
+				r.ptr(r.u8())
+			case 'L':
+				r.u8()
+			}
+		}
+		r.pos = augEnd
+	}
+	if !cs.eh {
+		// debug_frame addresses are target addresses
+		c.ptrEnc = peAbsptr
+	}
+	c.insAddr = r.base + uint64(r.pos)
+	c.ins = r.bytes(end - r.pos)
+	if r.err != nil {
+		return nil, r.err
+	}
+	cs.cies[ofs] = c
+	return c, nil
+}
+
+// header reads an entry header and returns the end of the entry and the CIE id/pointer.
+// The id is 0 for a CIE, else it's the section offset of the CIE + 1.
+func (cs *cfiSection) header(r *cfiReader) (int, uint64, error) {
+	var length, id uint64
+	length = uint64(r.u32())
+	is64 := length == 0xffffffff
+	if is64 {
+		length = r.u64()
+	}
+	end := r.pos + int(length)
+	idPos := r.pos
+	if length == 0 {
+		return end, 0, r.err
+	}
+	if is64 {
+		id = r.u64()
+	} else {
+		id = uint64(r.u32())
+	}
+	if cs.eh {
+		// eh_frame: 0 for a CIE, else the offset back to the CIE
+		if id != 0 {
+			id = uint64(idPos) - id + 1
+		}
+	} else if id == 0xffffffff || id == 0xffffffffffffffff {
+		// debug_frame: all ones for a CIE
+		id = 0
+	} else {
+		// debug_frame: offset of the CIE
+		id++
+	}
+	if end > len(r.b) {
+		return 0, 0, errCfiShort
+	}
+	return end, id, r.err
+}
+
+// parse parses the section and returns the FDEs.
+func (cs *cfiSection) parse() ([]*fde, error) {
+	r := cs.r
+	fdes := []*fde{}
+	for r.pos < len(r.b) {
+		end, id, err := cs.header(r)
+		if err != nil {
+			return fdes, err
+		}
+		if end == r.pos {
+			// zero length entry (eh_frame terminator)
+			if cs.eh {
+				break
+			}
+			continue
+		}
+		if id == 0 {
+			// CIE
+			r.pos = end
+			continue
+		}
+		c, err := cs.parseCIE(int(id) - 1)
+		if err != nil {
+			return fdes, err
+		}
+		start := r.ptr(c.ptrEnc)
+		size := r.ptr(c.ptrEnc & 0x0f)
+		if c.aug {
+			r.pos += int(r.uleb())
+		}
+		insAddr := r.base + uint64(r.pos)
+		ins := r.bytes(end - r.pos)
+		if r.err != nil {
+			return fdes, r.err
+		}
+		if start != 0 {
+			fdes = append(fdes, &fde{
+				start:   uint(start),
+				end:     uint(start + size),
+				cie:     c,
+				ins:     ins,
+				insAddr: insAddr,
+			})
+		}
+		r.pos = end
+	}
+	return fdes, nil
+}
+
+// parseCFI parses the FDEs of a .debug_frame or .eh_frame section.
+func parseCFI(b []byte, addr uint64, eh bool, order binary.ByteOrder, addrSize int) ([]*fde, error) {
+	cs := &cfiSection{
+		r: &cfiReader{
+			b:        b,
+			order:    order,
+			addrSize: addrSize,
+			base:     addr,
+		},
+		eh:   eh,
+		cies: map[int]*cie{},
+	}
+	return cs.parse()
+}
+
+//-----------------------------------------------------------------------------
+
+// cfiState is the state of the call frame instruction interpreter.
+type cfiState struct {
+	cfaReg uint
+	cfaOff int64
+	rules  map[uint]Rule
+}
+
+func (s *cfiState) copy() cfiState {
+	x := cfiState{
+		cfaReg: s.cfaReg,
+		cfaOff: s.cfaOff,
+		rules:  map[uint]Rule{},
+	}
+	for k, v := range s.rules {
+		x.rules[k] = v
+	}
+	return x
+}
+
+// execute runs call frame instructions until the location passes the pc.
+// The instructions are at insAddr (for pc relative pointers).
+func (s *cfiState) execute(f *fde, ins []byte, insAddr uint64, init map[uint]Rule, pc uint64, r *cfiReader) error {
+	c := f.cie
+	r.b = ins
+	r.pos = 0
+	r.base = insAddr
+	loc := uint64(f.start)
+	stack := []cfiState{}
+	for r.pos < len(r.b) && r.err == nil {
+		op := r.u8()
+		switch op & 0xc0 {
+		case 0x40: // DW_CFA_advance_loc
+			loc += uint64(op&0x3f) * c.codeAlign
+			if loc > pc {
+				return nil
+			}
+			continue
+		case 0x80: // DW_CFA_offset
+			s.rules[uint(op&0x3f)] = Rule{Kind: RuleOffset, Offset: int64(r.uleb()) * c.dataAlign}
+			continue
+		case 0xc0: // DW_CFA_restore
+			s.restore(uint(op&0x3f), init)
+			continue
+		}
+		switch op {
+		case 0x00: // DW_CFA_nop
+		case 0x01: // DW_CFA_set_loc
+			loc = r.ptr(c.ptrEnc)
+		case 0x02: // DW_CFA_advance_loc1
+			loc += uint64(r.u8()) * c.codeAlign
+		case 0x03: // DW_CFA_advance_loc2
+			loc += uint64(r.u16()) * c.codeAlign
+		case 0x04: // DW_CFA_advance_loc4
+			loc += uint64(r.u32()) * c.codeAlign
+		case 0x05: // DW_CFA_offset_extended
+			reg := uint(r.uleb())
+			s.rules[reg] = Rule{Kind: RuleOffset, Offset: int64(r.uleb()) * c.dataAlign}
+		case 0x06: // DW_CFA_restore_extended
+			s.restore(uint(r.uleb()), init)
+		case 0x07: // DW_CFA_undefined
+			s.rules[uint(r.uleb())] = Rule{Kind: RuleUndefined}
+		case 0x08: // DW_CFA_same_value
+			s.rules[uint(r.uleb())] = Rule{Kind: RuleSameValue}
+		case 0x09: // DW_CFA_register
+			reg := uint(r.uleb())
+			s.rules[reg] = Rule{Kind: RuleRegister, Reg: uint(r.uleb())}
+		case 0x0a: // DW_CFA_remember_state
+			stack = append(stack, s.copy())
+		case 0x0b: // DW_CFA_restore_state
+			if len(stack) == 0 {
+				return errors.New("cfi state stack underflow")
+			}
+			*s = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		case 0x0c: // DW_CFA_def_cfa
+			s.cfaReg = uint(r.uleb())
+			s.cfaOff = int64(r.uleb())
+		case 0x0d: // DW_CFA_def_cfa_register
+			s.cfaReg = uint(r.uleb())
+		case 0x0e: // DW_CFA_def_cfa_offset
+			s.cfaOff = int64(r.uleb())
+		case 0x0f: // DW_CFA_def_cfa_expression
+			return errors.New("cfa expressions are not supported")
+		case 0x10, 0x16: // DW_CFA_expression, DW_CFA_val_expression
+			reg := uint(r.uleb())
+			r.bytes(int(r.uleb()))
+			s.rules[reg] = Rule{Kind: RuleUndefined}
+		case 0x11: // DW_CFA_offset_extended_sf
+			reg := uint(r.uleb())
+			s.rules[reg] = Rule{Kind: RuleOffset, Offset: r.sleb() * c.dataAlign}
+		case 0x12: // DW_CFA_def_cfa_sf
+			s.cfaReg = uint(r.uleb())
+			s.cfaOff = r.sleb() * c.dataAlign
+		case 0x13: // DW_CFA_def_cfa_offset_sf
+			s.cfaOff = r.sleb() * c.dataAlign
+		case 0x14: // DW_CFA_val_offset
+			reg := uint(r.uleb())
+			s.rules[reg] = Rule{Kind: RuleValOffset, Offset: int64(r.uleb()) * c.dataAlign}
+		case 0x15: // DW_CFA_val_offset_sf
+			reg := uint(r.uleb())
+			s.rules[reg] = Rule{Kind: RuleValOffset, Offset: r.sleb() * c.dataAlign}
+		case 0x2e: // DW_CFA_GNU_args_size
+			r.uleb()
+		case 0x2f: // DW_CFA_GNU_negative_offset_extended
+			reg := uint(r.uleb())
+			s.rules[reg] = Rule{Kind: RuleOffset, Offset: -int64(r.uleb()) * c.dataAlign}
+		default:
+			return fmt.Errorf("unsupported call frame instruction 0x%02x", op)
+		}
+		if loc > pc {
+			return nil
+		}
+	}
+	return r.err
+}
+
+// restore sets a register rule back to the initial rule.
+func (s *cfiState) restore(reg uint, init map[uint]Rule) {
+	if rule, ok := init[reg]; ok {
+		s.rules[reg] = rule
+	} else {
+		delete(s.rules, reg)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// lookupFDE returns the FDE containing a pc (or nil).
+func (t *Table) lookupFDE(pc uint) *fde {
+	// the first FDE above the pc
+	i := sort.Search(len(t.fde), func(i int) bool { return t.fde[i].start > pc })
+	if i == 0 {
+		return nil
+	}
+	// .debug_frame and .eh_frame may both describe the same function
+	start := t.fde[i-1].start
+	for i--; i >= 0 && t.fde[i].start == start; i-- {
+		if pc < t.fde[i].end {
+			return t.fde[i]
+		}
+	}
+	return nil
+}
+
+// Unwind returns the unwind information for a pc.
+// It returns nil if there is no call frame information for the pc.
+func (t *Table) Unwind(pc uint) (*UnwindRow, error) {
+	f := t.lookupFDE(pc)
+	if f == nil {
+		return nil, nil
+	}
+	r := &cfiReader{order: t.order, addrSize: t.addrSize}
+	// run the CIE initial instructions
+	s := &cfiState{rules: map[uint]Rule{}}
+	err := s.execute(f, f.cie.ins, f.cie.insAddr, nil, ^uint64(0), r)
+	if err != nil {
+		return nil, err
+	}
+	init := s.copy().rules
+	// run the FDE instructions
+	err = s.execute(f, f.ins, f.insAddr, init, uint64(pc), r)
+	if err != nil {
+		return nil, err
+	}
+	return &UnwindRow{
+		CFAReg:    s.cfaReg,
+		CFAOffset: s.cfaOff,
+		RA:        f.cie.ra,
+		Rules:     s.rules,
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
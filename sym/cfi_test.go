@@ -0,0 +1,208 @@
+//-----------------------------------------------------------------------------
+/*
+
+Call frame information test functions.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sym
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+// RISC-V registers
+const (
+	regRA = 1
+	regSP = 2
+	regS0 = 8
+)
+
+// debugFrame is a .debug_frame section (rv32, little endian).
+var debugFrame = []byte{
+	// CIE @ 0
+	0x0c, 0x00, 0x00, 0x00, // length
+	0xff, 0xff, 0xff, 0xff, // CIE id
+	0x01,             // version
+	0x00,             // augmentation ""
+	0x01,             // code alignment 1
+	0x7c,             // data alignment -4
+	0x01,             // return address register (ra)
+	0x0c, 0x02, 0x00, // DW_CFA_def_cfa sp, 0
+	// FDE @ 16
+	0x20, 0x00, 0x00, 0x00, // length
+	0x00, 0x00, 0x00, 0x00, // CIE pointer
+	0x00, 0x10, 0x00, 0x00, // initial location 0x1000
+	0x20, 0x00, 0x00, 0x00, // address range 0x20
+	0x42,       // DW_CFA_advance_loc 2
+	0x0e, 0x10, // DW_CFA_def_cfa_offset 16
+	0x42,       // DW_CFA_advance_loc 2
+	0x81, 0x01, // DW_CFA_offset ra, 1
+	0x42,       // DW_CFA_advance_loc 2
+	0x88, 0x02, // DW_CFA_offset s0, 2
+	0x0a,       // DW_CFA_remember_state
+	0x4a,       // DW_CFA_advance_loc 10
+	0xc1,       // DW_CFA_restore ra
+	0xc8,       // DW_CFA_restore s0
+	0x0e, 0x00, // DW_CFA_def_cfa_offset 0
+	0x42,             // DW_CFA_advance_loc 2
+	0x0b,             // DW_CFA_restore_state
+	0x00, 0x00, 0x00, // DW_CFA_nop
+}
+
+// ehFrameAddr is the address of the .eh_frame section.
+const ehFrameAddr = 0x2000
+
+// ehFrame is an .eh_frame section (rv32, little endian) with pc relative pointers.
+var ehFrame = []byte{
+	// CIE @ 0
+	0x10, 0x00, 0x00, 0x00, // length
+	0x00, 0x00, 0x00, 0x00, // CIE id
+	0x01,           // version
+	'z', 'R', 0x00, // augmentation "zR"
+	0x01,             // code alignment 1
+	0x7c,             // data alignment -4
+	0x01,             // return address register (ra)
+	0x01,             // augmentation length
+	0x1b,             // DW_EH_PE_pcrel | DW_EH_PE_sdata4
+	0x0c, 0x02, 0x00, // DW_CFA_def_cfa sp, 0
+	// FDE @ 20
+	0x1c, 0x00, 0x00, 0x00, // length
+	0x18, 0x00, 0x00, 0x00, // CIE pointer (24 - 0)
+	0xe4, 0xef, 0xff, 0xff, // pc begin 0x1000 (0x1000 - 0x201c)
+	0x20, 0x00, 0x00, 0x00, // pc range 0x20
+	0x00,                         // augmentation length
+	0x01, 0xe2, 0xef, 0xff, 0xff, // DW_CFA_set_loc 0x1008 (0x1008 - 0x2026)
+	0x0e, 0x20, // DW_CFA_def_cfa_offset 32
+	0x01, 0xe3, 0xef, 0xff, 0xff, // DW_CFA_set_loc 0x1010 (0x1010 - 0x202d)
+	0x81, 0x01, // DW_CFA_offset ra, 1
+	0x00, // DW_CFA_nop
+	// terminator @ 52
+	0x00, 0x00, 0x00, 0x00,
+}
+
+//-----------------------------------------------------------------------------
+
+type unwindTest struct {
+	pc     uint
+	none   bool          // no call frame information
+	cfaOff int64         // CFA = sp + offset
+	rules  map[uint]Rule // expected rules
+}
+
+func checkUnwind(t *testing.T, name string, tbl *Table, tests []unwindTest) {
+	for _, v := range tests {
+		row, err := tbl.Unwind(v.pc)
+		if err != nil {
+			t.Errorf("%s 0x%x: %s", name, v.pc, err)
+			continue
+		}
+		if v.none {
+			if row != nil {
+				t.Errorf("%s 0x%x: expected no unwind information", name, v.pc)
+			}
+			continue
+		}
+		if row == nil {
+			t.Errorf("%s 0x%x: no unwind information", name, v.pc)
+			continue
+		}
+		if row.CFAReg != regSP || row.CFAOffset != v.cfaOff || row.RA != regRA {
+			t.Errorf("%s 0x%x: expected cfa r%d+%d ra r%d, got r%d+%d ra r%d", name, v.pc, regSP, v.cfaOff, regRA, row.CFAReg, row.CFAOffset, row.RA)
+		}
+		if len(row.Rules) != len(v.rules) {
+			t.Errorf("%s 0x%x: expected rules %v, got %v", name, v.pc, v.rules, row.Rules)
+			continue
+		}
+		for reg, rule := range v.rules {
+			if row.Rules[reg] != rule {
+				t.Errorf("%s 0x%x: expected rules %v, got %v", name, v.pc, v.rules, row.Rules)
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DebugFrame(t *testing.T) {
+	fdes, err := parseCFI(debugFrame, 0, false, binary.LittleEndian, 4)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(fdes) != 1 || fdes[0].start != 0x1000 || fdes[0].end != 0x1020 {
+		t.Fatalf("bad fde parse")
+	}
+	tbl := &Table{fde: fdes, order: binary.LittleEndian, addrSize: 4}
+	ra := Rule{Kind: RuleOffset, Offset: -4}
+	s0 := Rule{Kind: RuleOffset, Offset: -8}
+	tests := []unwindTest{
+		{0x0ffe, true, 0, nil},
+		{0x1000, false, 0, map[uint]Rule{}},
+		{0x1002, false, 16, map[uint]Rule{}},
+		{0x1004, false, 16, map[uint]Rule{regRA: ra}},
+		{0x1008, false, 16, map[uint]Rule{regRA: ra, regS0: s0}},
+		{0x1010, false, 0, map[uint]Rule{}},
+		{0x1012, false, 16, map[uint]Rule{regRA: ra, regS0: s0}},
+		{0x101e, false, 16, map[uint]Rule{regRA: ra, regS0: s0}},
+		{0x1020, true, 0, nil},
+	}
+	checkUnwind(t, "debug_frame", tbl, tests)
+}
+
+func Test_EhFrame(t *testing.T) {
+	fdes, err := parseCFI(ehFrame, ehFrameAddr, true, binary.LittleEndian, 4)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(fdes) != 1 || fdes[0].start != 0x1000 || fdes[0].end != 0x1020 {
+		t.Fatalf("bad fde parse")
+	}
+	tbl := &Table{fde: fdes, order: binary.LittleEndian, addrSize: 4}
+	tests := []unwindTest{
+		{0x1000, false, 0, map[uint]Rule{}},
+		{0x1006, false, 0, map[uint]Rule{}},
+		{0x1008, false, 32, map[uint]Rule{}},
+		{0x100e, false, 32, map[uint]Rule{}},
+		{0x1010, false, 32, map[uint]Rule{regRA: {Kind: RuleOffset, Offset: -4}}},
+	}
+	checkUnwind(t, "eh_frame", tbl, tests)
+}
+
+func Test_CfiTruncated(t *testing.T) {
+	_, err := parseCFI(debugFrame[:24], 0, false, binary.LittleEndian, 4)
+	if err == nil {
+		t.Errorf("expected an error for a truncated section")
+	}
+}
+
+func Test_Leb128(t *testing.T) {
+	tests := []struct {
+		b    []byte
+		u    uint64
+		s    int64
+		size int
+	}{
+		{[]byte{0x02}, 2, 2, 1},
+		{[]byte{0x7f}, 127, -1, 1},
+		{[]byte{0x80, 0x01}, 128, 128, 2},
+		{[]byte{0x80, 0x7f}, 16256, -128, 2},
+		{[]byte{0xe5, 0x8e, 0x26}, 624485, 624485, 3},
+	}
+	for _, v := range tests {
+		r := &cfiReader{b: v.b}
+		u := r.uleb()
+		n := r.pos
+		r.pos = 0
+		s := r.sleb()
+		if u != v.u || s != v.s || n != v.size || r.pos != v.size || r.err != nil {
+			t.Errorf("% x: expected %d %d, got %d %d", v.b, v.u, v.s, u, s)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
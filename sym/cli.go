@@ -0,0 +1,106 @@
+//-----------------------------------------------------------------------------
+/*
+
+Symbol Table Menu Items
+
+*/
+//-----------------------------------------------------------------------------
+
+package sym
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	cli "github.com/deadsy/go-cli"
+)
+
+//-----------------------------------------------------------------------------
+
+// target provides a method for getting the symbol table.
+type target interface {
+	GetSymbols() *Table
+}
+
+//-----------------------------------------------------------------------------
+
+// loadHelp is help for the load command.
+var loadHelp = []cli.Help{
+	{"<file>", "ELF file"},
+}
+
+var cmdLoad = cli.Leaf{
+	Descr: "load the symbols from an ELF file",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		t := c.User.(target).GetSymbols()
+		err = t.Load(args[0])
+		if err != nil {
+			c.User.Put(fmt.Sprintf("unable to load symbols: %v\n", err))
+			return
+		}
+		c.User.Put(fmt.Sprintf("%s\n", t))
+	},
+}
+
+var cmdClear = cli.Leaf{
+	Descr: "clear the symbol table",
+	F: func(c *cli.CLI, args []string) {
+		c.User.(target).GetSymbols().Clear()
+	},
+}
+
+var cmdInfo = cli.Leaf{
+	Descr: "display the symbol table information",
+	F: func(c *cli.CLI, args []string) {
+		c.User.Put(fmt.Sprintf("%s\n", c.User.(target).GetSymbols()))
+	},
+}
+
+// findHelp is help for the find command.
+var findHelp = []cli.Help{
+	{"<name>", "symbol name"},
+	{"<addr>", "address (hex)"},
+}
+
+var cmdFind = cli.Leaf{
+	Descr: "find a symbol by name or address",
+	F: func(c *cli.CLI, args []string) {
+		err := cli.CheckArgc(args, []int{1})
+		if err != nil {
+			c.User.Put(fmt.Sprintf("%s\n", err))
+			return
+		}
+		t := c.User.(target).GetSymbols()
+		if s := t.LookupName(args[0]); s != nil {
+			c.User.Put(fmt.Sprintf("%s\n", s))
+			return
+		}
+		addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(args[0]), "0x"), 16, 64)
+		if err != nil {
+			c.User.Put(fmt.Sprintf("no symbol \"%s\"\n", args[0]))
+			return
+		}
+		s := t.AddrString(uint(addr))
+		if s == "" {
+			c.User.Put(fmt.Sprintf("no symbol at 0x%x\n", addr))
+			return
+		}
+		c.User.Put(fmt.Sprintf("0x%x %s\n", addr, s))
+	},
+}
+
+// Menu submenu items
+var Menu = cli.Menu{
+	{"clear", cmdClear},
+	{"find", cmdFind, findHelp},
+	{"info", cmdInfo},
+	{"load", cmdLoad, loadHelp},
+}
+
+//-----------------------------------------------------------------------------
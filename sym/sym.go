@@ -0,0 +1,169 @@
+//-----------------------------------------------------------------------------
+/*
+
+ELF Symbol Table
+
+The function and data object symbols of an ELF file are loaded so addresses
+can be displayed as symbol+offset. The call frame information is loaded
+for stack unwinding.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sym
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// Symbol is an ELF symbol.
+type Symbol struct {
+	Name string // symbol name
+	Addr uint   // start address
+	Size uint   // size in bytes (0 = unknown)
+	Func bool   // is this a function?
+}
+
+func (s *Symbol) String() string {
+	return fmt.Sprintf("%s 0x%x %d", s.Name, s.Addr, s.Size)
+}
+
+// Table is a symbol table sorted by address.
+type Table struct {
+	file string    // loaded ELF file
+	sym  []*Symbol // symbols sorted by address
+	name map[string]*Symbol
+	fde  []*fde // frame description entries sorted by start address
+	// call frame information encoding
+	order    binary.ByteOrder
+	addrSize int
+}
+
+// NewTable returns an empty symbol table.
+func NewTable() *Table {
+	return &Table{
+		name: map[string]*Symbol{},
+	}
+}
+
+func (t *Table) String() string {
+	if t.file == "" {
+		return "no symbols loaded"
+	}
+	return fmt.Sprintf("%s: %d symbols, %d fdes", t.file, len(t.sym), len(t.fde))
+}
+
+// Len returns the number of symbols in the table.
+func (t *Table) Len() int {
+	return len(t.sym)
+}
+
+// Clear removes all symbols from the table.
+func (t *Table) Clear() {
+	t.file = ""
+	t.sym = nil
+	t.name = map[string]*Symbol{}
+	t.fde = nil
+}
+
+// Load loads the function and object symbols from an ELF file.
+func (t *Table) Load(path string) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	syms, err := f.Symbols()
+	if err != nil {
+		return err
+	}
+	t.Clear()
+	for _, s := range syms {
+		kind := elf.ST_TYPE(s.Info)
+		if kind != elf.STT_FUNC && kind != elf.STT_OBJECT {
+			continue
+		}
+		if s.Name == "" || s.Section == elf.SHN_UNDEF {
+			continue
+		}
+		x := &Symbol{
+			Name: s.Name,
+			Addr: uint(s.Value),
+			Size: uint(s.Size),
+			Func: kind == elf.STT_FUNC,
+		}
+		t.sym = append(t.sym, x)
+		t.name[x.Name] = x
+	}
+	sort.SliceStable(t.sym, func(i, j int) bool {
+		return t.sym[i].Addr < t.sym[j].Addr
+	})
+	t.file = path
+	t.loadCFI(f)
+	return nil
+}
+
+// loadCFI loads the call frame information from an ELF file.
+// The CFI is optional, so a section that can't be parsed is skipped.
+func (t *Table) loadCFI(f *elf.File) {
+	t.order = f.ByteOrder
+	t.addrSize = 4
+	if f.Class == elf.ELFCLASS64 {
+		t.addrSize = 8
+	}
+	for _, name := range []string{".debug_frame", ".eh_frame"} {
+		s := f.Section(name)
+		if s == nil {
+			continue
+		}
+		b, err := s.Data()
+		if err != nil {
+			continue
+		}
+		fdes, _ := parseCFI(b, s.Addr, name == ".eh_frame", t.order, t.addrSize)
+		t.fde = append(t.fde, fdes...)
+	}
+	// stable: .debug_frame entries are ahead of .eh_frame entries
+	sort.SliceStable(t.fde, func(i, j int) bool {
+		return t.fde[i].start < t.fde[j].start
+	})
+}
+
+// Lookup returns the symbol containing an address (or nil).
+// A symbol with an unknown size extends to the next symbol.
+func (t *Table) Lookup(addr uint) *Symbol {
+	// the first symbol above the address
+	i := sort.Search(len(t.sym), func(i int) bool { return t.sym[i].Addr > addr })
+	if i == 0 {
+		return nil
+	}
+	s := t.sym[i-1]
+	if s.Size == 0 || addr < s.Addr+s.Size {
+		return s
+	}
+	return nil
+}
+
+// LookupName returns the symbol with a given name (or nil).
+func (t *Table) LookupName(name string) *Symbol {
+	return t.name[name]
+}
+
+// AddrString returns an address as a symbol+offset string.
+func (t *Table) AddrString(addr uint) string {
+	s := t.Lookup(addr)
+	if s == nil {
+		return ""
+	}
+	if addr == s.Addr {
+		return s.Name
+	}
+	return fmt.Sprintf("%s+0x%x", s.Name, addr-s.Addr)
+}
+
+//-----------------------------------------------------------------------------
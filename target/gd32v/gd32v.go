@@ -27,6 +27,7 @@ import (
 	"github.com/deadsy/rvdbg/jtag"
 	"github.com/deadsy/rvdbg/mem"
 	"github.com/deadsy/rvdbg/soc"
+	"github.com/deadsy/rvdbg/sym"
 	"github.com/deadsy/rvdbg/target"
 )
 
@@ -45,24 +46,47 @@ var Info = target.Info{
 
 // menuRoot is the root menu.
 var menuRoot = cli.Menu{
+	{"asm", riscv.CmdAsm, riscv.AsmHelp},
+	{"break", riscv.CmdBreak, riscv.BreakHelp},
+	{"bt", riscv.CmdBt, riscv.BtHelp},
+	{"call", riscv.CmdCall, riscv.CallHelp},
+	{"context", riscv.ContextMenu, "hart context snapshots"},
 	{"cpu", riscv.Menu, "cpu functions"},
 	{"csr", riscv.CmdCSR, riscv.CsrHelp},
 	{"da", riscv.CmdDisassemble, riscv.DisassembleHelp},
 	{"dbg", rv13.Menu, "debugger functions"},
+	{"delete", riscv.CmdDelete, riscv.DeleteHelp},
+	{"eclic", gd32vf103.CmdEclic, gd32vf103.EclicHelp},
+	{"exception", riscv.CmdException, riscv.ExceptionHelp},
 	{"exit", target.CmdExit},
 	{"flash", flash.Menu, "flash functions"},
 	{"gpio", gpio.Menu, "gpio functions"},
-	{"gpr", riscv.CmdGpr},
-	{"halt", riscv.CmdHalt},
+	{"gpr", riscv.CmdGpr, riscv.GprHelp},
+	{"halt", riscv.CmdHalt, riscv.HaltHelp},
 	{"hart", riscv.CmdHart, riscv.HartHelp},
 	{"help", target.CmdHelp},
 	{"history", target.CmdHistory, cli.HistoryHelp},
 	{"i2c", i2c.Menu, "i2c functions"},
+	{"info", riscv.InfoMenu, "information"},
 	{"jtag", jtag.Menu, "jtag functions"},
 	{"map", soc.CmdMap},
 	{"mem", mem.Menu, "memory functions"},
+	{"next", riscv.CmdNext},
+	{"pc", riscv.CmdPc, riscv.PcHelp},
+	{"pmp", riscv.CmdPmp, riscv.PmpHelp},
+	{"profile", riscv.CmdProfile, riscv.ProfileHelp},
 	{"regs", soc.CmdRegs, soc.RegsHelp},
-	{"resume", riscv.CmdResume},
+	{"reset", riscv.CmdReset, riscv.ResetHelp},
+	{"resume", riscv.CmdResume, riscv.ResumeHelp},
+	{"rwatch", riscv.CmdRwatch, riscv.WatchHelp},
+	{"semihost", riscv.CmdSemihost, riscv.SemihostHelp},
+	{"step", riscv.CmdStep},
+	{"stepi", riscv.CmdStepi, riscv.StepiHelp},
+	{"stepie", riscv.CmdStepie, riscv.StepieHelp},
+	{"sym", sym.Menu, "symbol table functions"},
+	{"vcsr", riscv.CmdVcsr, riscv.VcsrHelp},
+	{"vpr", riscv.CmdVpr, riscv.VprHelp},
+	{"watch", riscv.CmdWatch, riscv.WatchHelp},
 }
 
 //-----------------------------------------------------------------------------
@@ -175,6 +199,9 @@ type Target struct {
 	csrDriver   *csrDriver
 	gpioDriver  *gd32vf103.GpioDriver
 	flashDriver *gd32vf103.FlashDriver
+	poller      *riscv.Poller
+	semihost    *riscv.Semihost
+	symbols     *sym.Table
 }
 
 // New returns a new gd32v target.
@@ -210,7 +237,8 @@ func New(jtagDriver jtag.Driver) (target.Target, error) {
 		return nil, err
 	}
 
-	rvDebug, err := riscv.NewDebug(jtagDevice)
+	// the bumblebee core has vendor specific CSRs
+	rvDebug, err := riscv.NewDebug(jtagDevice, gd32vf103.BumblebeeCSR)
 	if err != nil {
 		return nil, err
 	}
@@ -231,7 +259,7 @@ func New(jtagDriver jtag.Driver) (target.Target, error) {
 		return nil, err
 	}
 
-	return &Target{
+	t := &Target{
 		jtagDevice:  jtagDevice,
 		rvDebug:     rvDebug,
 		socDevice:   socDevice,
@@ -240,23 +268,37 @@ func New(jtagDriver jtag.Driver) (target.Target, error) {
 		csrDriver:   newCsrDriver(rvDebug),
 		gpioDriver:  gpioDriver,
 		flashDriver: flashDriver,
-	}, nil
+		symbols:     sym.NewTable(),
+	}
+
+	// service semihosting requests
+	t.semihost, err = riscv.NewSemihost(rvDebug)
+	if err != nil {
+		return nil, err
+	}
+
+	// poll for asynchronous halts
+	t.poller = riscv.NewPoller(rvDebug, Info.Name, t)
+	t.poller.Start()
+
+	return t, nil
 }
 
 //-----------------------------------------------------------------------------
 
 // GetPrompt returns the target prompt string.
 func (t *Target) GetPrompt() string {
-	return t.rvDebug.GetPrompt(Info.Name)
+	return t.poller.GetPrompt()
 }
 
 // GetMenuRoot returns the target root menu.
 func (t *Target) GetMenuRoot() []cli.MenuItem {
-	return menuRoot
+	return t.poller.Wrap(menuRoot)
 }
 
 // Shutdown shuts down the target application.
 func (t *Target) Shutdown() {
+	t.poller.Stop()
 }
 
 // Put outputs a string to the user application.
@@ -301,4 +343,19 @@ func (t *Target) GetJtagDevice() *jtag.Device {
 	return t.jtagDevice
 }
 
+// ResetInit sets up the target after a reset.
+func (t *Target) ResetInit() error {
+	return gd32vf103.DebugHold(t.socDriver, t.socDevice)
+}
+
+// GetSymbols returns the symbol table.
+func (t *Target) GetSymbols() *sym.Table {
+	return t.symbols
+}
+
+// GetSemihost returns the semihosting state.
+func (t *Target) GetSemihost() *riscv.Semihost {
+	return t.semihost
+}
+
 //-----------------------------------------------------------------------------
@@ -0,0 +1,161 @@
+//-----------------------------------------------------------------------------
+/*
+
+Generic JTAG target.
+
+Discover the JTAG chain of an unknown board. The chain information can be
+used to write a board specific target. The target comes up without a JTAG
+chain if the IR lengths can't be worked out, "jtag scan" still works.
+
+*/
+//-----------------------------------------------------------------------------
+
+package generic
+
+import (
+	"errors"
+	"os"
+
+	cli "github.com/deadsy/go-cli"
+	"github.com/deadsy/rvdbg/chip/broadcom/bcm47622"
+	"github.com/deadsy/rvdbg/chip/broadcom/bcm47722"
+	"github.com/deadsy/rvdbg/chip/broadcom/bcm49408"
+	"github.com/deadsy/rvdbg/chip/gigadevice/gd32vf103"
+	"github.com/deadsy/rvdbg/chip/kendryte/k210"
+	"github.com/deadsy/rvdbg/chip/sifive/fe310"
+	"github.com/deadsy/rvdbg/itf"
+	"github.com/deadsy/rvdbg/jtag"
+	"github.com/deadsy/rvdbg/target"
+	"github.com/deadsy/rvdbg/util/log"
+)
+
+//-----------------------------------------------------------------------------
+
+// Info is target information.
+var Info = target.Info{
+	Name:     "generic",
+	Descr:    "Generic JTAG target (chain autodetection)",
+	DbgType:  itf.TypeNone,
+	DbgMode:  itf.ModeJtag,
+	DbgSpeed: 4000,
+}
+
+//-----------------------------------------------------------------------------
+
+// knownChains are the JTAG chains of known chips.
+// They give the IR lengths for the IDCODEs of those devices.
+var knownChains = []jtag.ChainInfo{
+	bcm47622.Chain0,
+	bcm47622.Chain1,
+	bcm47722.Chain,
+	bcm49408.Chain,
+	fe310.Chain,
+	gd32vf103.Chain,
+	k210.Chain,
+}
+
+//-----------------------------------------------------------------------------
+
+// menuRoot is the root menu.
+var menuRoot = cli.Menu{
+	{"exit", target.CmdExit},
+	{"help", target.CmdHelp},
+	{"history", target.CmdHistory, cli.HistoryHelp},
+	{"jtag", jtag.Menu, "jtag functions"},
+}
+
+//-----------------------------------------------------------------------------
+
+// Target is the application structure for the target.
+type Target struct {
+	jtagDriver jtag.Driver
+	jtagChain  *jtag.Chain
+	jtagDevice *jtag.Device
+}
+
+// New returns a new target.
+func New(jtagDriver jtag.Driver) (target.Target, error) {
+
+	// get the JTAG state
+	state, err := jtagDriver.GetState()
+	if err != nil {
+		return nil, err
+	}
+
+	// check the ~SRST state
+	if !state.Srst {
+		return nil, errors.New("target ~SRST line asserted, target is held in reset")
+	}
+
+	t := &Target{
+		jtagDriver: jtagDriver,
+	}
+
+	// discover the jtag chain
+	info, err := jtag.Scan(jtagDriver, knownChains...)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Complete() {
+		log.Info.Printf("unable to determine the ir lengths of the jtag chain\n%s", info)
+		return t, nil
+	}
+
+	// make the jtag chain
+	t.jtagChain, err = jtag.NewChain(jtagDriver, info)
+	if err != nil {
+		return nil, err
+	}
+
+	// make the jtag device for the first device on the chain
+	t.jtagDevice, err = t.jtagChain.GetDevice(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// GetPrompt returns the target prompt string.
+func (t *Target) GetPrompt() string {
+	return "generic> "
+}
+
+// GetMenuRoot returns the target root menu.
+func (t *Target) GetMenuRoot() []cli.MenuItem {
+	return menuRoot
+}
+
+// GetJtagDevice returns the JTAG device (nil if there is no chain).
+func (t *Target) GetJtagDevice() *jtag.Device {
+	return t.jtagDevice
+}
+
+// GetJtagChain returns the JTAG chain.
+func (t *Target) GetJtagChain() *jtag.Chain {
+	return t.jtagChain
+}
+
+// JtagScan scans the JTAG chain.
+func (t *Target) JtagScan() (jtag.ChainInfo, error) {
+	if t.jtagChain != nil {
+		return t.jtagChain.Scan(knownChains...)
+	}
+	return jtag.Scan(t.jtagDriver, knownChains...)
+}
+
+// GetJtagDriver returns the JTAG driver.
+func (t *Target) GetJtagDriver() jtag.Driver {
+	return t.jtagDriver
+}
+
+// Shutdown shuts down the target application.
+func (t *Target) Shutdown() {
+}
+
+// Put outputs a string to the user application.
+func (t *Target) Put(s string) {
+	os.Stdout.WriteString(s)
+}
+
+//-----------------------------------------------------------------------------
@@ -11,8 +11,6 @@ Implements the soc.Driver interface for the CPUs control and status registers.
 package redv
 
 import (
-	"errors"
-
 	"github.com/deadsy/rvdbg/cpu/riscv/rv"
 	"github.com/deadsy/rvdbg/soc"
 )
@@ -44,7 +42,7 @@ func (drv *csrDriver) Rd(width, addr uint) (uint, error) {
 }
 
 func (drv *csrDriver) Wr(width, addr, val uint) error {
-	return errors.New("TODO")
+	return drv.dbg.WrCSR(addr, width, uint64(val))
 }
 
 //-----------------------------------------------------------------------------
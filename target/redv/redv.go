@@ -24,6 +24,7 @@ import (
 	"github.com/deadsy/rvdbg/jtag"
 	"github.com/deadsy/rvdbg/mem"
 	"github.com/deadsy/rvdbg/soc"
+	"github.com/deadsy/rvdbg/sym"
 	"github.com/deadsy/rvdbg/target"
 )
 
@@ -43,21 +44,43 @@ var Info = target.Info{
 
 // menuRoot is the root menu.
 var menuRoot = cli.Menu{
+	{"asm", riscv.CmdAsm, riscv.AsmHelp},
+	{"break", riscv.CmdBreak, riscv.BreakHelp},
+	{"bt", riscv.CmdBt, riscv.BtHelp},
+	{"call", riscv.CmdCall, riscv.CallHelp},
+	{"context", riscv.ContextMenu, "hart context snapshots"},
 	{"cpu", riscv.Menu, "cpu functions"},
 	{"csr", riscv.CmdCSR, riscv.CsrHelp},
 	{"da", riscv.CmdDisassemble, riscv.DisassembleHelp},
 	{"dbg", rv13.Menu, "debugger functions"},
+	{"delete", riscv.CmdDelete, riscv.DeleteHelp},
+	{"exception", riscv.CmdException, riscv.ExceptionHelp},
 	{"exit", target.CmdExit},
-	{"gpr", riscv.CmdGpr},
-	{"halt", riscv.CmdHalt},
+	{"gpr", riscv.CmdGpr, riscv.GprHelp},
+	{"halt", riscv.CmdHalt, riscv.HaltHelp},
 	{"hart", riscv.CmdHart, riscv.HartHelp},
 	{"help", target.CmdHelp},
 	{"history", target.CmdHistory, cli.HistoryHelp},
+	{"info", riscv.InfoMenu, "information"},
 	{"jtag", jtag.Menu, "jtag functions"},
 	{"map", soc.CmdMap},
 	{"mem", mem.Menu, "memory functions"},
+	{"next", riscv.CmdNext},
+	{"pc", riscv.CmdPc, riscv.PcHelp},
+	{"pmp", riscv.CmdPmp, riscv.PmpHelp},
+	{"profile", riscv.CmdProfile, riscv.ProfileHelp},
 	{"regs", soc.CmdRegs, soc.RegsHelp},
-	{"resume", riscv.CmdResume},
+	{"reset", riscv.CmdReset, riscv.ResetHelp},
+	{"resume", riscv.CmdResume, riscv.ResumeHelp},
+	{"rwatch", riscv.CmdRwatch, riscv.WatchHelp},
+	{"semihost", riscv.CmdSemihost, riscv.SemihostHelp},
+	{"step", riscv.CmdStep},
+	{"stepi", riscv.CmdStepi, riscv.StepiHelp},
+	{"stepie", riscv.CmdStepie, riscv.StepieHelp},
+	{"sym", sym.Menu, "symbol table functions"},
+	{"vcsr", riscv.CmdVcsr, riscv.VcsrHelp},
+	{"vpr", riscv.CmdVpr, riscv.VprHelp},
+	{"watch", riscv.CmdWatch, riscv.WatchHelp},
 }
 
 //-----------------------------------------------------------------------------
@@ -70,6 +93,9 @@ type Target struct {
 	memDriver  *memDriver
 	csrDriver  *csrDriver
 	socDriver  *socDriver
+	poller     *riscv.Poller
+	semihost   *riscv.Semihost
+	symbols    *sym.Table
 }
 
 // New returns a new redv target.
@@ -104,7 +130,7 @@ func New(jtagDriver jtag.Driver) (target.Target, error) {
 	}
 
 	// create the CPU debug interface
-	rvDebug, err := riscv.NewDebug(jtagDevice)
+	rvDebug, err := riscv.NewDebug(jtagDevice, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -112,31 +138,44 @@ func New(jtagDriver jtag.Driver) (target.Target, error) {
 	// create the SoC device
 	socDevice := fe310.NewSoC(fe310.G002).Setup()
 
-	return &Target{
+	t := &Target{
 		jtagDevice: jtagDevice,
 		rvDebug:    rvDebug,
 		socDevice:  socDevice,
 		memDriver:  newMemDriver(rvDebug, socDevice),
 		socDriver:  newSocDriver(rvDebug),
 		csrDriver:  newCsrDriver(rvDebug),
-	}, nil
+		symbols:    sym.NewTable(),
+	}
+
+	// service semihosting requests
+	t.semihost, err = riscv.NewSemihost(rvDebug)
+	if err != nil {
+		return nil, err
+	}
 
+	// poll for asynchronous halts
+	t.poller = riscv.NewPoller(rvDebug, Info.Name, t)
+	t.poller.Start()
+
+	return t, nil
 }
 
 //-----------------------------------------------------------------------------
 
 // GetPrompt returns the target prompt string.
 func (t *Target) GetPrompt() string {
-	return t.rvDebug.GetPrompt(Info.Name)
+	return t.poller.GetPrompt()
 }
 
 // GetMenuRoot returns the target root menu.
 func (t *Target) GetMenuRoot() []cli.MenuItem {
-	return menuRoot
+	return t.poller.Wrap(menuRoot)
 }
 
 // Shutdown shuts down the target application.
 func (t *Target) Shutdown() {
+	t.poller.Stop()
 }
 
 // Put outputs a string to the user application.
@@ -171,4 +210,14 @@ func (t *Target) GetJtagDevice() *jtag.Device {
 	return t.jtagDevice
 }
 
+// GetSymbols returns the symbol table.
+func (t *Target) GetSymbols() *sym.Table {
+	return t.symbols
+}
+
+// GetSemihost returns the semihosting state.
+func (t *Target) GetSemihost() *riscv.Semihost {
+	return t.semihost
+}
+
 //-----------------------------------------------------------------------------